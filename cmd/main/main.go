@@ -3,16 +3,24 @@ package main
 import (
 	"context"
 	"net/http"
+	"os"
+	"strconv"
 	"time"
 	http2 "todo/handler/http"
 	internalDB "todo/internal/db"
+	"todo/internal/job"
 	internalLog "todo/internal/log"
+	internalSearch "todo/internal/search"
 	"todo/internal/server"
 	"todo/search"
 	"todo/task"
 	"todo/user"
+	"todo/view"
 )
 
+// indexBatchSize is the number of index jobs claimed by a worker at once.
+const indexBatchSize = 100
+
 func main() {
 
 	logger := internalLog.New()
@@ -28,16 +36,59 @@ func main() {
 	ctx = context.WithValue(ctx, user.UserContextKey, user.User{ID: 1})
 
 	// Migrate the schema
-	_ = db.AutoMigrate(&search.SQLUserIndex{}, &task.Task{}, &user.User{})
+	_ = db.AutoMigrate(&search.SQLUserIndex{}, &search.SQLPostingList{}, &search.SQLIndexedDocument{}, &search.SQLTermList{}, &search.SynonymSet{}, &task.Task{}, &task.IndexJob{}, &user.User{}, &view.View{})
 
-	searchRepo := search.NewSQLRepository(db)
+	searchBackend, err := internalSearch.New(db)
+	if err != nil {
+		logger.Fatalf("Failed to create search backend: %v", err)
+	}
+	synonymRepo := search.NewSQLSynonymRepository(db)
 	taskRepo := task.NewSQLRepository(db)
 	userRepo := user.NewSQLRepository(db)
+	viewRepo := view.NewSQLRepository(db)
+
+	if err := taskRepo.Migrate(ctx); err != nil {
+		logger.Fatalf("Failed to migrate tasks: %v", err)
+	}
 
-	searchService := search.NewService(searchRepo)
+	searchService := search.NewService(searchBackend, synonymRepo, task.SearchSchema)
 	taskService := task.NewService(taskRepo, searchService)
+	viewService := view.NewService(viewRepo, taskService)
+
+	// Rebuild search indexes stored in an outdated format or index tasks for a new backend
+	if err := searchBackend.Migrate(ctx, taskService.Documents); err != nil {
+		logger.Fatalf("Failed to migrate search indexes: %v", err)
+	}
+
+	archiveInterval, err := time.ParseDuration(os.Getenv("ARCHIVE_INTERVAL"))
+	if err != nil {
+		archiveInterval = time.Hour
+	}
+	go job.Run(ctx, logger, "archive_finished_tasks", archiveInterval, func(ctx context.Context) error {
+		archived, err := taskService.ArchiveFinished(ctx)
+		if archived > 0 {
+			logger.With("count", archived).Info("Archived finished tasks")
+		}
+		return err
+	})
+
+	// Index changes of tasks written to the outbox
+	indexWorkers, err := strconv.Atoi(os.Getenv("INDEX_WORKERS"))
+	if err != nil || indexWorkers <= 0 {
+		indexWorkers = 2
+	}
+	indexInterval, err := time.ParseDuration(os.Getenv("INDEX_INTERVAL"))
+	if err != nil {
+		indexInterval = 100 * time.Millisecond
+	}
+	for i := 0; i < indexWorkers; i++ {
+		go job.Run(ctx, logger, "index_tasks", indexInterval, func(ctx context.Context) error {
+			_, err := taskService.ProcessIndexJobs(ctx, userRepo, indexBatchSize)
+			return err
+		})
+	}
 
-	srv := server.New(http2.NewHandler(logger, taskService, searchService, userRepo))
+	srv := server.New(http2.NewHandler(logger, taskService, searchService, viewService, userRepo, os.Getenv("ADMIN_TOKEN")))
 	logger.With("addr", srv.Addr).Info("Starting the server")
 
 	done := make(chan struct{}, 1)
@@ -0,0 +1,77 @@
+// Command searchindex checks that search indexes of users match their tasks and repairs or rebuilds them.
+//
+//	searchindex -user 42 -rebuild    rebuilds the index of the user
+//	searchindex -user 42             reports orphaned and missing tasks of the user's index
+//	searchindex -all -repair         checks indexes of all users in batches and rebuilds inconsistent ones
+package main
+
+import (
+	"context"
+	"flag"
+	internalDB "todo/internal/db"
+	internalLog "todo/internal/log"
+	internalSearch "todo/internal/search"
+	"todo/search"
+	"todo/task"
+	"todo/user"
+)
+
+func main() {
+	userID := flag.Uint("user", 0, "ID of the user whose index is checked")
+	all := flag.Bool("all", false, "check indexes of all users")
+	batchSize := flag.Int("batch", 100, "number of users loaded at once when all users are checked")
+	repair := flag.Bool("repair", false, "rebuild inconsistent indexes")
+	rebuild := flag.Bool("rebuild", false, "rebuild the index of the user without checking it")
+	flag.Parse()
+
+	logger := internalLog.New()
+	if (*userID == 0) == !*all {
+		logger.Fatal("Either -user or -all is required")
+	}
+	if *rebuild && *all {
+		logger.Fatal("-rebuild works for a single user, use -all -repair to rebuild inconsistent indexes")
+	}
+
+	db, err := internalDB.New()
+	if err != nil {
+		logger.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	searchBackend, err := internalSearch.New(db)
+	if err != nil {
+		logger.Fatalf("Failed to create search backend: %v", err)
+	}
+	userRepo := user.NewSQLRepository(db)
+	searchService := search.NewService(searchBackend, search.NewSQLSynonymRepository(db), task.SearchSchema)
+	taskService := task.NewService(task.NewSQLRepository(db), searchService)
+	ctx := context.Background()
+
+	if *rebuild {
+		indexed, err := taskService.RebuildIndex(ctx, userRepo, *userID)
+		if err != nil {
+			logger.Fatalf("Failed to rebuild search index: %v", err)
+		}
+		logger.With("user_id", *userID).With("indexed", indexed).Info("Rebuilt search index")
+		return
+	}
+
+	checked, inconsistent := 0, 0
+	opts := task.CheckOptions{UserID: *userID, BatchSize: *batchSize, Repair: *repair}
+	err = taskService.CheckIndexes(ctx, userRepo, opts, func(report *task.IndexReport) error {
+		checked++
+		if report.Consistent() {
+			return nil
+		}
+		inconsistent++
+		logger.With("user_id", report.UserID).
+			With("orphaned", report.Orphaned).
+			With("missing", report.Missing).
+			With("repaired", report.Repaired).
+			Warn("Inconsistent search index")
+		return nil
+	})
+	if err != nil {
+		logger.Fatalf("Failed to check search indexes: %v", err)
+	}
+	logger.With("checked", checked).With("inconsistent", inconsistent).Info("Checked search indexes")
+}
@@ -0,0 +1,93 @@
+package http
+
+import (
+	"crypto/subtle"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"strings"
+	"todo/task"
+	"todo/user"
+)
+
+// adminMiddleware allows requests with the admin token in the bearer authorization header.
+// Admin routes are disabled if no token is configured.
+func adminMiddleware(token string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func rebuildSearchIndex(taskService *task.Service, userRepo user.Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, APIErrorResponse{Error: "invalid user id"})
+			return
+		}
+
+		indexed, err := taskService.RebuildIndex(r.Context(), userRepo, uint(userID))
+		if err != nil {
+			zap.S().With("error", err).Error("rebuild search index failed")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		render.JSON(w, r, rebuildIndexResponse{UserID: uint(userID), Indexed: indexed})
+	}
+}
+
+// checkSearchIndexes checks search indexes of one user(user_id param) or all users, batch_size sets the number
+// of users loaded at once and repair=true rebuilds inconsistent indexes. Only inconsistent indexes are reported.
+func checkSearchIndexes(taskService *task.Service, userRepo user.Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var opts task.CheckOptions
+		if userID := r.URL.Query().Get("user_id"); userID != "" {
+			id, err := strconv.ParseUint(userID, 10, 64)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, APIErrorResponse{Error: "invalid user id"})
+				return
+			}
+			opts.UserID = uint(id)
+		}
+		if batchSize := r.URL.Query().Get("batch_size"); batchSize != "" {
+			size, err := strconv.Atoi(batchSize)
+			if err != nil || size <= 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, APIErrorResponse{Error: "invalid batch size"})
+				return
+			}
+			opts.BatchSize = size
+		}
+		opts.Repair = r.URL.Query().Get("repair") == "true"
+
+		response := checkIndexResponse{Reports: []*task.IndexReport{}}
+		err := taskService.CheckIndexes(r.Context(), userRepo, opts, func(report *task.IndexReport) error {
+			response.Checked++
+			if !report.Consistent() {
+				response.Reports = append(response.Reports, report)
+			}
+			return nil
+		})
+		if err != nil {
+			zap.S().With("error", err).Error("check search indexes failed")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		render.JSON(w, r, response)
+	}
+}
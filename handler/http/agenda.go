@@ -0,0 +1,34 @@
+package http
+
+import (
+	"errors"
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+	"net/http"
+	"todo/task"
+)
+
+func getAgenda(service *task.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		agendaRange := task.AgendaRange(r.URL.Query().Get("range"))
+		if agendaRange == "" {
+			agendaRange = task.TodayRange
+		}
+
+		agenda, err := service.Agenda(r.Context(), agendaRange)
+		switch {
+		case err == nil:
+			break
+		case errors.Is(err, task.ErrInvalidAgendaRange):
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, APIErrorResponse{Error: err.Error()})
+			return
+		default:
+			zap.S().With("error", err).Error("fetch agenda failed")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		render.JSON(w, r, agenda)
+	}
+}
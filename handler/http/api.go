@@ -1,14 +1,82 @@
 package http
 
+import (
+	"encoding/json"
+	"time"
+	"todo/search"
+	"todo/task"
+)
+
 type createTaskRequest struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	DueAt       *time.Time `json:"due_at"`
 }
 
 type updateTaskRequest struct {
 	Title       *string `json:"title"`
 	Description *string `json:"description"`
 	Status      *string `json:"status"`
+	// DueAt is a RFC3339 time, empty string removes the due date.
+	DueAt *string `json:"due_at"`
+}
+
+type createViewRequest struct {
+	Name     string      `json:"name"`
+	Query    string      `json:"query"`
+	Filter   task.Filter `json:"filter"`
+	Pinned   bool        `json:"pinned"`
+	Position int         `json:"position"`
+}
+
+type updateViewRequest struct {
+	Name     *string      `json:"name"`
+	Query    *string      `json:"query"`
+	Filter   *task.Filter `json:"filter"`
+	Pinned   *bool        `json:"pinned"`
+	Position *int         `json:"position"`
+}
+
+type rebuildIndexResponse struct {
+	UserID  uint `json:"user_id"`
+	Indexed int  `json:"indexed"`
+}
+
+type checkIndexResponse struct {
+	// Checked is the number of checked indexes, Reports contain only inconsistent ones.
+	Checked int                 `json:"checked"`
+	Reports []*task.IndexReport `json:"reports"`
+}
+
+type healthResponse struct {
+	Status      string         `json:"status"`
+	SearchIndex *task.IndexLag `json:"search_index,omitempty"`
+}
+
+type synonymsRequest struct {
+	Rule string `json:"rule"`
+}
+
+// analyzeRequest is a text to analyze, the analyzer is the name of an available analyzer or a config of one,
+// no analyzer means the analyzer of the user's settings.
+type analyzeRequest struct {
+	Text     string          `json:"text"`
+	Analyzer json.RawMessage `json:"analyzer"`
+}
+
+// analyzeResponse contains the config of the analyzer and tokens produced by every stage of it.
+type analyzeResponse struct {
+	Analyzer *search.Analyzer `json:"analyzer"`
+	Stages   []search.Stage   `json:"stages"`
+	Tokens   []string         `json:"tokens"`
+}
+
+// updateSettingsRequest contains settings to change, the analyzer is the name of an available analyzer or a config
+// of one.
+type updateSettingsRequest struct {
+	Timezone         *string         `json:"timezone"`
+	ArchiveAfterDays *int            `json:"archive_after_days"`
+	Analyzer         json.RawMessage `json:"analyzer"`
 }
 
 type signupRequest struct {
@@ -22,13 +90,44 @@ type signupResponse struct {
 }
 
 type ListResponse struct {
-	Total  int64       `json:"total"`
-	Count  int         `json:"count"`
-	Offset int         `json:"offset"`
-	Limit  int         `json:"limit"`
-	Data   interface{} `json:"data"`
+	Total      int64       `json:"total"`
+	Count      int         `json:"count"`
+	Offset     int         `json:"offset"`
+	Limit      int         `json:"limit"`
+	Data       interface{} `json:"data"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	// Facets are counts of all search matches by status, they're set only for searches.
+	Facets *task.Facets `json:"facets,omitempty"`
+	// DidYouMean are corrected queries that find tasks, they're set for searches that found nothing.
+	DidYouMean []string `json:"did_you_mean,omitempty"`
+}
+
+// SearchResult is a found task with highlighted fragments of its fields.
+type SearchResult struct {
+	*task.Task
+	Highlight Highlight `json:"highlight"`
+}
+
+// RelatedTask is a task similar to another task, similarity is the cosine similarity of their TF-IDF vectors from 0 to 1.
+type RelatedTask struct {
+	*task.Task
+	Similarity float64 `json:"similarity"`
+}
+
+// createTaskResponse is a created task with tasks it may duplicate.
+type createTaskResponse struct {
+	*task.Task
+	PossibleDuplicates []RelatedTask `json:"possible_duplicates,omitempty"`
+}
+
+// Highlight contains the title and a snippet of the description of a task with matched words wrapped in markers.
+type Highlight struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
 }
 
 type APIErrorResponse struct {
 	Error string `json:"error"`
+	// Position points to the problem in a malformed search query.
+	Position *int `json:"position,omitempty"`
 }
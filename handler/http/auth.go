@@ -74,6 +74,7 @@ func singup(userRepo user.Repository) http.HandlerFunc {
 		usr := &user.User{
 			Username:       req.Username,
 			HashedPassword: hashedPassword[:],
+			Settings:       user.Settings{ArchiveAfterDays: user.DefaultArchiveAfterDays},
 		}
 
 		usr, err := userRepo.Create(r.Context(), usr)
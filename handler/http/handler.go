@@ -9,10 +9,12 @@ import (
 	"todo/search"
 	"todo/task"
 	"todo/user"
+	"todo/view"
 )
 
-// NewHandler return a new router with some handy middleware and api routes
-func NewHandler(log *zap.SugaredLogger, taskService *task.Service, searchService *search.Service, userRepo user.Repository) chi.Router {
+// NewHandler return a new router with some handy middleware and api routes.
+// Admin routes are authorized by the admin token, they're disabled if the token is empty.
+func NewHandler(log *zap.SugaredLogger, taskService *task.Service, searchService *search.Service, viewService *view.Service, userRepo user.Repository, adminToken string) chi.Router {
 	r := chi.NewRouter()
 
 	r.Use(
@@ -21,9 +23,7 @@ func NewHandler(log *zap.SugaredLogger, taskService *task.Service, searchService
 		middleware.Timeout(60*time.Second),
 	)
 
-	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-	})
+	r.Get("/health", health(taskService))
 
 	r.Post("/v1/signup", singup(userRepo))
 
@@ -32,15 +32,41 @@ func NewHandler(log *zap.SugaredLogger, taskService *task.Service, searchService
 			r.With(paginationMiddleware()).Get("/", getTasks(taskService))
 			r.Post("/", createTask(taskService))
 			r.With(taskMiddleware(taskService)).Get("/{id}", getTask(taskService))
+			r.With(taskMiddleware(taskService), paginationMiddleware()).Get("/{id}/related", getRelatedTasks(taskService))
 			r.With(taskMiddleware(taskService)).Patch("/{id}", updateTask(taskService))
 			r.With(taskMiddleware(taskService)).Post("/{id}/complete", completeTask(taskService))
 			r.With(taskMiddleware(taskService)).Delete("/{id}", deleteTask(taskService))
 		})
+		r.Route("/views", func(r chi.Router) {
+			r.Get("/", getViews(viewService))
+			r.Post("/", createView(viewService))
+			r.With(viewMiddleware(viewService)).Get("/{id}", getView(viewService))
+			r.With(viewMiddleware(viewService)).Patch("/{id}", updateView(viewService))
+			r.Delete("/{id}", deleteView(viewService))
+			r.With(viewMiddleware(viewService), paginationMiddleware()).Get("/{id}/tasks", getViewTasks(viewService))
+		})
+		r.Get("/agenda", getAgenda(taskService))
+		r.Get("/stats", getStats(taskService))
+		r.Get("/settings", getSettings())
+		r.Patch("/settings", updateSettings(userRepo, taskService))
 		r.Route("/search", func(r chi.Router) {
 			r.With(paginationMiddleware()).Get("/", searchTasks(searchService, taskService))
+			r.With(paginationMiddleware()).Get("/suggest", suggest(taskService))
+			r.Post("/analyze", analyze(searchService))
+			r.Route("/synonyms", func(r chi.Router) {
+				r.Get("/", getSynonyms(searchService))
+				r.Post("/", createSynonyms(searchService))
+				r.Put("/{id}", updateSynonyms(searchService))
+				r.Delete("/{id}", deleteSynonyms(searchService))
+			})
 		})
 	})
 
+	r.With(adminMiddleware(adminToken), profilingMiddleware(log)).Route("/admin", func(r chi.Router) {
+		r.Post("/users/{id}/search/rebuild", rebuildSearchIndex(taskService, userRepo))
+		r.Post("/search/check", checkSearchIndexes(taskService, userRepo))
+	})
+
 	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNotFound)
 	})
@@ -0,0 +1,22 @@
+package http
+
+import (
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+	"net/http"
+	"todo/task"
+)
+
+// health reports whether the app can reach the database and how far search indexes are behind tasks.
+func health(taskService *task.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lag, err := taskService.IndexLag(r.Context())
+		if err != nil {
+			zap.S().With("error", err).Error("health check failed")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			render.JSON(w, r, healthResponse{Status: "unavailable"})
+			return
+		}
+		render.JSON(w, r, healthResponse{Status: "ok", SearchIndex: lag})
+	}
+}
@@ -2,8 +2,18 @@ package http
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/render"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
 )
 
 const (
@@ -16,18 +26,36 @@ const (
 	PaginationCtxKey string = "pagination"
 )
 
+// cursorKey signs cursors. Without PAGINATION_CURSOR_SECRET a random key is generated on start, so cursors
+// can't be forged, but they're valid only in the process that issued them.
+var cursorKey = newCursorKey(os.Getenv("PAGINATION_CURSOR_SECRET"))
+
+var errInvalidCursor = errors.New("invalid cursor")
+
 type Pagination struct {
 	Limit  int
 	Offset int
+	// Cursor is set when the client asked for a keyset page, in this case Offset is ignored.
+	Cursor *Cursor
+}
+
+// Cursor points to the last item of the previous page: its sort key and ID.
+type Cursor struct {
+	Key string `json:"k"`
+	ID  string `json:"id"`
+	// Sort is the order of the list the cursor was issued for, a cursor of another order compares
+	// the key with another column, so it's rejected.
+	Sort string `json:"s,omitempty"`
 }
 
-// paginationMiddleware is used to extract offset and limit from the url query
+// paginationMiddleware is used to extract offset, limit and cursor from the url query
 func paginationMiddleware() func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 			limitQ := r.URL.Query().Get("limit")
 			offsetQ := r.URL.Query().Get("offset")
+			cursorQ := r.URL.Query().Get("cursor")
 
 			limit := defaultLimit
 			offset := defaultOffset
@@ -56,11 +84,73 @@ func paginationMiddleware() func(next http.Handler) http.Handler {
 				}
 			}
 
+			var cursor *Cursor
+			if cursorQ != "" {
+				cursor, err = decodeCursor(cursorQ)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					render.JSON(w, r, APIErrorResponse{Error: err.Error()})
+					return
+				}
+				offset = defaultOffset
+			}
+
 			ctx := context.WithValue(r.Context(), PaginationCtxKey, Pagination{
 				Limit:  limit,
 				Offset: offset,
+				Cursor: cursor,
 			})
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// encodeCursor returns an opaque token for the cursor.
+// The token is signed, so clients can't forge a cursor pointing to an arbitrary position.
+func encodeCursor(c Cursor) string {
+	payload, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(signCursor(payload))
+}
+
+// decodeCursor verifies the token signature and returns the cursor it holds.
+func decodeCursor(token string) (*Cursor, error) {
+	payloadPart, signaturePart, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(payloadPart)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(signaturePart)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	if !hmac.Equal(signature, signCursor(payload)) {
+		return nil, errInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(payload, &c); err != nil || c.ID == "" {
+		return nil, errInvalidCursor
+	}
+	return &c, nil
+}
+
+func signCursor(payload []byte) []byte {
+	mac := hmac.New(sha256.New, cursorKey)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// newCursorKey returns the key of the secret, or a random key if the secret is empty.
+func newCursorKey(secret string) []byte {
+	if secret != "" {
+		return []byte(secret)
+	}
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("failed to generate cursor key: %v", err))
+	}
+	return key
+}
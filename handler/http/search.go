@@ -1,48 +1,220 @@
 package http
 
 import (
+	"encoding/json"
+	"errors"
 	"github.com/go-chi/render"
 	"go.uber.org/zap"
 	"net/http"
+	"strconv"
+	"strings"
 	"todo/search"
 	"todo/task"
 )
 
+// snippetSize is the length of description snippets of found tasks, in characters.
+const snippetSize = 160
+
+// hitSort is the sort of cursors of search hits, hits are sorted by score.
+const hitSort = "score"
+
+// searchTasks searches the user's tasks, it accepts the same filters as getTasks. Filters are applied to all matches
+// before they're paginated, tasks are sorted by relevance, so the sort param is ignored.
 func searchTasks(searchService *search.Service, taskService *task.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		query := r.URL.Query().Get("query")
 		if query == "" {
 			render.JSON(w, r, ListResponse{})
+			return
 		}
+		filter, err := parseTaskFilter(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, APIErrorResponse{Error: err.Error()})
+			return
+		}
+		filter.Sort = ""
 
-		taskIds, err := searchService.Search(r.Context(), query)
+		hits, err := taskService.SearchHits(r.Context(), query)
+		var parseErr *search.ParseError
+		if errors.As(err, &parseErr) {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, APIErrorResponse{Error: parseErr.Error(), Position: &parseErr.Pos})
+			return
+		}
 		if err != nil {
 			zap.S().With("error", err).Error("search failed")
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		if len(taskIds) == 0 {
-			render.JSON(w, r, ListResponse{})
+		if len(hits) == 0 {
+			corrections, err := searchService.DidYouMean(r.Context(), query)
+			if err != nil {
+				// corrections are optional, the search itself succeeded
+				zap.S().With("error", err).Error("did you mean failed")
+			}
+			render.JSON(w, r, ListResponse{DidYouMean: corrections})
+			return
+		}
+
+		facets, err := taskService.Facets(r.Context(), hits, filter)
+		if err != nil {
+			zap.S().With("error", err).Error("count search facets failed")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		hits, err = taskService.FilterHits(r.Context(), hits, filter)
+		if err != nil {
+			zap.S().With("error", err).Error("filter found tasks failed")
+			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
 		pagination := r.Context().Value(PaginationCtxKey).(Pagination)
-		includeAllStatuses := r.URL.Query().Get("include_statuses") == "all"
-		opts := task.QueryOptions{
-			Limit:  pagination.Limit,
-			Offset: pagination.Offset,
+		page, err := pageHits(hits, pagination)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, APIErrorResponse{Error: err.Error()})
+			return
+		}
+
+		tasks, err := taskService.FindByHits(r.Context(), page, task.QueryOptions{Filter: filter})
+		if err != nil {
+			zap.S().With("error", err).Error("fetch found tasks failed")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		render.JSON(w, r, ListResponse{
+			Total:      int64(len(hits)),
+			Offset:     pagination.Offset,
+			Limit:      pagination.Limit,
+			Count:      len(tasks),
+			Data:       highlight(r, searchService.Analyzer(r.Context()), tasks, page),
+			NextCursor: nextHitCursor(page, pagination.Limit),
+			Facets:     facets,
+		})
+	}
+}
+
+// highlight wraps words of tasks that matched the query in markers, markers can be set by pre_tag and post_tag params.
+func highlight(r *http.Request, analyzer *search.Analyzer, tasks []*task.Task, hits []search.Hit) []SearchResult {
+	highlighter := search.NewHighlighter(analyzer)
+	if preTag := r.URL.Query().Get("pre_tag"); preTag != "" {
+		highlighter.PreTag = preTag
+	}
+	if postTag := r.URL.Query().Get("post_tag"); postTag != "" {
+		highlighter.PostTag = postTag
+	}
+
+	tokens := make(map[string][]string, len(hits))
+	for _, hit := range hits {
+		tokens[hit.ID] = hit.Tokens
+	}
+	results := make([]SearchResult, len(tasks))
+	for i, t := range tasks {
+		results[i] = SearchResult{
+			Task: t,
+			Highlight: Highlight{
+				Title:       highlighter.Highlight(t.Title, tokens[t.ID]),
+				Description: highlighter.Snippet(t.Description, tokens[t.ID], snippetSize),
+			},
+		}
+	}
+	return results
+}
+
+func suggest(taskService *task.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		prefix := r.URL.Query().Get("prefix")
+		pagination := r.Context().Value(PaginationCtxKey).(Pagination)
+		if strings.TrimSpace(prefix) == "" {
+			render.JSON(w, r, ListResponse{Limit: pagination.Limit, Data: []search.Suggestion{}})
+			return
 		}
-		if includeAllStatuses {
-			opts.IncludeStatuses = []task.Status{task.CreatedStatus, task.ArchivedStatus, task.FinishedStatus}
+
+		suggestions, err := taskService.Suggest(r.Context(), prefix, pagination.Limit)
+		if err != nil {
+			zap.S().With("error", err).Error("suggest failed")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
 		}
-		tasks, err := taskService.Search(r.Context(), query, opts)
 
 		render.JSON(w, r, ListResponse{
-			Total:  int64(len(taskIds)),
-			Offset: pagination.Offset,
-			Limit:  pagination.Limit,
-			Count:  len(tasks),
-			Data:   tasks,
+			Total: int64(len(suggestions)),
+			Count: len(suggestions),
+			Limit: pagination.Limit,
+			Data:  suggestions,
 		})
 	}
 }
+
+// analyze shows tokens produced by every stage of an analyzer for a text, it's used to debug analyzer configs.
+func analyze(searchService *search.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req analyzeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, APIErrorResponse{Error: "invalid request json body"})
+			return
+		}
+
+		analyzer := searchService.Analyzer(r.Context())
+		if len(req.Analyzer) > 0 && string(req.Analyzer) != "null" {
+			var err error
+			analyzer, err = search.ParseAnalyzer(req.Analyzer)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, APIErrorResponse{Error: err.Error()})
+				return
+			}
+		}
+
+		stages := analyzer.AnalyzeStages(req.Text)
+		render.JSON(w, r, analyzeResponse{
+			Analyzer: analyzer,
+			Stages:   stages,
+			Tokens:   stages[len(stages)-1].Tokens,
+		})
+	}
+}
+
+// pageHits returns a page of ranked hits. Hits are sorted by score and ID,
+// so a cursor points to the score and ID of the last hit of the previous page.
+func pageHits(hits []search.Hit, pagination Pagination) ([]search.Hit, error) {
+	start := pagination.Offset
+	if pagination.Cursor != nil {
+		if pagination.Cursor.Sort != hitSort {
+			return nil, errInvalidCursor
+		}
+		score, err := strconv.ParseFloat(pagination.Cursor.Key, 64)
+		if err != nil {
+			return nil, errInvalidCursor
+		}
+		start = len(hits)
+		for i, hit := range hits {
+			if hit.Score < score || (hit.Score == score && hit.ID > pagination.Cursor.ID) {
+				start = i
+				break
+			}
+		}
+	}
+
+	if start > len(hits) {
+		start = len(hits)
+	}
+	end := start + pagination.Limit
+	if end > len(hits) {
+		end = len(hits)
+	}
+	return hits[start:end], nil
+}
+
+// nextHitCursor returns a cursor to the next page of hits, or an empty string if this page is the last one.
+func nextHitCursor(page []search.Hit, limit int) string {
+	if len(page) == 0 || len(page) < limit {
+		return ""
+	}
+	last := page[len(page)-1]
+	return encodeCursor(Cursor{Key: strconv.FormatFloat(last.Score, 'g', -1, 64), ID: last.ID, Sort: hitSort})
+}
@@ -0,0 +1,85 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+	"net/http"
+	"todo/search"
+	"todo/task"
+	"todo/user"
+)
+
+func getSettings() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		usr := r.Context().Value(user.UserContextKey).(user.User)
+		render.JSON(w, r, usr.Settings)
+	}
+}
+
+func updateSettings(userRepo user.Repository, taskService *task.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		usr := r.Context().Value(user.UserContextKey).(user.User)
+
+		var req updateSettingsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, APIErrorResponse{Error: "invalid request json body"})
+			return
+		}
+
+		settings := usr.Settings
+		if req.Timezone != nil {
+			settings.Timezone = *req.Timezone
+		}
+		if req.ArchiveAfterDays != nil {
+			settings.ArchiveAfterDays = *req.ArchiveAfterDays
+		}
+		if len(req.Analyzer) > 0 && string(req.Analyzer) != "null" {
+			analyzer, err := search.ParseAnalyzer(req.Analyzer)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, APIErrorResponse{Error: err.Error()})
+				return
+			}
+			// The full config is saved, so tasks keep being analyzed the same way if the available analyzer
+			// of the name changes.
+			config, err := json.Marshal(analyzer)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, APIErrorResponse{Error: err.Error()})
+				return
+			}
+			settings.Analyzer = config
+		}
+		if err := settings.Validate(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, APIErrorResponse{Error: err.Error()})
+			return
+		}
+
+		// Tasks are indexed by the analyzer, so the index is rebuilt when another analyzer is chosen.
+		// The index is rebuilt before the settings are saved, so a failed rebuild doesn't leave the saved analyzer
+		// different from the analyzer of the index, and the request can be retried.
+		if !bytes.Equal(settings.Analyzer, usr.Settings.Analyzer) {
+			updated := usr
+			updated.Settings = settings
+			ctx := context.WithValue(r.Context(), user.UserContextKey, updated)
+			if err := taskService.Reindex(ctx); err != nil {
+				zap.S().With("error", err).Error("reindex tasks failed")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if err := userRepo.UpdateSettings(r.Context(), usr.ID, settings); err != nil {
+			zap.S().With("error", err).Error("update settings failed")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		render.JSON(w, r, settings)
+	}
+}
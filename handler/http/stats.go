@@ -0,0 +1,90 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+	"todo/task"
+	"todo/user"
+)
+
+const (
+	dateLayout        = "2006-01-02"
+	defaultStatsDays  = 30
+	defaultStatsWeeks = 12
+)
+
+func getStats(service *task.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		usr := r.Context().Value(user.UserContextKey).(user.User)
+
+		filter, err := parseTaskFilter(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, APIErrorResponse{Error: err.Error()})
+			return
+		}
+
+		opts := task.StatsOptions{
+			Filter:   filter,
+			Interval: task.Interval(r.URL.Query().Get("interval")),
+		}
+		if opts.Interval == "" {
+			opts.Interval = task.DayInterval
+		}
+		opts.From, opts.To, err = parseStatsRange(r, opts.Interval, usr.Settings.Location())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, APIErrorResponse{Error: err.Error()})
+			return
+		}
+
+		stats, err := service.Stats(r.Context(), opts)
+		switch {
+		case err == nil:
+			break
+		case errors.Is(err, task.ErrInvalidInterval) || errors.Is(err, task.ErrInvalidRange) ||
+			errors.Is(err, task.ErrInvalidStatus) || errors.Is(err, task.ErrInvalidSort):
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, APIErrorResponse{Error: err.Error()})
+			return
+		default:
+			zap.S().With("error", err).Error("fetch stats failed")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		render.JSON(w, r, stats)
+	}
+}
+
+// parseStatsRange reads from and to dates(both inclusive) in the user's timezone.
+// By default, the range ends today and covers the last 30 days or 12 weeks.
+func parseStatsRange(r *http.Request, interval task.Interval, loc *time.Location) (time.Time, time.Time, error) {
+	now := time.Now().In(loc)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, 1)
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.ParseInLocation(dateLayout, v, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %w", err)
+		}
+		to = t.AddDate(0, 0, 1)
+	}
+
+	from := to.AddDate(0, 0, -defaultStatsDays)
+	if interval == task.WeekInterval {
+		from = to.AddDate(0, 0, -7*defaultStatsWeeks)
+	}
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.ParseInLocation(dateLayout, v, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %w", err)
+		}
+		from = t
+	}
+
+	return from, to, nil
+}
@@ -0,0 +1,99 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"net/http"
+	"todo/search"
+)
+
+func getSynonyms(searchService *search.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sets, err := searchService.Synonyms(r.Context())
+		if err != nil {
+			zap.S().With("error", err).Error("fetch synonyms failed")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		render.JSON(w, r, ListResponse{
+			Total: int64(len(sets)),
+			Count: len(sets),
+			Limit: len(sets),
+			Data:  sets,
+		})
+	}
+}
+
+func createSynonyms(searchService *search.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req synonymsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, APIErrorResponse{Error: "invalid request json body"})
+			return
+		}
+
+		set, err := searchService.CreateSynonyms(r.Context(), &search.SynonymSet{
+			ID:   uuid.New().String(),
+			Rule: req.Rule,
+		})
+		switch {
+		case err == nil:
+			break
+		case errors.Is(err, search.ErrInvalidSynonyms):
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, APIErrorResponse{Error: err.Error()})
+			return
+		default:
+			zap.S().With("error", err).Error("create synonyms failed")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		render.JSON(w, r, set)
+	}
+}
+
+func updateSynonyms(searchService *search.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req synonymsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, APIErrorResponse{Error: "invalid request json body"})
+			return
+		}
+
+		err := searchService.UpdateSynonyms(r.Context(), &search.SynonymSet{
+			ID:   chi.URLParam(r, "id"),
+			Rule: req.Rule,
+		})
+		switch {
+		case err == nil:
+			w.WriteHeader(http.StatusNoContent)
+		case errors.Is(err, search.ErrSynonymsNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, search.ErrInvalidSynonyms):
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, APIErrorResponse{Error: err.Error()})
+		default:
+			zap.S().With("error", err).Error("update synonyms failed")
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+func deleteSynonyms(searchService *search.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := searchService.DeleteSynonyms(r.Context(), chi.URLParam(r, "id")); err != nil {
+			zap.S().With("error", err).Error("delete synonyms failed")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
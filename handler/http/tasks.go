@@ -4,11 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"todo/search"
 	"todo/task"
 	"todo/user"
 )
@@ -38,14 +43,25 @@ func taskMiddleware(taskService *task.Service) func(http.Handler) http.Handler {
 func getTasks(service *task.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		pagination := r.Context().Value(PaginationCtxKey).(Pagination)
-		includeAllStatuses := r.URL.Query().Get("include_statuses") == "all"
+		filter, err := parseTaskFilter(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, APIErrorResponse{Error: err.Error()})
+			return
+		}
+
+		after, err := taskCursor(pagination, filter)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, APIErrorResponse{Error: err.Error()})
+			return
+		}
 
 		opts := task.QueryOptions{
+			Filter: filter,
 			Limit:  pagination.Limit,
 			Offset: pagination.Offset,
-		}
-		if includeAllStatuses {
-			opts.IncludeStatuses = []task.Status{task.CreatedStatus, task.ArchivedStatus, task.FinishedStatus}
+			After:  after,
 		}
 		tasks, err := service.FindAll(r.Context(), opts)
 		if err != nil {
@@ -61,16 +77,95 @@ func getTasks(service *task.Service) http.HandlerFunc {
 			return
 		}
 		resp := ListResponse{
-			Total:  total,
-			Offset: pagination.Offset,
-			Limit:  pagination.Limit,
-			Count:  len(tasks),
-			Data:   tasks,
+			Total:      total,
+			Offset:     pagination.Offset,
+			Limit:      pagination.Limit,
+			Count:      len(tasks),
+			Data:       tasks,
+			NextCursor: nextTaskCursor(tasks, pagination.Limit, filter),
 		}
 		render.JSON(w, r, resp)
 	}
 }
 
+// parseTaskFilter reads the task filter from the url query.
+func parseTaskFilter(r *http.Request) (task.Filter, error) {
+	q := r.URL.Query()
+	var filter task.Filter
+
+	if q.Get("include_statuses") == "all" {
+		filter.IncludeStatuses = []task.Status{task.CreatedStatus, task.ArchivedStatus, task.FinishedStatus}
+	} else if statuses := q.Get("status"); statuses != "" {
+		for _, status := range strings.Split(statuses, ",") {
+			filter.IncludeStatuses = append(filter.IncludeStatuses, task.Status(status))
+		}
+	}
+
+	for param, dst := range map[string]**time.Time{
+		"created_after":  &filter.CreatedAfter,
+		"created_before": &filter.CreatedBefore,
+		"due_after":      &filter.DueAfter,
+		"due_before":     &filter.DueBefore,
+	} {
+		if v := q.Get(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s: %w", param, err)
+			}
+			*dst = &t
+		}
+	}
+
+	for param, dst := range map[string]*int{
+		"created_within_days": &filter.CreatedWithinDays,
+		"due_within_days":     &filter.DueWithinDays,
+	} {
+		if v := q.Get(param); v != "" {
+			days, err := strconv.Atoi(v)
+			if err != nil || days < 0 {
+				return filter, fmt.Errorf("invalid %s: %s", param, v)
+			}
+			*dst = days
+		}
+	}
+
+	if v := q.Get("scheduled"); v != "" {
+		scheduled, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid scheduled: %s", v)
+		}
+		filter.Scheduled = &scheduled
+	}
+
+	filter.Sort = task.Sort(q.Get("sort"))
+
+	return filter, filter.Validate()
+}
+
+// taskCursor converts an opaque pagination cursor to a position in the task list sorted by the filter.
+func taskCursor(pagination Pagination, filter task.Filter) (*task.Cursor, error) {
+	if pagination.Cursor == nil {
+		return nil, nil
+	}
+	if pagination.Cursor.Sort != string(filter.Sort) {
+		return nil, errInvalidCursor
+	}
+	key, err := time.Parse(time.RFC3339Nano, pagination.Cursor.Key)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	return &task.Cursor{Key: key, ID: pagination.Cursor.ID}, nil
+}
+
+// nextTaskCursor returns a cursor to the next page, or an empty string if this page is the last one.
+func nextTaskCursor(tasks []*task.Task, limit int, filter task.Filter) string {
+	if len(tasks) == 0 || len(tasks) < limit {
+		return ""
+	}
+	last := tasks[len(tasks)-1]
+	return encodeCursor(Cursor{Key: filter.SortKey(last).Format(time.RFC3339Nano), ID: last.ID, Sort: string(filter.Sort)})
+}
+
 func getTask(service *task.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		t := r.Context().Value(task.TaskContextKey).(*task.Task)
@@ -113,6 +208,7 @@ func createTask(service *task.Service) http.HandlerFunc {
 			Description: req.Description,
 			Status:      task.CreatedStatus,
 			UserID:      usr.ID,
+			DueAt:       req.DueAt,
 		}
 
 		t, err := service.Create(r.Context(), &newTask)
@@ -129,11 +225,68 @@ func createTask(service *task.Service) http.HandlerFunc {
 			return
 		}
 
+		// Duplicates are a hint, the task is created even if they can't be found.
+		var duplicates []RelatedTask
+		hits, err := service.Duplicates(r.Context(), t)
+		if err == nil {
+			duplicates, err = relatedTasks(r.Context(), service, hits)
+		}
+		if err != nil {
+			zap.S().With("error", err).Warn("find duplicates of task failed")
+		}
+
 		w.WriteHeader(http.StatusCreated)
-		render.JSON(w, r, t)
+		render.JSON(w, r, createTaskResponse{Task: t, PossibleDuplicates: duplicates})
+	}
+}
+
+func getRelatedTasks(service *task.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t := r.Context().Value(task.TaskContextKey).(*task.Task)
+		pagination := r.Context().Value(PaginationCtxKey).(Pagination)
+
+		hits, err := service.Related(r.Context(), t, pagination.Limit)
+		if err != nil {
+			zap.S().With("error", err).Error("find related tasks failed")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		related, err := relatedTasks(r.Context(), service, hits)
+		if err != nil {
+			zap.S().With("error", err).Error("find related tasks failed")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		render.JSON(w, r, ListResponse{
+			Total: int64(len(related)),
+			Count: len(related),
+			Limit: pagination.Limit,
+			Data:  related,
+		})
 	}
 }
 
+// relatedTasks returns tasks of the hits with their similarities in the order of hits.
+func relatedTasks(ctx context.Context, service *task.Service, hits []search.Hit) ([]RelatedTask, error) {
+	related := make([]RelatedTask, 0, len(hits))
+	if len(hits) == 0 {
+		return related, nil
+	}
+	tasks, err := service.FindByHits(ctx, hits, task.QueryOptions{})
+	if err != nil {
+		return nil, err
+	}
+	scores := make(map[string]float64, len(hits))
+	for _, hit := range hits {
+		scores[hit.ID] = hit.Score
+	}
+	for _, t := range tasks {
+		related = append(related, RelatedTask{Task: t, Similarity: scores[t.ID]})
+	}
+	return related, nil
+}
+
 func updateTask(service *task.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := chi.URLParam(r, "id")
@@ -144,7 +297,7 @@ func updateTask(service *task.Service) http.HandlerFunc {
 			render.JSON(w, r, APIErrorResponse{Error: "invalid request json body"})
 			return
 		}
-		if req.Title == nil && req.Description == nil && req.Status == nil {
+		if req.Title == nil && req.Description == nil && req.Status == nil && req.DueAt == nil {
 			w.WriteHeader(http.StatusBadRequest)
 			render.JSON(w, r, APIErrorResponse{Error: "at least one field for update must be provided"})
 			return
@@ -155,6 +308,17 @@ func updateTask(service *task.Service) http.HandlerFunc {
 			Title:       req.Title,
 			Description: req.Description,
 		}
+		if req.DueAt != nil && *req.DueAt == "" {
+			updatedTask.ClearDueAt = true
+		} else if req.DueAt != nil {
+			dueAt, err := time.Parse(time.RFC3339, *req.DueAt)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, APIErrorResponse{Error: "invalid due_at"})
+				return
+			}
+			updatedTask.DueAt = &dueAt
+		}
 		if req.Status != nil {
 			switch *req.Status {
 			case string(task.CreatedStatus):
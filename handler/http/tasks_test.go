@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"go.uber.org/zap"
 	"io"
@@ -15,6 +16,7 @@ import (
 	"todo/search"
 	"todo/task"
 	"todo/user"
+	"todo/view"
 )
 
 func testHTTPCall(method, url string, body io.Reader, username, password string) (string, int, error) {
@@ -39,52 +41,120 @@ func testHTTPCall(method, url string, body io.Reader, username, password string)
 
 }
 
+// listedTasks are tasks of the user returned by the mock task repository.
+var listedTasks = []*task.Task{
+	{
+		ID:     "1",
+		UserID: 42,
+		Title:  "task 1",
+		Status: task.FinishedStatus,
+	},
+	{
+		ID:     "2",
+		UserID: 42,
+		Title:  "task 2",
+		Status: task.CreatedStatus,
+	},
+	{
+		ID:     "4",
+		UserID: 42,
+		Title:  "task 4",
+		Status: task.ArchivedStatus,
+	},
+}
+
+// filterTasks returns tasks of the statuses of the options, like the repository does.
+func filterTasks(tasks []*task.Task, options task.QueryOptions) []*task.Task {
+	var filtered []*task.Task
+	for _, t := range tasks {
+		for _, status := range options.IncludeStatuses {
+			if t.Status == status {
+				filtered = append(filtered, t)
+			}
+		}
+	}
+	return filtered
+}
+
 func Test_Generic(t *testing.T) {
 
 	// start test server with mock db
 	logger := zap.S()
+	var updatedIndex *search.UserIndex
+	var savedSettings *user.Settings
 	searchService := &search.Service{
-		Repo: search.MockUserIndexRepository{
+		Schema: task.SearchSchema,
+		Backend: &search.IndexBackend{Schema: task.SearchSchema, Repo: search.MockUserIndexRepository{
 			FindFn: func(ctx context.Context, userID uint) (*search.UserIndex, error) {
 				if userID != 42 {
 					return nil, fmt.Errorf("user not found")
 				}
-				return &search.UserIndex{
-					UserID: userID,
-					Index:  search.Index{"task": []string{"1", "2"}},
-				}, nil
+				return &search.UserIndex{UserID: userID}, nil
+			},
+			FindDocLengthsFn: func(ctx context.Context, userID uint, docIDs []string) (map[string]map[string]int, error) {
+				return map[string]map[string]int{"1": {task.TitleField: 2}, "2": {task.TitleField: 2}, "4": {task.TitleField: 2}}, nil
+			},
+			FindPostingsFn: func(ctx context.Context, userID uint, tokens []string) (search.Index, error) {
+				index := search.Index{"task": []search.Posting{{DocID: "1", Field: task.TitleField, TF: 1}, {DocID: "2", Field: task.TitleField, TF: 1}}}
+				postings := search.Index{}
+				for _, token := range tokens {
+					if tokenPostings, ok := index[token]; ok {
+						postings[token] = tokenPostings
+					}
+				}
+				return postings, nil
+			},
+			FindDocTokensFn: func(ctx context.Context, userID uint, docIDs []string) (map[string][]string, error) {
+				tokens := make(map[string][]string, len(docIDs))
+				for _, id := range docIDs {
+					tokens[id] = []string{"task"}
+				}
+				return tokens, nil
+			},
+			FindTermsFn: func(ctx context.Context, userID uint, filter search.TermFilter) (search.Terms, error) {
+				terms := search.Terms{{Word: "task", DocIDs: []string{"1", "2"}}, {Word: "tasks", DocIDs: []string{"3"}}}
+				return terms.WithPrefix(filter.Prefix), nil
 			},
 			UpdateFn: func(ctx context.Context, userIndex *search.UserIndex) error {
 				if userIndex.UserID != 42 {
 					return fmt.Errorf("user not found")
 				}
-				if reflect.DeepEqual(userIndex.Index, search.Index{"3": []string{"3"}, "task": []string{"3"}}) {
+				if userIndex.Analyzer != nil && userIndex.Analyzer.Name == "german" {
+					return fmt.Errorf("index is unavailable")
+				}
+				updatedIndex = userIndex
+				return nil
+			},
+			InsertFn: func(ctx context.Context, userIndex *search.UserIndex) error {
+				if userIndex.UserID != 42 {
+					return fmt.Errorf("user not found")
+				}
+				if reflect.DeepEqual(userIndex.Index, search.Index{"3": []search.Posting{{DocID: "3", TF: 1}}, "task": []search.Posting{{DocID: "3", TF: 1}}}) {
 					return fmt.Errorf("unexpected search index")
 				}
 				return nil
 			},
+			DeleteFn: func(ctx context.Context, userID uint, docIDs ...string) error {
+				return nil
+			},
 			CreateFn: nil,
-		}}
+		}},
+		SynonymRepo: search.MockSynonymRepository{
+			FindAllFn: func(ctx context.Context, userID uint) ([]*search.SynonymSet, error) {
+				return []*search.SynonymSet{{ID: "1", UserID: userID, Rule: "todo => task"}}, nil
+			},
+			CreateFn: func(ctx context.Context, set *search.SynonymSet) (*search.SynonymSet, error) {
+				return set, nil
+			},
+		},
+	}
 	taskService := &task.Service{
 		Repo: task.MockRepository{
 			FindAllFn: func(ctx context.Context, options task.QueryOptions) ([]*task.Task, error) {
-				return []*task.Task{
-					{
-						ID:     "1",
-						UserID: 42,
-						Title:  "task 1",
-						Status: task.FinishedStatus,
-					},
-					{
-						ID:     "2",
-						UserID: 42,
-						Title:  "task 2",
-						Status: task.CreatedStatus,
-					},
-				}, nil
+				return filterTasks(listedTasks, options), nil
 			},
 			CountAllFn: func(ctx context.Context, options task.QueryOptions) (int64, error) {
-				return 2, nil
+				return int64(len(filterTasks(listedTasks, options))), nil
 			},
 			FindByIDsFn: func(ctx context.Context, options task.QueryOptions) ([]*task.Task, error) {
 				tasks := make([]*task.Task, 0, len(options.IDs))
@@ -98,7 +168,33 @@ func Test_Generic(t *testing.T) {
 				}
 				return tasks, nil
 			},
-			FindByIDFn: nil,
+			FindIDsFn: func(ctx context.Context, options task.QueryOptions) ([]string, error) {
+				if options.UserID != 42 {
+					return nil, fmt.Errorf("unexpected user id: %d", options.UserID)
+				}
+				statuses := map[string]task.Status{"1": task.FinishedStatus, "2": task.CreatedStatus}
+				var ids []string
+				for _, id := range options.IDs {
+					for _, status := range options.IncludeStatuses {
+						if statuses[id] == status {
+							ids = append(ids, id)
+						}
+					}
+				}
+				return ids, nil
+			},
+			CountByStatusFn: func(ctx context.Context, options task.QueryOptions) (map[task.Status]int64, error) {
+				if options.UserID != 42 {
+					return nil, fmt.Errorf("unexpected user id: %d", options.UserID)
+				}
+				return map[task.Status]int64{task.FinishedStatus: int64(len(options.IDs))}, nil
+			},
+			FindByIDFn: func(ctx context.Context, userID uint, id string) (*task.Task, error) {
+				if userID != 42 || (id != "1" && id != "2") {
+					return nil, task.ErrNotFound
+				}
+				return &task.Task{ID: id, UserID: userID, Title: "task " + id, Status: task.CreatedStatus}, nil
+			},
 			CreateFn: func(ctx context.Context, userId uint, task *task.Task) (*task.Task, error) {
 				if userId != 42 {
 					return nil, fmt.Errorf("unexpected user id: %d", userId)
@@ -108,6 +204,12 @@ func Test_Generic(t *testing.T) {
 			},
 			UpdateFn: nil,
 			DeleteFn: nil,
+			SuggestTitlesFn: func(ctx context.Context, options task.QueryOptions, prefix string, limit int) ([]search.Suggestion, error) {
+				return []search.Suggestion{{Text: "task 1", Kind: search.TitleSuggestion, DocCount: 1}}, nil
+			},
+			IndexLagFn: func(ctx context.Context) (*task.IndexLag, error) {
+				return &task.IndexLag{Pending: 3, Dead: 1, Seconds: 1.5}, nil
+			},
 		},
 		SearchService: searchService,
 	}
@@ -117,6 +219,9 @@ func Test_Generic(t *testing.T) {
 			if user.Username != "rafa" {
 				return nil, fmt.Errorf("unexpected username: %s", user.Username)
 			}
+			if user.Settings.ArchiveAfterDays != 30 {
+				return nil, fmt.Errorf("unexpected archive period of a new user: %d", user.Settings.ArchiveAfterDays)
+			}
 			user.ID = uint(42)
 			return user, nil
 		},
@@ -125,11 +230,54 @@ func Test_Generic(t *testing.T) {
 				return nil, fmt.Errorf("unexpected username: %s", username)
 			}
 			hashedPassword := sha256.Sum256([]byte("salttest"))
-			return &user.User{ID: uint(42), Username: username, HashedPassword: hashedPassword[:]}, nil
+			usr := &user.User{ID: uint(42), Username: username, HashedPassword: hashedPassword[:]}
+			if savedSettings != nil {
+				usr.Settings = *savedSettings
+			}
+			return usr, nil
+		},
+		FindByIDFn: func(ctx context.Context, id uint) (*user.User, error) {
+			if id != 42 {
+				return nil, user.ErrNotFound
+			}
+			return &user.User{ID: id, Username: "rafa", Settings: user.Settings{Analyzer: user.Analyzer(`"spanish"`)}}, nil
+		},
+		UpdateSettingsFn: func(ctx context.Context, userID uint, settings user.Settings) error {
+			if userID != 42 {
+				return fmt.Errorf("unexpected user id: %d", userID)
+			}
+			savedSettings = &settings
+			return nil
+		},
+		IDsFn: func(ctx context.Context, after uint, limit int) ([]uint, error) {
+			if after < 42 {
+				return []uint{42}, nil
+			}
+			return nil, nil
 		},
 	}
 
-	handler := NewHandler(logger, taskService, searchService, userRepo)
+	viewService := &view.Service{
+		Repo: view.MockRepository{
+			FindByIDFn: func(ctx context.Context, userID uint, id string) (*view.View, error) {
+				if id == "legacy" {
+					return &view.View{ID: id, UserID: userID, Name: "projects", Query: "project:home"}, nil
+				}
+				if id != "1" {
+					return nil, view.ErrNotFound
+				}
+				return &view.View{
+					ID:     id,
+					UserID: userID,
+					Name:   "finished",
+					Filter: task.Filter{IncludeStatuses: []task.Status{task.FinishedStatus}},
+				}, nil
+			},
+		},
+		TaskService: taskService,
+	}
+
+	handler := NewHandler(logger, taskService, searchService, viewService, userRepo, "admin-token")
 	srv := httptest.NewServer(handler)
 	defer srv.Close()
 
@@ -148,6 +296,20 @@ func Test_Generic(t *testing.T) {
 		}
 	})
 
+	t.Run("health", func(t *testing.T) {
+		resp, code, err := testHTTPCall("GET", srv.URL+"/health", nil, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+		wantResp := `{"status":"ok","search_index":{"pending":3,"dead":1,"lag_seconds":1.5}}`
+		if resp != wantResp {
+			t.Fatalf("unexpected response: \n`%s`\nwant:\n`%s`", resp, wantResp)
+		}
+	})
+
 	t.Run("fetch something without login", func(t *testing.T) {
 		_, code, err := testHTTPCall("GET", srv.URL+"/v1/tasks", nil, "", "")
 		if err != nil {
@@ -172,6 +334,164 @@ func Test_Generic(t *testing.T) {
 		}
 	})
 
+	t.Run("fetch tasks of all statuses", func(t *testing.T) {
+		// the archived task 4 is hidden from the default list above
+		resp, code, err := testHTTPCall("GET", srv.URL+"/v1/tasks?include_statuses=all", nil, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+		if !strings.Contains(resp, `"total":3`) || !strings.Contains(resp, `"id":"4"`) {
+			t.Fatalf("expected archived task in response: `%s`", resp)
+		}
+	})
+
+	t.Run("fetch tasks by cursor", func(t *testing.T) {
+		resp, code, err := testHTTPCall("GET", srv.URL+"/v1/tasks?limit=2", nil, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+		var page struct {
+			NextCursor string `json:"next_cursor"`
+		}
+		if err := json.Unmarshal([]byte(resp), &page); err != nil {
+			t.Fatal(err)
+		}
+		if page.NextCursor == "" {
+			t.Fatalf("expected next cursor in response: `%s`", resp)
+		}
+
+		_, code, err = testHTTPCall("GET", srv.URL+"/v1/tasks?limit=2&cursor="+page.NextCursor, nil, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+
+		_, code, err = testHTTPCall("GET", srv.URL+"/v1/tasks?limit=2&sort=due_at&cursor="+page.NextCursor, nil, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusBadRequest {
+			t.Fatalf("expected status 400 for a cursor of another sort, got %d", code)
+		}
+
+		tampered := strings.Replace(page.NextCursor, ".", "x.", 1)
+		_, code, err = testHTTPCall("GET", srv.URL+"/v1/tasks?limit=2&cursor="+tampered, nil, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d", code)
+		}
+	})
+
+	t.Run("fetch view tasks", func(t *testing.T) {
+		resp, code, err := testHTTPCall("GET", srv.URL+"/v1/views/1/tasks", nil, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+		wantResp := `{"total":1,"count":1,"offset":0,"limit":10,"data":[{"id":"1","title":"task 1","description":"","status":"finished","user_id":42,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}]}`
+		if resp != wantResp {
+			t.Fatalf("unexpected response: `%s`", resp)
+		}
+
+		_, code, err = testHTTPCall("GET", srv.URL+"/v1/views/2/tasks", nil, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusNotFound {
+			t.Fatalf("expected status 404, got %d", code)
+		}
+	})
+
+	t.Run("view with unknown field", func(t *testing.T) {
+		resp, code, err := testHTTPCall("POST", srv.URL+"/v1/views", bytes.NewBufferString(`{"name":"projects","query":"project:home"}`), "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d: `%s`", code, resp)
+		}
+		_, code, err = testHTTPCall("PATCH", srv.URL+"/v1/views/1", bytes.NewBufferString(`{"query":"title:milk OR project:home"}`), "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d", code)
+		}
+
+		// a view saved before its field was removed from the schema
+		resp, code, err = testHTTPCall("GET", srv.URL+"/v1/views/legacy/tasks", nil, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d", code)
+		}
+		wantResp := `{"error":"invalid query at position 0: unknown field \"project\", known fields: description, status, title","position":0}`
+		if resp != wantResp {
+			t.Fatalf("unexpected response: \n`%s`\n, want: `\n%s`", resp, wantResp)
+		}
+	})
+
+	t.Run("update view with nothing to change", func(t *testing.T) {
+		resp, code, err := testHTTPCall("PATCH", srv.URL+"/v1/views/1", bytes.NewBufferString(`{}`), "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: `%s`", code, resp)
+		}
+	})
+
+	t.Run("fetch tasks with invalid filter", func(t *testing.T) {
+		_, code, err := testHTTPCall("GET", srv.URL+"/v1/tasks?status=unknown", nil, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d", code)
+		}
+	})
+
+	t.Run("fetch stats with invalid interval", func(t *testing.T) {
+		_, code, err := testHTTPCall("GET", srv.URL+"/v1/stats?interval=year", nil, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d", code)
+		}
+	})
+
+	t.Run("fetch agenda", func(t *testing.T) {
+		_, code, err := testHTTPCall("GET", srv.URL+"/v1/agenda?range=week", nil, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+
+		_, code, err = testHTTPCall("GET", srv.URL+"/v1/agenda?range=year", nil, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d", code)
+		}
+	})
+
 	t.Run("create task", func(t *testing.T) {
 		buf := bytes.NewBufferString(`{"title":"task 3"}`)
 		resp, code, err := testHTTPCall("POST", srv.URL+"/v1/tasks", buf, "rafa", "test")
@@ -187,6 +507,55 @@ func Test_Generic(t *testing.T) {
 		}
 	})
 
+	t.Run("create task with possible duplicates", func(t *testing.T) {
+		buf := bytes.NewBufferString(`{"title":"task"}`)
+		resp, code, err := testHTTPCall("POST", srv.URL+"/v1/tasks", buf, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d", code)
+		}
+		wantResp := `{"id":"3","title":"task","description":"","status":"created","user_id":42,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z","possible_duplicates":[{"id":"1","title":"task 1","description":"","status":"finished","user_id":42,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z","similarity":1},{"id":"2","title":"task 2","description":"","status":"finished","user_id":42,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z","similarity":1}]}`
+		if resp != wantResp {
+			t.Fatalf("unexpected response: \n`%s`\nwant:\n`%s`", resp, wantResp)
+		}
+	})
+
+	t.Run("related tasks", func(t *testing.T) {
+		resp, code, err := testHTTPCall("GET", srv.URL+"/v1/tasks/1/related", nil, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+		var got struct {
+			Total int `json:"total"`
+			Data  []struct {
+				ID         string  `json:"id"`
+				Similarity float64 `json:"similarity"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(resp), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Total != 1 || len(got.Data) != 1 || got.Data[0].ID != "2" {
+			t.Fatalf("unexpected response: `%s`", resp)
+		}
+		if s := got.Data[0].Similarity; s <= 0 || s >= 1 {
+			t.Errorf("unexpected similarity %v of tasks sharing a word", s)
+		}
+
+		_, code, err = testHTTPCall("GET", srv.URL+"/v1/tasks/5/related", nil, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusNotFound {
+			t.Fatalf("expected status 404, got %d", code)
+		}
+	})
+
 	t.Run("fetch tasks with search", func(t *testing.T) {
 		resp, code, err := testHTTPCall("GET", srv.URL+"/v1/search?query=task", nil, "rafa", "test")
 		if err != nil {
@@ -195,9 +564,352 @@ func Test_Generic(t *testing.T) {
 		if code != http.StatusOK {
 			t.Fatalf("expected status 200, got %d", code)
 		}
-		wantResp := `{"total":2,"count":2,"offset":0,"limit":10,"data":[{"id":"1","title":"task 1","description":"","status":"finished","user_id":42,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"},{"id":"2","title":"task 2","description":"","status":"finished","user_id":42,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}]}`
+		wantResp := `{"total":2,"count":2,"offset":0,"limit":10,"data":[{"id":"1","title":"task 1","description":"","status":"finished","user_id":42,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z","highlight":{"title":"\u003cem\u003etask\u003c/em\u003e 1","description":""}},{"id":"2","title":"task 2","description":"","status":"finished","user_id":42,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z","highlight":{"title":"\u003cem\u003etask\u003c/em\u003e 2","description":""}}],"facets":{"status":{"archived":0,"created":0,"finished":2}}}`
 		if resp != wantResp {
 			t.Fatalf("unexpected response: \n`%s`\nwant:\n`%s`", resp, wantResp)
 		}
 	})
+
+	t.Run("search with filters", func(t *testing.T) {
+		resp, code, err := testHTTPCall("GET", srv.URL+"/v1/search?query=task&status=created", nil, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+		var got ListResponse
+		if err := json.Unmarshal([]byte(resp), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Total != 1 || got.Count != 1 || !strings.Contains(resp, `"id":"2"`) {
+			t.Fatalf("unexpected response: `%s`", resp)
+		}
+
+		_, code, err = testHTTPCall("GET", srv.URL+"/v1/search?query=task&status=unknown", nil, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d", code)
+		}
+	})
+
+	t.Run("search with misspelled query", func(t *testing.T) {
+		resp, code, err := testHTTPCall("GET", srv.URL+"/v1/search?query=tsk", nil, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+		wantResp := `{"total":0,"count":0,"offset":0,"limit":0,"data":null,"did_you_mean":["task"]}`
+		if resp != wantResp {
+			t.Fatalf("unexpected response: \n`%s`\nwant:\n`%s`", resp, wantResp)
+		}
+	})
+
+	t.Run("search with custom highlight markers", func(t *testing.T) {
+		resp, code, err := testHTTPCall("GET", srv.URL+"/v1/search?query=tasks&limit=1&pre_tag=%5B&post_tag=%5D", nil, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+		var got struct {
+			Data []SearchResult `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(resp), &got); err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Data) != 1 || got.Data[0].Highlight.Title != "[task] 1" {
+			t.Fatalf("unexpected response: `%s`", resp)
+		}
+	})
+
+	t.Run("search with malformed query", func(t *testing.T) {
+		resp, code, err := testHTTPCall("GET", srv.URL+"/v1/search?query=%28task+OR", nil, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d", code)
+		}
+		wantResp := `{"error":"invalid query at position 8: expected a term, got \"end of query\"","position":8}`
+		if resp != wantResp {
+			t.Fatalf("unexpected response: \n`%s`\nwant:\n`%s`", resp, wantResp)
+		}
+	})
+
+	t.Run("search with unknown field", func(t *testing.T) {
+		resp, code, err := testHTTPCall("GET", srv.URL+"/v1/search?query=titel%3Ainvoice", nil, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d", code)
+		}
+		wantResp := `{"error":"invalid query at position 0: unknown field \"titel\", known fields: description, status, title","position":0}`
+		if resp != wantResp {
+			t.Fatalf("unexpected response: \n`%s`\nwant:\n`%s`", resp, wantResp)
+		}
+	})
+
+	t.Run("search with synonyms", func(t *testing.T) {
+		resp, code, err := testHTTPCall("GET", srv.URL+"/v1/search?query=todo", nil, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+		if !strings.Contains(resp, `"total":2`) || !strings.Contains(resp, `"title":"\u003cem\u003etask\u003c/em\u003e 1"`) {
+			t.Fatalf("unexpected response: `%s`", resp)
+		}
+	})
+
+	t.Run("create invalid synonyms", func(t *testing.T) {
+		buf := bytes.NewBufferString(`{"rule":"k8s => kubernetes => cluster"}`)
+		resp, code, err := testHTTPCall("POST", srv.URL+"/v1/search/synonyms", buf, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d", code)
+		}
+		wantResp := `{"error":"invalid synonyms: more than one \"=\u003e\""}`
+		if resp != wantResp {
+			t.Fatalf("unexpected response: \n`%s`\nwant:\n`%s`", resp, wantResp)
+		}
+	})
+
+	t.Run("suggest", func(t *testing.T) {
+		resp, code, err := testHTTPCall("GET", srv.URL+"/v1/search/suggest?prefix=Ta&limit=2", nil, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+		wantResp := `{"total":2,"count":2,"offset":0,"limit":2,"data":[{"text":"task","kind":"term","doc_count":2},{"text":"task 1","kind":"title","doc_count":1}]}`
+		if resp != wantResp {
+			t.Fatalf("unexpected response: \n`%s`\nwant:\n`%s`", resp, wantResp)
+		}
+	})
+
+	t.Run("analyze text", func(t *testing.T) {
+		buf := bytes.NewBufferString(`{"text":"Writing Notes"}`)
+		resp, code, err := testHTTPCall("POST", srv.URL+"/v1/search/analyze", buf, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+		wantResp := `{"analyzer":{"name":"english","filters":[{"type":"lowercase"},{"type":"stop","params":{"language":"english"}},{"type":"stemmer","params":{"language":"english"}}]},"stages":[{"kind":"tokenizer","name":"standard","tokens":["Writing","Notes"]},{"kind":"filter","name":"lowercase","tokens":["writing","notes"]},{"kind":"filter","name":"stop","tokens":["writing","notes"]},{"kind":"filter","name":"stemmer","tokens":["write","note"]}],"tokens":["write","note"]}`
+		if resp != wantResp {
+			t.Fatalf("unexpected response: \n`%s`\nwant:\n`%s`", resp, wantResp)
+		}
+	})
+
+	t.Run("analyze text with an analyzer config", func(t *testing.T) {
+		buf := bytes.NewBufferString(`{"text":"Fix C++","analyzer":{"name":"code","tokenizer":"whitespace","filters":[{"type":"lowercase"}]}}`)
+		resp, code, err := testHTTPCall("POST", srv.URL+"/v1/search/analyze", buf, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+		wantResp := `{"analyzer":{"name":"code","tokenizer":"whitespace","filters":[{"type":"lowercase"}]},"stages":[{"kind":"tokenizer","name":"whitespace","tokens":["Fix","C++"]},{"kind":"filter","name":"lowercase","tokens":["fix","c++"]}],"tokens":["fix","c++"]}`
+		if resp != wantResp {
+			t.Fatalf("unexpected response: \n`%s`\nwant:\n`%s`", resp, wantResp)
+		}
+
+		buf = bytes.NewBufferString(`{"text":"Fix C++","analyzer":{"filters":[{"type":"soundex"}]}}`)
+		_, code, err = testHTTPCall("POST", srv.URL+"/v1/search/analyze", buf, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d", code)
+		}
+	})
+
+	t.Run("update settings with unknown analyzer", func(t *testing.T) {
+		buf := bytes.NewBufferString(`{"analyzer":"klingon"}`)
+		resp, code, err := testHTTPCall("PATCH", srv.URL+"/v1/settings", buf, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d", code)
+		}
+		wantResp := `{"error":"unknown analyzer \"klingon\", available analyzers: english, french, german, russian, spanish, standard"}`
+		if resp != wantResp {
+			t.Fatalf("unexpected response: \n`%s`\nwant:\n`%s`", resp, wantResp)
+		}
+	})
+
+	t.Run("update settings analyzer reindexes tasks", func(t *testing.T) {
+		updatedIndex, savedSettings = nil, nil
+		buf := bytes.NewBufferString(`{"analyzer":"russian"}`)
+		resp, code, err := testHTTPCall("PATCH", srv.URL+"/v1/settings", buf, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+		russian, _ := json.Marshal(search.NewRussianAnalyzer())
+		wantResp := `{"timezone":"","archive_after_days":0,"analyzer":` + string(russian) + `}`
+		if resp != wantResp {
+			t.Fatalf("unexpected response: \n`%s`\nwant:\n`%s`", resp, wantResp)
+		}
+		if updatedIndex == nil || updatedIndex.Analyzer.Name != "russian" {
+			t.Fatalf("expected the index to be rebuilt by the russian analyzer, got %+v", updatedIndex)
+		}
+		if len(updatedIndex.DocLengths) != 3 {
+			t.Fatalf("expected 3 reindexed tasks, got %d", len(updatedIndex.DocLengths))
+		}
+		if savedSettings == nil || string(savedSettings.Analyzer) != string(russian) {
+			t.Fatalf("expected the config of the russian analyzer to be saved, got %+v", savedSettings)
+		}
+	})
+
+	t.Run("update settings with an analyzer config", func(t *testing.T) {
+		updatedIndex, savedSettings = nil, nil
+		config := `{"name":"code","tokenizer":"whitespace","filters":[{"type":"lowercase"},{"type":"edge_ngram","params":{"min":2,"max":4}}]}`
+		buf := bytes.NewBufferString(`{"analyzer":` + config + `}`)
+		resp, code, err := testHTTPCall("PATCH", srv.URL+"/v1/settings", buf, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+		wantResp := `{"timezone":"","archive_after_days":0,"analyzer":` + config + `}`
+		if resp != wantResp {
+			t.Fatalf("unexpected response: \n`%s`\nwant:\n`%s`", resp, wantResp)
+		}
+		if savedSettings == nil || string(savedSettings.Analyzer) != config {
+			t.Fatalf("expected the analyzer config to be saved, got %+v", savedSettings)
+		}
+		if updatedIndex == nil || updatedIndex.Analyzer.Name != "code" || len(updatedIndex.DocLengths) != 3 {
+			t.Fatalf("expected tasks to be reindexed by the analyzer config, got %+v", updatedIndex)
+		}
+		for token := range updatedIndex.Index {
+			if len([]rune(token)) > 4 {
+				t.Fatalf("expected edge n-grams of up to 4 letters to be indexed, got %q", token)
+			}
+		}
+		if _, ok := updatedIndex.Index["ta"]; !ok {
+			t.Fatalf("expected an edge n-gram of tasks to be indexed, got %v", updatedIndex.Index)
+		}
+
+		resp, code, err = testHTTPCall("GET", srv.URL+"/v1/settings", nil, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusOK || resp != wantResp {
+			t.Fatalf("unexpected response %d: \n`%s`\nwant:\n`%s`", code, resp, wantResp)
+		}
+
+		// the saved config isn't changed, so the index isn't rebuilt again
+		updatedIndex = nil
+		buf = bytes.NewBufferString(`{"analyzer":` + config + `}`)
+		if _, code, err = testHTTPCall("PATCH", srv.URL+"/v1/settings", buf, "rafa", "test"); err != nil || code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d, %v", code, err)
+		}
+		if updatedIndex != nil {
+			t.Fatalf("expected the index not to be rebuilt by the same analyzer")
+		}
+	})
+
+	t.Run("update settings with an invalid analyzer config", func(t *testing.T) {
+		buf := bytes.NewBufferString(`{"analyzer":{"name":"code","filters":[{"type":"soundex"}]}}`)
+		_, code, err := testHTTPCall("PATCH", srv.URL+"/v1/settings", buf, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d", code)
+		}
+	})
+
+	t.Run("update settings analyzer isn't saved if reindexing fails", func(t *testing.T) {
+		savedSettings = nil
+		buf := bytes.NewBufferString(`{"analyzer":"german"}`)
+		_, code, err := testHTTPCall("PATCH", srv.URL+"/v1/settings", buf, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusInternalServerError {
+			t.Fatalf("expected status 500, got %d", code)
+		}
+		if savedSettings != nil {
+			t.Fatalf("expected settings not to be saved, got %+v", savedSettings)
+		}
+	})
+
+	t.Run("admin routes require the admin token", func(t *testing.T) {
+		_, code, err := testHTTPCall("POST", srv.URL+"/admin/search/check", nil, "rafa", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusUnauthorized {
+			t.Fatalf("expected status 401, got %d", code)
+		}
+	})
+
+	t.Run("rebuild search index", func(t *testing.T) {
+		updatedIndex = nil
+		resp, code, err := testAdminCall("POST", srv.URL+"/admin/users/42/search/rebuild")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+		wantResp := `{"user_id":42,"indexed":3}`
+		if resp != wantResp {
+			t.Fatalf("unexpected response: \n`%s`\nwant:\n`%s`", resp, wantResp)
+		}
+		if updatedIndex == nil || updatedIndex.Analyzer.Name != "spanish" {
+			t.Fatalf("expected the index to be rebuilt by the analyzer of the user's settings, got %+v", updatedIndex)
+		}
+	})
+
+	t.Run("check search indexes of all users", func(t *testing.T) {
+		resp, code, err := testAdminCall("POST", srv.URL+"/admin/search/check?batch_size=1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+		wantResp := `{"checked":1,"reports":[]}`
+		if resp != wantResp {
+			t.Fatalf("unexpected response: \n`%s`\nwant:\n`%s`", resp, wantResp)
+		}
+	})
+}
+
+func testAdminCall(method, url string) (string, int, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Authorization", "Bearer admin-token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, err
+	}
+	return strings.TrimSpace(string(bodyBytes)), resp.StatusCode, nil
 }
@@ -0,0 +1,196 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"net/http"
+	"todo/search"
+	"todo/task"
+	"todo/view"
+)
+
+func viewMiddleware(viewService *view.Service) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := chi.URLParam(r, "id")
+			v, err := viewService.FindByID(r.Context(), id)
+			switch {
+			case err == nil:
+				break
+			case errors.Is(err, view.ErrNotFound):
+				w.WriteHeader(http.StatusNotFound)
+				return
+			default:
+				zap.S().With("error", err).Error("view middleware failed")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			ctx := context.WithValue(r.Context(), view.ViewContextKey, v)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func getViews(service *view.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		views, err := service.FindAll(r.Context())
+		if err != nil {
+			zap.S().With("error", err).Error("fetch views failed")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		render.JSON(w, r, ListResponse{
+			Total: int64(len(views)),
+			Count: len(views),
+			Limit: len(views),
+			Data:  views,
+		})
+	}
+}
+
+func getView(service *view.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := r.Context().Value(view.ViewContextKey).(*view.View)
+		render.JSON(w, r, v)
+	}
+}
+
+func createView(service *view.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req createViewRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, APIErrorResponse{Error: "invalid request json body"})
+			return
+		}
+
+		newView := view.View{
+			ID:       uuid.New().String(),
+			Name:     req.Name,
+			Query:    req.Query,
+			Filter:   req.Filter,
+			Pinned:   req.Pinned,
+			Position: req.Position,
+		}
+
+		v, err := service.Create(r.Context(), &newView)
+		switch {
+		case err == nil:
+			break
+		case isInvalidViewErr(err):
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, APIErrorResponse{Error: err.Error()})
+			return
+		default:
+			zap.S().With("error", err).Error("create view failed")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		render.JSON(w, r, v)
+	}
+}
+
+func updateView(service *view.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+
+		var req updateViewRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, APIErrorResponse{Error: "invalid request json body"})
+			return
+		}
+
+		v, err := service.Update(r.Context(), &view.UpdateView{
+			ID:       id,
+			Name:     req.Name,
+			Query:    req.Query,
+			Filter:   req.Filter,
+			Pinned:   req.Pinned,
+			Position: req.Position,
+		})
+		switch {
+		case err == nil:
+			break
+		case errors.Is(err, view.ErrNotFound):
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case isInvalidViewErr(err):
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, APIErrorResponse{Error: err.Error()})
+			return
+		default:
+			zap.S().With("error", err).Error("update view failed")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		render.JSON(w, r, v)
+	}
+}
+
+func deleteView(service *view.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		if err := service.Delete(r.Context(), id); err != nil {
+			zap.S().With("error", err).Error("delete view failed")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func getViewTasks(service *view.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := r.Context().Value(view.ViewContextKey).(*view.View)
+		pagination := r.Context().Value(PaginationCtxKey).(Pagination)
+
+		after, err := taskCursor(pagination, v.Filter)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, APIErrorResponse{Error: err.Error()})
+			return
+		}
+
+		tasks, total, err := service.Tasks(r.Context(), v, task.QueryOptions{
+			Limit:  pagination.Limit,
+			Offset: pagination.Offset,
+			After:  after,
+		})
+		var parseErr *search.ParseError
+		if errors.As(err, &parseErr) {
+			// the view was saved before fields of its query were removed from the search schema
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, APIErrorResponse{Error: parseErr.Error(), Position: &parseErr.Pos})
+			return
+		}
+		if err != nil {
+			zap.S().With("error", err).Error("fetch view tasks failed")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		render.JSON(w, r, ListResponse{
+			Total:      total,
+			Offset:     pagination.Offset,
+			Limit:      pagination.Limit,
+			Count:      len(tasks),
+			Data:       tasks,
+			NextCursor: nextTaskCursor(tasks, pagination.Limit, v.Filter),
+		})
+	}
+}
+
+func isInvalidViewErr(err error) bool {
+	var parseErr *search.ParseError
+	return errors.Is(err, view.ErrEmptyName) || errors.Is(err, task.ErrInvalidStatus) || errors.Is(err, task.ErrInvalidSort) ||
+		errors.As(err, &parseErr)
+}
@@ -0,0 +1,30 @@
+package job
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Run calls fn every interval until the context is canceled.
+// Errors are only logged, so a failed run doesn't stop the following ones.
+func Run(ctx context.Context, log *zap.SugaredLogger, name string, interval time.Duration, fn func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			start := time.Now()
+			err := fn(ctx)
+			l := log.With("job", name).With("latency", time.Since(start).Seconds())
+			if err != nil {
+				l.With("error", err).Error("job failed")
+				continue
+			}
+			l.Debug("job finished")
+		}
+	}
+}
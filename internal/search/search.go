@@ -0,0 +1,59 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"os"
+	"todo/search"
+	"todo/task"
+	"todo/user"
+)
+
+// Backends selected by SEARCH_BACKEND, the index backend is used by default.
+const (
+	IndexBackend    = "index"
+	PostgresBackend = "postgres"
+)
+
+var backend = os.Getenv("SEARCH_BACKEND")
+
+// Backend is the search backend of tasks: "index" keeps an inverted index of each user's tasks,
+// "postgres" uses full-text search of PostgreSQL on the tasks table.
+type Backend struct {
+	search.Backend
+	migrate func(ctx context.Context, source search.DocumentSource) error
+}
+
+func New(db *gorm.DB) (*Backend, error) {
+	switch backend {
+	case "", IndexBackend:
+		repo := search.NewSQLRepository(db)
+		return &Backend{
+			Backend: search.NewIndexBackend(repo, task.SearchSchema),
+			migrate: func(ctx context.Context, source search.DocumentSource) error {
+				return repo.Migrate(ctx, source, task.SearchSchema)
+			},
+		}, nil
+	case PostgresBackend:
+		postgres, err := search.NewPostgresBackend(db, "tasks", []string{task.TitleField, task.DescriptionField, task.StatusField}, task.SearchSchema)
+		if err != nil {
+			return nil, err
+		}
+		users := user.NewSQLRepository(db)
+		return &Backend{
+			Backend: postgres,
+			migrate: func(ctx context.Context, source search.DocumentSource) error {
+				return postgres.Migrate(ctx, source, users)
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown search backend %q, available backends: %s, %s", backend, IndexBackend, PostgresBackend)
+	}
+}
+
+// Migrate prepares the storage of the backend: the index backend rebuilds indexes stored in an outdated format,
+// the postgres backend adds search columns to the tasks table and indexes tasks that aren't indexed yet.
+func (b *Backend) Migrate(ctx context.Context, source search.DocumentSource) error {
+	return b.migrate(ctx, source)
+}
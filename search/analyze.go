@@ -1,42 +1,162 @@
 package search
 
 import (
-	snowballeng "github.com/kljensen/snowball/english"
+	"encoding/json"
+	"fmt"
+	"sort"
 	"strings"
 	"unicode"
 )
 
+// DefaultAnalyzer is the name of the analyzer used when no analyzer is chosen.
+const DefaultAnalyzer = "english"
+
+var ErrUnknownAnalyzer = fmt.Errorf("unknown analyzer")
+
+// NewAnalyzer creates an analyzer by name, an empty name means DefaultAnalyzer.
+func NewAnalyzer(name string) (*Analyzer, error) {
+	if name == "" {
+		name = DefaultAnalyzer
+	}
+	config, ok := analyzers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q, available analyzers: %s", ErrUnknownAnalyzer, name, strings.Join(AnalyzerNames(), ", "))
+	}
+	return config.Build()
+}
+
+// builtinAnalyzer creates an available analyzer, configs of available analyzers are valid, so it panics otherwise.
+func builtinAnalyzer(name string) *Analyzer {
+	analyzer, err := NewAnalyzer(name)
+	if err != nil {
+		panic(err)
+	}
+	return analyzer
+}
+
+// AnalyzerNames returns sorted names of the available analyzers.
+func AnalyzerNames() []string {
+	names := make([]string, 0, len(analyzers))
+	for name := range analyzers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Analyzer receives a text and returns a slice of tokens(words) that's used for searching.
 // Input text can be in any language, so the client should choose/provide an appropriate filters.
 type Analyzer struct {
 	Name    string
 	Filters []Filter
+	// Tokenizer splits text into tokens, nil means the standard tokenizer.
+	Tokenizer Tokenizer
+	// Config describes the analyzer, it's nil for analyzers built in code, see MarshalJSON.
+	Config *AnalyzerConfig
 }
 
 func (a *Analyzer) Analyze(text string) []string {
-	tokens := tokenize(text)
+	tokens := a.tokenize(text)
 	for _, filter := range a.Filters {
 		tokens = filter(tokens)
 	}
 	return tokens
 }
 
-// MarshalJSON for simplicity saves only the name of the analyzer.
+// Stage is the output of a step of an analyzer: the tokenizer or a filter.
+type Stage struct {
+	// Kind is "tokenizer" or "filter".
+	Kind   string   `json:"kind"`
+	Name   string   `json:"name"`
+	Tokens []string `json:"tokens"`
+}
+
+// AnalyzeStages works like Analyze, but returns tokens produced by every step of the analyzer, ex: to see
+// why a word isn't found. Steps are named by the config of the analyzer.
+func (a *Analyzer) AnalyzeStages(text string) []Stage {
+	tokenizer := standardTokenizer
+	if a.Config != nil && a.Config.Tokenizer != "" {
+		tokenizer = a.Config.Tokenizer
+	}
+	tokens := append([]string{}, a.tokenize(text)...)
+	stages := []Stage{{Kind: "tokenizer", Name: tokenizer, Tokens: tokens}}
+	for i, filter := range a.Filters {
+		name := fmt.Sprintf("filter %d", i+1)
+		if a.Config != nil && len(a.Config.Filters) == len(a.Filters) {
+			name = a.Config.Filters[i].Type
+		}
+		tokens = append([]string{}, filter(tokens)...)
+		stages = append(stages, Stage{Kind: "filter", Name: name, Tokens: tokens})
+	}
+	return stages
+}
+
+// tokenize splits the text into tokens by the tokenizer of the analyzer.
+func (a *Analyzer) tokenize(text string) []string {
+	if a.Tokenizer == nil {
+		return tokenize(text)
+	}
+	spans := a.Tokenizer(text)
+	tokens := make([]string, len(spans))
+	for i, span := range spans {
+		tokens[i] = span.Token
+	}
+	return tokens
+}
+
+// Span is a token and its location in the original text, Start and End are byte offsets.
+type Span struct {
+	Token string
+	Start int
+	End   int
+}
+
+// AnalyzeSpans works like Analyze, but keeps locations of tokens in the text, so analyzed(ex: stemmed) tokens
+// can be mapped back to the original words. Filters are applied to each word separately.
+func (a *Analyzer) AnalyzeSpans(text string) []Span {
+	tokenizer := a.Tokenizer
+	if tokenizer == nil {
+		tokenizer = tokenizeSpans
+	}
+	var spans []Span
+	for _, span := range tokenizer(text) {
+		tokens := []string{span.Token}
+		for _, filter := range a.Filters {
+			tokens = filter(tokens)
+		}
+		for _, token := range tokens {
+			spans = append(spans, Span{Token: token, Start: span.Start, End: span.End})
+		}
+	}
+	return spans
+}
+
+// MarshalJSON saves the config of the analyzer in full, so a saved index keeps analyzing text the way it was
+// built even if the available analyzer of the same name changes. Analyzers without a config are saved
+// by the config of the available analyzer of their name.
 func (a *Analyzer) MarshalJSON() ([]byte, error) {
-	if a.Name == "" {
-		a.Name = "default_analyzer"
+	config := a.Config
+	if config == nil {
+		available, ok := analyzers[a.Name]
+		if !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownAnalyzer, a.Name)
+		}
+		config = &available
 	}
-	return []byte(a.Name), nil
+	return json.Marshal(config)
 }
 
-// UnmarshalJSON for simplicity rebuilds analyzer from a name.
+// UnmarshalJSON rebuilds the analyzer from a config or from the name of an available analyzer,
+// analyzers were saved by name before configs.
 func (a *Analyzer) UnmarshalJSON(data []byte) error {
-	switch string(data) {
-	case "english_analyzer":
-		a = NewEnglishAnalyzer()
-	default:
-		a = &Analyzer{}
+	if string(data) == "null" {
+		return nil
 	}
+	analyzer, err := ParseAnalyzer(data)
+	if err != nil {
+		return err
+	}
+	*a = *analyzer
 	return nil
 }
 
@@ -45,22 +165,49 @@ type Filter func(tokens []string) []string
 
 // NewEnglishAnalyzer creates an english analyzer to analyze English text.
 func NewEnglishAnalyzer() *Analyzer {
-	return &Analyzer{
-		Name: "english_analyzer",
-		Filters: []Filter{
-			lowercaseFilter,
-			englishStopWordFilter,
-			englishStemmerFilter,
-		},
-	}
+	return builtinAnalyzer("english")
 }
 
 // tokenize splits a string into a slice of tokens(words)
 func tokenize(text string) []string {
-	return strings.FieldsFunc(text, func(r rune) bool {
-		// Split on any character that is not a letter or a number.
-		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
-	})
+	return strings.FieldsFunc(text, isSeparator)
+}
+
+// isSeparator reports whether tokens are split on the character, that's any character that is not a letter or a number.
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// tokenizeSpans splits a string into tokens the same way as tokenize and records their locations.
+func tokenizeSpans(text string) []Span {
+	return splitSpans(text, isSeparator)
+}
+
+// whitespaceSpans splits a string into tokens on white space only, so tokens keep punctuation, ex: e-mail, c++.
+func whitespaceSpans(text string) []Span {
+	return splitSpans(text, unicode.IsSpace)
+}
+
+// splitSpans splits a string into tokens separated by the characters and records their locations.
+func splitSpans(text string, isSeparator func(r rune) bool) []Span {
+	var spans []Span
+	start := -1
+	for i, r := range text {
+		if isSeparator(r) {
+			if start >= 0 {
+				spans = append(spans, Span{Token: text[start:i], Start: start, End: i})
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, Span{Token: text[start:], Start: start, End: len(text)})
+	}
+	return spans
 }
 
 var stopWords = map[string]struct{}{
@@ -70,6 +217,17 @@ var stopWords = map[string]struct{}{
 
 // englishStopWordFilter removes stopWords from a slice of tokens.
 func englishStopWordFilter(tokens []string) []string {
+	return removeStopWords(tokens, stopWords)
+}
+
+// stopWordFilter creates a filter that removes the stop words from a slice of tokens.
+func stopWordFilter(stopWords map[string]struct{}) Filter {
+	return func(tokens []string) []string {
+		return removeStopWords(tokens, stopWords)
+	}
+}
+
+func removeStopWords(tokens []string, stopWords map[string]struct{}) []string {
 	r := make([]string, 0, len(tokens))
 	for _, token := range tokens {
 		if _, ok := stopWords[token]; !ok {
@@ -79,15 +237,6 @@ func englishStopWordFilter(tokens []string) []string {
 	return r
 }
 
-// englishStemmerFilter stems english words. Ex: dogs -> dog, jumping -> jump
-func englishStemmerFilter(tokens []string) []string {
-	r := make([]string, len(tokens))
-	for i, token := range tokens {
-		r[i] = snowballeng.Stem(token, false)
-	}
-	return r
-}
-
 func lowercaseFilter(tokens []string) []string {
 	r := make([]string, len(tokens))
 	for i, token := range tokens {
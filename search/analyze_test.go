@@ -1,6 +1,8 @@
 package search
 
 import (
+	"encoding/json"
+	"errors"
 	"reflect"
 	"testing"
 )
@@ -87,6 +89,36 @@ func TestAnalyzer_Analyze(t *testing.T) {
 			text:     "Did I hear it right? Did the quick brown fox jump over the lazy dog?",
 			want:     []string{"did", "hear", "it", "right", "did", "quick", "brown", "fox", "jump", "over", "lazi", "dog"},
 		},
+		{
+			name:     "russian analyzer",
+			Analyzer: NewRussianAnalyzer(),
+			text:     "Подготовить отчёты по задачам и отправить отчет",
+			want:     []string{"подготов", "отчет", "задач", "отправ", "отчет"},
+		},
+		{
+			name:     "german analyzer",
+			Analyzer: NewGermanAnalyzer(),
+			text:     "Die Rechnungen für den Kunden prüfen",
+			want:     []string{"rechnung", "kund", "pruf"},
+		},
+		{
+			name:     "french analyzer",
+			Analyzer: NewFrenchAnalyzer(),
+			text:     "Préparer les rapports de l'équipe",
+			want:     []string{"prépar", "rapport", "équip"},
+		},
+		{
+			name:     "spanish analyzer",
+			Analyzer: NewSpanishAnalyzer(),
+			text:     "Preparar los informes para el cliente",
+			want:     []string{"prepar", "inform", "client"},
+		},
+		{
+			name:     "standard analyzer",
+			Analyzer: NewStandardAnalyzer(),
+			text:     "Ship the Release notes",
+			want:     []string{"ship", "the", "release", "notes"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -97,3 +129,80 @@ func TestAnalyzer_Analyze(t *testing.T) {
 		})
 	}
 }
+
+func TestAnalyzer_AnalyzeSpans(t *testing.T) {
+	text := "Did the Quick brown fox jump over the lazy dogs? Ёжики!"
+	analyzer := NewEnglishAnalyzer()
+	spans := analyzer.AnalyzeSpans(text)
+
+	tokens := make([]string, len(spans))
+	for i, span := range spans {
+		tokens[i] = span.Token
+	}
+	if want := analyzer.Analyze(text); !reflect.DeepEqual(tokens, want) {
+		t.Errorf("AnalyzeSpans() tokens = %v, want %v", tokens, want)
+	}
+
+	want := map[string]string{"quick": "Quick", "jump": "jump", "lazi": "lazy", "dog": "dogs", "ёжики": "Ёжики"}
+	for _, span := range spans {
+		if word, ok := want[span.Token]; ok && text[span.Start:span.End] != word {
+			t.Errorf("AnalyzeSpans() span of %q = %q, want %q", span.Token, text[span.Start:span.End], word)
+		}
+	}
+}
+
+func Test_germanStem(t *testing.T) {
+	tests := map[string]string{
+		"häuser":               "haus",
+		"büchern":              "buch",
+		"rechnungen":           "rechnung",
+		"aufeinanderfolgenden": "aufeinanderfolg",
+		"möglichkeiten":        "moglich",
+		"abenteuerlich":        "abenteu",
+		"schließen":            "schliess",
+		"verständnisse":        "verstandnis",
+		// R2 follows the unadjusted R1 when a vowel and a consonant start the word
+		"abendlich": "abend",
+		"unendlich": "unend",
+		"adelig":    "adel",
+		"ebenheit":  "eben",
+		"abhängig":  "abhang",
+	}
+	for word, want := range tests {
+		if got := germanStem(word, false); got != want {
+			t.Errorf("germanStem(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+func TestAnalyzer_JSON(t *testing.T) {
+	for _, name := range AnalyzerNames() {
+		t.Run(name, func(t *testing.T) {
+			analyzer, err := NewAnalyzer(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.Marshal(analyzer)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got *Analyzer
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			text := "Подготовить отчёты, prüfen Rechnungen and preparing reports"
+			if got.Name != name || !reflect.DeepEqual(got.Analyze(text), analyzer.Analyze(text)) {
+				t.Errorf("analyzer %q was restored as %q", name, got.Name)
+			}
+		})
+	}
+
+	var got *Analyzer
+	if err := json.Unmarshal([]byte("null"), &got); err != nil || got != nil {
+		t.Errorf("Unmarshal(null) = %v, %v, want nil analyzer", got, err)
+	}
+	if err := json.Unmarshal([]byte(`"klingon"`), &got); !errors.Is(err, ErrUnknownAnalyzer) {
+		t.Errorf("Unmarshal(unknown analyzer) error = %v, want %v", err, ErrUnknownAnalyzer)
+	}
+}
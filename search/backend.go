@@ -0,0 +1,327 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"todo/user"
+)
+
+// maxConflictRetries is the number of times a write of a user index is retried after ErrConflict.
+const maxConflictRetries = 3
+
+// Backend stores and searches documents of users, the user is taken from the context.
+// IndexBackend keeps an inverted index of each user, PostgresBackend uses full-text search of PostgreSQL.
+type Backend interface {
+	// Search returns documents that match the query, the most relevant documents go first.
+	// Synonyms aren't analyzed, they map lower cased words to their synonyms.
+	Search(ctx context.Context, query Query, synonyms Synonyms) ([]Hit, error)
+	// Suggest returns completions of the last word of the prefix drawn from the user's documents.
+	Suggest(ctx context.Context, prefix string, limit int) ([]Suggestion, error)
+	// Insert adds documents, documents that are indexed already are replaced.
+	Insert(ctx context.Context, documents ...Document) error
+	Delete(ctx context.Context, document Document) error
+	// Rebuild replaces all documents of the user with the documents analyzed by the analyzer.
+	// A nil analyzer keeps the current analyzer of the user's documents.
+	Rebuild(ctx context.Context, analyzer *Analyzer, documents ...Document) error
+	// DocumentIDs returns sorted IDs of the user's indexed documents.
+	DocumentIDs(ctx context.Context) ([]string, error)
+	// Terms returns the dictionary of words of the user's documents that match the filter, stop words are skipped.
+	Terms(ctx context.Context, filter TermFilter) (Terms, error)
+	// Related returns up to limit of the user's documents most similar to the document by cosine similarity
+	// of TF-IDF vectors of their tokens, scores are from 0 to 1. The document itself is skipped.
+	Related(ctx context.Context, document Document, limit int) ([]Hit, error)
+}
+
+// IndexBackend is a backend that stores an inverted index of each user's documents in a UserIndexRepository.
+// Only parts of the index that are needed are loaded, ex: postings of tokens of a query.
+type IndexBackend struct {
+	Repo   UserIndexRepository
+	Schema Schema
+}
+
+func NewIndexBackend(repo UserIndexRepository, schema Schema) *IndexBackend {
+	return &IndexBackend{
+		Repo:   repo,
+		Schema: schema,
+	}
+}
+
+func (b *IndexBackend) Search(ctx context.Context, query Query, synonyms Synonyms) ([]Hit, error) {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	userIndex, err := b.findOrCreate(ctx, usr)
+	if err != nil {
+		return nil, err
+	}
+	userIndex.Synonyms = synonyms
+	if err := b.load(ctx, userIndex, query); err != nil {
+		return nil, err
+	}
+	return userIndex.Search(query), nil
+}
+
+// load loads postings of tokens of the query and lengths of documents in them. Terms are loaded only if the query
+// has fuzzy terms, then only words of lengths that may be similar to them. Lengths of all documents are loaded
+// only if the query has negated clauses or the repository keeps no stats of the index.
+func (b *IndexBackend) load(ctx context.Context, userIndex *UserIndex, query Query) error {
+	if minLength, maxLength, ok := fuzzyLengths(query, userIndex.Analyzer); ok {
+		terms, err := b.Repo.FindTerms(ctx, userIndex.UserID, TermFilter{MinLength: minLength, MaxLength: maxLength})
+		if err != nil {
+			return fmt.Errorf("failed to find user index terms: %w", err)
+		}
+		userIndex.Terms = terms
+	}
+
+	postings, err := b.Repo.FindPostings(ctx, userIndex.UserID, distinct(queryTokens(query, userIndex, true)))
+	if err != nil {
+		return fmt.Errorf("failed to find user index postings: %w", err)
+	}
+	userIndex.Index = postings
+
+	var docIDs []string
+	if userIndex.Stats != nil && !negated(query) {
+		docIDs = postings.documentIDs()
+		if len(docIDs) == 0 {
+			userIndex.DocLengths = map[string]map[string]int{}
+			return nil
+		}
+	}
+	docLengths, err := b.Repo.FindDocLengths(ctx, userIndex.UserID, docIDs)
+	if err != nil {
+		return fmt.Errorf("failed to find user index documents: %w", err)
+	}
+	userIndex.DocLengths = docLengths
+	return nil
+}
+
+func (b *IndexBackend) Suggest(ctx context.Context, prefix string, limit int) ([]Suggestion, error) {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	_, last, ok := completedWord(prefix)
+	if !ok {
+		return []Suggestion{}, nil
+	}
+	userIndex, err := b.Repo.Find(ctx, usr.ID)
+	if err == ErrNotFound {
+		return []Suggestion{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user index: %w", err)
+	}
+	terms, err := b.Repo.FindTerms(ctx, usr.ID, TermFilter{Prefix: last})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user index terms: %w", err)
+	}
+	userIndex.Terms = terms
+	userIndex.Schema = b.Schema
+	return userIndex.Suggest(prefix, limit), nil
+}
+
+// Insert indexes the documents separately and adds their postings to the user's index.
+// Documents are analyzed again if the analyzer of the index was changed concurrently.
+func (b *IndexBackend) Insert(ctx context.Context, documents ...Document) error {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	for attempt := 0; ; attempt++ {
+		userIndex, err := b.findOrCreate(ctx, usr)
+		if err != nil {
+			return err
+		}
+		err = b.Repo.Insert(ctx, b.build(userIndex, documents))
+		if errors.Is(err, ErrConflict) && attempt < maxConflictRetries {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update user index: %w", err)
+		}
+		return nil
+	}
+}
+
+func (b *IndexBackend) Delete(ctx context.Context, document Document) error {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	err := b.Repo.Delete(ctx, usr.ID, document.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update user index: %w", err)
+	}
+	return nil
+}
+
+func (b *IndexBackend) Rebuild(ctx context.Context, analyzer *Analyzer, documents ...Document) error {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	userIndex, err := b.findOrCreate(ctx, usr)
+	if err != nil {
+		return err
+	}
+	if analyzer != nil {
+		userIndex.Analyzer = analyzer
+	}
+	err = b.Repo.Update(ctx, b.build(userIndex, documents))
+	if err != nil {
+		return fmt.Errorf("failed to update user index: %w", err)
+	}
+	return nil
+}
+
+func (b *IndexBackend) DocumentIDs(ctx context.Context) ([]string, error) {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	docLengths, err := b.Repo.FindDocLengths(ctx, usr.ID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user index documents: %w", err)
+	}
+	userIndex := &UserIndex{UserID: usr.ID, DocLengths: docLengths}
+	return userIndex.DocumentIDs(), nil
+}
+
+func (b *IndexBackend) Terms(ctx context.Context, filter TermFilter) (Terms, error) {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	terms, err := b.Repo.FindTerms(ctx, usr.ID, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user index terms: %w", err)
+	}
+	return terms, nil
+}
+
+// Related analyzes the document and compares it with relatedCandidates documents that share the most
+// weighted tokens with it, whole vectors are loaded only for these candidates.
+func (b *IndexBackend) Related(ctx context.Context, document Document, limit int) ([]Hit, error) {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	userIndex, err := b.Repo.Find(ctx, usr.ID)
+	if err == ErrNotFound {
+		return []Hit{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user index: %w", err)
+	}
+	if userIndex.Analyzer == nil {
+		userIndex.Analyzer = NewEnglishAnalyzer()
+	}
+	vector := b.build(userIndex, []Document{document}).vectors()[document.ID]
+	if len(vector) == 0 {
+		return []Hit{}, nil
+	}
+
+	n := userIndex.docCount()
+	if userIndex.Stats == nil {
+		docLengths, err := b.Repo.FindDocLengths(ctx, usr.ID, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find user index documents: %w", err)
+		}
+		n = len(docLengths)
+	}
+	tokens := make([]string, 0, len(vector))
+	for token := range vector {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+	postings, err := b.Repo.FindPostings(ctx, usr.ID, tokens)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user index postings: %w", err)
+	}
+	userIndex.Index = postings
+	userIndex.Schema = b.Schema
+
+	// choose candidates by tokens of the document, then load the rest of their tokens
+	partial := userIndex.vectors()
+	df := frequencies(partial)
+	delete(partial, document.ID)
+	dots := make(map[string]float64, len(partial))
+	for id, candidate := range partial {
+		for token, tf := range candidate {
+			idf := inverseFrequency(n, df[token])
+			dots[id] += tf * vector[token] * idf * idf
+		}
+	}
+	ids := closest(dots, relatedCandidates)
+	if len(ids) == 0 {
+		return []Hit{}, nil
+	}
+	docTokens, err := b.Repo.FindDocTokens(ctx, usr.ID, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find tokens of user index documents: %w", err)
+	}
+	var rest []string
+	for _, id := range ids {
+		for _, token := range docTokens[id] {
+			if _, ok := postings[token]; !ok {
+				postings[token] = nil
+				rest = append(rest, token)
+			}
+		}
+	}
+	if len(rest) > 0 {
+		restPostings, err := b.Repo.FindPostings(ctx, usr.ID, rest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find user index postings: %w", err)
+		}
+		for token, tokenPostings := range restPostings {
+			postings[token] = tokenPostings
+		}
+	}
+
+	vectors := userIndex.vectors()
+	candidates := make(map[string]termVector, len(ids))
+	for _, id := range ids {
+		candidates[id] = vectors[id]
+	}
+	return similar(vector, candidates, frequencies(vectors), n, limit), nil
+}
+
+// build returns an index of the documents analyzed by the analyzer of the user's index.
+func (b *IndexBackend) build(userIndex *UserIndex, documents []Document) *UserIndex {
+	built := &UserIndex{
+		UserID:     userIndex.UserID,
+		Index:      Index{},
+		DocLengths: map[string]map[string]int{},
+		Analyzer:   userIndex.Analyzer,
+		Schema:     b.Schema,
+	}
+	for _, document := range documents {
+		built.Insert(document)
+	}
+	return built
+}
+
+// findOrCreate returns the user's index without documents, an empty index is created if the user has none yet.
+func (b *IndexBackend) findOrCreate(ctx context.Context, usr user.User) (*UserIndex, error) {
+	userIndex, err := b.Repo.Find(ctx, usr.ID)
+	if err == ErrNotFound {
+		userIndex = &UserIndex{UserID: usr.ID, Index: Index{}, DocLengths: map[string]map[string]int{}, Analyzer: userAnalyzer(usr)}
+		err = b.Repo.Create(ctx, userIndex)
+		if errors.Is(err, ErrConflict) {
+			// the index was created by a concurrent request
+			userIndex, err = b.Repo.Find(ctx, usr.ID)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user index: %w", err)
+	}
+	if userIndex.Analyzer == nil {
+		userIndex.Analyzer = NewEnglishAnalyzer()
+	}
+	userIndex.Schema = b.Schema
+	return userIndex, nil
+}
+
+// userAnalyzer returns the analyzer of the config stored in the user's settings.
+func userAnalyzer(usr user.User) *Analyzer {
+	if len(usr.Settings.Analyzer) == 0 {
+		return NewEnglishAnalyzer()
+	}
+	analyzer, err := ParseAnalyzer(usr.Settings.Analyzer)
+	if err != nil {
+		// settings are validated, so it's an analyzer or a filter that was removed
+		return NewEnglishAnalyzer()
+	}
+	return analyzer
+}
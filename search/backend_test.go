@@ -0,0 +1,520 @@
+package search
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"todo/user"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+var backendSchema = Schema{
+	"title":  {Boost: 2},
+	"status": {Scoped: true},
+}
+
+var backendDocuments = []Document{
+	backendDocument("1", "Release notes", "Write the notes for the next release", "created"),
+	backendDocument("2", "Fix login bug", "Users can't log in with email", "finished"),
+	backendDocument("3", "Plan meetings", "Schedule the weekly team meeting", "created"),
+	backendDocument("4", "Write documentation", "Document the release process", "finished"),
+}
+
+func backendDocument(id, title, description, status string) Document {
+	return Document{ID: id, Fields: []Field{
+		{Name: "title", Text: title},
+		{Name: "description", Text: description},
+		{Name: "status", Text: status},
+	}}
+}
+
+func TestIndexBackend(t *testing.T) {
+	testBackend(t, func(t *testing.T) Backend {
+		return NewIndexBackend(memoryRepository{}, backendSchema)
+	})
+}
+
+// memoryRepository keeps indexes in memory, it stores them by documents like SQLRepository.
+type memoryRepository map[uint]*UserIndex
+
+func (m memoryRepository) Find(ctx context.Context, userID uint) (*UserIndex, error) {
+	idx, ok := m[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &UserIndex{UserID: userID, Index: Index{}, DocLengths: map[string]map[string]int{}, Stats: newIndexStats(idx.DocLengths), Analyzer: idx.Analyzer}, nil
+}
+
+func (m memoryRepository) FindDocLengths(ctx context.Context, userID uint, docIDs []string) (map[string]map[string]int, error) {
+	docLengths := map[string]map[string]int{}
+	if idx, ok := m[userID]; ok {
+		for id, lengths := range idx.DocLengths {
+			docLengths[id] = lengths
+		}
+	}
+	if docIDs != nil {
+		found := make(map[string]map[string]int, len(docIDs))
+		for _, id := range docIDs {
+			if lengths, ok := docLengths[id]; ok {
+				found[id] = lengths
+			}
+		}
+		docLengths = found
+	}
+	return docLengths, nil
+}
+
+func (m memoryRepository) FindPostings(ctx context.Context, userID uint, tokens []string) (Index, error) {
+	postings := Index{}
+	if idx, ok := m[userID]; ok {
+		for _, token := range tokens {
+			if tokenPostings, ok := idx.Index[token]; ok {
+				postings[token] = append([]Posting(nil), tokenPostings...)
+			}
+		}
+	}
+	return postings, nil
+}
+
+func (m memoryRepository) FindTerms(ctx context.Context, userID uint, filter TermFilter) (Terms, error) {
+	var terms Terms
+	if idx, ok := m[userID]; ok {
+		for _, term := range idx.Terms.WithPrefix(filter.Prefix) {
+			length := len([]rune(term.Word))
+			if filter.MinLength > 0 && length < filter.MinLength || filter.MaxLength > 0 && length > filter.MaxLength {
+				continue
+			}
+			terms = append(terms, Term{Word: term.Word, DocIDs: append([]string(nil), term.DocIDs...)})
+		}
+	}
+	return terms, nil
+}
+
+func (m memoryRepository) FindDocTokens(ctx context.Context, userID uint, docIDs []string) (map[string][]string, error) {
+	docTokens := map[string][]string{}
+	if idx, ok := m[userID]; ok {
+		for _, id := range docIDs {
+			for token, postings := range idx.Index {
+				for _, posting := range postings {
+					if posting.DocID == id {
+						docTokens[id] = append(docTokens[id], token)
+						break
+					}
+				}
+			}
+			sort.Strings(docTokens[id])
+		}
+	}
+	return docTokens, nil
+}
+
+func (m memoryRepository) Create(ctx context.Context, userIndex *UserIndex) error {
+	m[userIndex.UserID] = &UserIndex{UserID: userIndex.UserID, Index: Index{}, DocLengths: map[string]map[string]int{}, Analyzer: userIndex.Analyzer}
+	return m.Insert(ctx, userIndex)
+}
+
+func (m memoryRepository) Update(ctx context.Context, userIndex *UserIndex) error {
+	return m.Create(ctx, userIndex)
+}
+
+func (m memoryRepository) Insert(ctx context.Context, userIndex *UserIndex) error {
+	idx := m[userIndex.UserID]
+	for id := range userIndex.DocLengths {
+		idx.purge(id)
+	}
+	for token, postings := range userIndex.Index {
+		idx.Index[token] = append(idx.Index[token], postings...)
+	}
+	for id, lengths := range userIndex.DocLengths {
+		idx.DocLengths[id] = lengths
+	}
+	for _, term := range userIndex.Terms {
+		for _, id := range term.DocIDs {
+			idx.Terms.add(term.Word, id)
+		}
+	}
+	return nil
+}
+
+func (m memoryRepository) Delete(ctx context.Context, userID uint, docIDs ...string) error {
+	if idx, ok := m[userID]; ok {
+		for _, id := range docIDs {
+			idx.purge(id)
+			delete(idx.DocLengths, id)
+		}
+	}
+	return nil
+}
+
+// TestPostgresBackend runs the suite against a PostgreSQL database set by TEST_POSTGRES_DSN,
+// documents are stored in a scratch table.
+func TestPostgresBackend(t *testing.T) {
+	db := testDB(t)
+	if err := db.Exec("DROP TABLE IF EXISTS search_backend_test").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("CREATE TABLE search_backend_test (id text PRIMARY KEY, user_id bigint NOT NULL)").Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DROP TABLE search_backend_test")
+	})
+
+	testBackend(t, func(t *testing.T) Backend {
+		backend, err := NewPostgresBackend(db, "search_backend_test", []string{"title", "description", "status"}, backendSchema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Exec("DELETE FROM search_backend_test").Error; err != nil {
+			t.Fatal(err)
+		}
+		for _, document := range backendDocuments {
+			if err := db.Exec("INSERT INTO search_backend_test (id, user_id) VALUES (?, ?)", document.ID, 1).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+		noDocuments := func(ctx context.Context, userID uint) ([]Document, error) {
+			return nil, nil
+		}
+		if err := backend.Migrate(context.Background(), noDocuments, noUsers); err != nil {
+			t.Fatal(err)
+		}
+		return backend
+	})
+}
+
+// noUsers is a user repository without users, users of indexed documents get the default settings.
+var noUsers = user.MockRepository{
+	FindByIDFn: func(ctx context.Context, id uint) (*user.User, error) {
+		return nil, user.ErrNotFound
+	},
+}
+
+// TestPostgresBackend_Migrate checks that rows indexed by Migrate are analyzed by the analyzer
+// of the user's settings.
+func TestPostgresBackend_Migrate(t *testing.T) {
+	db := testDB(t)
+	if err := db.Exec("DROP TABLE IF EXISTS search_migrate_test").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("CREATE TABLE search_migrate_test (id text PRIMARY KEY, user_id bigint NOT NULL)").Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DROP TABLE search_migrate_test")
+	})
+	for _, document := range backendDocuments {
+		if err := db.Exec("INSERT INTO search_migrate_test (id, user_id) VALUES (?, ?)", document.ID, 2).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backend, err := NewPostgresBackend(db, "search_migrate_test", []string{"title", "description", "status"}, backendSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documents := func(ctx context.Context, userID uint) ([]Document, error) {
+		return backendDocuments, nil
+	}
+	users := user.MockRepository{
+		FindByIDFn: func(ctx context.Context, id uint) (*user.User, error) {
+			return &user.User{ID: id, Settings: user.Settings{Analyzer: user.Analyzer(`"german"`)}}, nil
+		},
+	}
+	if err := backend.Migrate(context.Background(), documents, users); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	var analyzers []string
+	if err := db.Table("search_migrate_test").Distinct("search_analyzer").Pluck("search_analyzer", &analyzers).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(analyzers, []string{"german"}) {
+		t.Errorf("Migrate() indexed rows by analyzers %v, want the german analyzer of the user's settings", analyzers)
+	}
+}
+
+// testDB connects to the database set by TEST_POSTGRES_DSN, the test is skipped if it isn't set.
+func testDB(t *testing.T) *gorm.DB {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN isn't set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+	return db
+}
+
+// testBackend is the search test suite that every backend passes, newBackend returns an empty backend
+// that can store backendDocuments.
+func testBackend(t *testing.T, newBackend func(t *testing.T) Backend) {
+	ctx := context.WithValue(context.Background(), user.UserContextKey, user.User{ID: 1})
+	setup := func(t *testing.T) Backend {
+		backend := newBackend(t)
+		if err := backend.Insert(ctx, backendDocuments...); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+		return backend
+	}
+	search := func(t *testing.T, backend Backend, query string, synonyms Synonyms) []string {
+		q, err := ParseQuery(query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) error = %v", query, err)
+		}
+		hits, err := backend.Search(ctx, q, synonyms)
+		if err != nil {
+			t.Fatalf("Search(%q) error = %v", query, err)
+		}
+		return IDs(hits)
+	}
+
+	t.Run("search", func(t *testing.T) {
+		backend := setup(t)
+		tests := []struct {
+			query    string
+			synonyms Synonyms
+			want     []string
+		}{
+			{query: "meeting", want: []string{"3"}},
+			{query: "release AND process", want: []string{"4"}},
+			{query: "login OR meetings", want: []string{"2", "3"}},
+			{query: "release -notes", want: []string{"4"}},
+			{query: `"release notes"`, want: []string{"1"}},
+			{query: "title:release", want: []string{"1"}},
+			{query: "finished", want: []string{}},
+			{query: "status:finished", want: []string{"2", "4"}},
+			{query: "the", want: []string{}},
+			{query: "defect", synonyms: NewSynonyms([]*SynonymSet{{Rule: "bug, defect"}}), want: []string{"2"}},
+		}
+		for _, tt := range tests {
+			got := search(t, backend, tt.query, tt.synonyms)
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("title matches rank higher", func(t *testing.T) {
+		backend := setup(t)
+		if got, want := search(t, backend, "release", nil), []string{"1", "4"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Search() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("update and delete", func(t *testing.T) {
+		backend := setup(t)
+		if err := backend.Delete(ctx, backendDocuments[0]); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		if err := backend.Delete(ctx, backendDocuments[1]); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		if err := backend.Insert(ctx, backendDocument("2", "Fix signup bug", "Signup form fails", "created")); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+		for query, want := range map[string][]string{"release": {"4"}, "login": {}, "signup": {"2"}} {
+			if got := search(t, backend, query, nil); !reflect.DeepEqual(got, want) {
+				t.Errorf("Search(%q) = %v, want %v", query, got, want)
+			}
+		}
+		ids, err := backend.DocumentIDs(ctx)
+		if err != nil {
+			t.Fatalf("DocumentIDs() error = %v", err)
+		}
+		if want := []string{"2", "3", "4"}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("DocumentIDs() = %v, want %v", ids, want)
+		}
+	})
+
+	t.Run("rebuild", func(t *testing.T) {
+		backend := setup(t)
+		if err := backend.Rebuild(ctx, NewStandardAnalyzer(), backendDocuments[2]); err != nil {
+			t.Fatalf("Rebuild() error = %v", err)
+		}
+		for query, want := range map[string][]string{"meeting": {"3"}, "meet": {}, "release": {}} {
+			if got := search(t, backend, query, nil); !reflect.DeepEqual(got, want) {
+				t.Errorf("Search(%q) = %v, want %v", query, got, want)
+			}
+		}
+		ids, err := backend.DocumentIDs(ctx)
+		if err != nil {
+			t.Fatalf("DocumentIDs() error = %v", err)
+		}
+		if want := []string{"3"}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("DocumentIDs() = %v, want %v", ids, want)
+		}
+	})
+
+	t.Run("terms", func(t *testing.T) {
+		backend := setup(t)
+		tests := []struct {
+			filter TermFilter
+			want   Terms
+		}{
+			{filter: TermFilter{Prefix: "rel"}, want: Terms{{Word: "release", DocIDs: []string{"1", "4"}}}},
+			{filter: TermFilter{Prefix: "th"}, want: Terms{}},
+			{filter: TermFilter{MinLength: 8, MaxLength: 8}, want: Terms{{Word: "document", DocIDs: []string{"4"}}, {Word: "meetings", DocIDs: []string{"3"}}, {Word: "schedule", DocIDs: []string{"3"}}}},
+		}
+		for _, tt := range tests {
+			got, err := backend.Terms(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("Terms(%+v) error = %v", tt.filter, err)
+			}
+			if len(got) == 0 && len(tt.want) == 0 {
+				continue
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Terms(%+v) = %v, want %v", tt.filter, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("related", func(t *testing.T) {
+		backend := setup(t)
+		tests := []struct {
+			name     string
+			document Document
+			limit    int
+			want     []string
+		}{
+			{name: "indexed document", document: backendDocuments[0], limit: 5, want: []string{"4"}},
+			{name: "new document", document: backendDocument("9", "Release notes draft", "Write the notes for the next release", "created"), limit: 5, want: []string{"1", "4"}},
+			{name: "limit", document: backendDocument("9", "Release notes draft", "Write the notes for the next release", "created"), limit: 1, want: []string{"1"}},
+			{name: "scoped fields are skipped", document: backendDocument("9", "Buy milk", "", "finished"), limit: 5, want: []string{}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				hits, err := backend.Related(ctx, tt.document, tt.limit)
+				if err != nil {
+					t.Fatalf("Related() error = %v", err)
+				}
+				if got := IDs(hits); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Related() = %v, want %v", got, tt.want)
+				}
+				for _, hit := range hits {
+					if hit.Score <= 0 || hit.Score > 1 {
+						t.Errorf("Related() score of %s = %v, want from 0 to 1", hit.ID, hit.Score)
+					}
+				}
+			})
+		}
+
+		// a copy of a document is the most similar to it
+		hits, err := backend.Related(ctx, backendDocument("9", "Plan meetings", "Schedule the weekly team meeting", "finished"), 1)
+		if err != nil {
+			t.Fatalf("Related() error = %v", err)
+		}
+		if len(hits) != 1 || hits[0].ID != "3" || hits[0].Score < 0.999 {
+			t.Errorf("Related() = %v, want document 3 with score 1", hits)
+		}
+	})
+
+	t.Run("suggest", func(t *testing.T) {
+		backend := setup(t)
+		tests := []struct {
+			prefix string
+			want   []Suggestion
+		}{
+			{prefix: "next rel", want: []Suggestion{{Text: "next release", Kind: TermSuggestion, DocCount: 2}}},
+			{prefix: "th", want: []Suggestion{}},
+			{prefix: "fin", want: []Suggestion{}},
+		}
+		for _, tt := range tests {
+			got, err := backend.Suggest(ctx, tt.prefix, 5)
+			if err != nil {
+				t.Fatalf("Suggest(%q) error = %v", tt.prefix, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Suggest(%q) = %v, want %v", tt.prefix, got, tt.want)
+			}
+		}
+	})
+}
+
+func TestIndexBackend_Search_fuzzy(t *testing.T) {
+	ctx := context.WithValue(context.Background(), user.UserContextKey, user.User{ID: 1})
+	backend := NewIndexBackend(memoryRepository{}, backendSchema)
+	if err := backend.Insert(ctx, backendDocuments...); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	// negated terms are exact unless fuzziness is given
+	for query, want := range map[string][]string{"meetng": {"3"}, "documentaton OR -relase": {"1", "2", "3", "4"}, "documentaton OR -relase~1": {"2", "3", "4"}} {
+		q, err := ParseQuery(query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) error = %v", query, err)
+		}
+		hits, err := backend.Search(ctx, q, nil)
+		if err != nil {
+			t.Fatalf("Search(%q) error = %v", query, err)
+		}
+		got := IDs(hits)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Search(%q) = %v, want %v", query, got, want)
+		}
+	}
+}
+
+// TestIndexBackend_Search_lengths checks that a search loads lengths of only the documents in postings of the query,
+// but scores documents as an index with lengths of all documents.
+func TestIndexBackend_Search_lengths(t *testing.T) {
+	ctx := context.WithValue(context.Background(), user.UserContextKey, user.User{ID: 1})
+	repo := memoryRepository{}
+	if err := NewIndexBackend(repo, backendSchema).Insert(ctx, backendDocuments...); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	var loaded []string
+	calls := 0
+	backend := NewIndexBackend(MockUserIndexRepository{
+		FindFn:         repo.Find,
+		FindPostingsFn: repo.FindPostings,
+		FindTermsFn:    repo.FindTerms,
+		FindDocLengthsFn: func(ctx context.Context, userID uint, docIDs []string) (map[string]map[string]int, error) {
+			calls++
+			loaded = docIDs
+			return repo.FindDocLengths(ctx, userID, docIDs)
+		},
+	}, backendSchema)
+	full := &UserIndex{UserID: 1, Index: Index{}, Analyzer: NewEnglishAnalyzer(), Schema: backendSchema}
+	for _, document := range backendDocuments {
+		full.Insert(document)
+	}
+
+	tests := []struct {
+		query      string
+		wantCalls  int
+		wantLoaded []string
+	}{
+		{query: "release", wantCalls: 1, wantLoaded: []string{"1", "4"}},
+		{query: `"weekly team" OR meetings`, wantCalls: 1, wantLoaded: []string{"3"}},
+		// negated clauses match documents without their tokens, so lengths of all documents are loaded
+		{query: "bug OR -login", wantCalls: 1, wantLoaded: nil},
+		{query: "unknown", wantCalls: 0, wantLoaded: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			loaded, calls = nil, 0
+			q, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := backend.Search(ctx, q, nil)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			if calls != tt.wantCalls || !reflect.DeepEqual(loaded, tt.wantLoaded) {
+				t.Errorf("Search() loaded lengths of %v in %d calls, want %v in %d", loaded, calls, tt.wantLoaded, tt.wantCalls)
+			}
+			if want := full.Search(q); !reflect.DeepEqual(got, want) {
+				t.Errorf("Search() = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,308 @@
+package search
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// codecVersion is the version of the binary encoding of index rows, every encoded value starts with it.
+// Values of unknown versions aren't decoded, so an older build doesn't misread an index written by a newer one.
+const codecVersion = 1
+
+var errCorrupted = errors.New("corrupted index data")
+
+// ordinalPosting is a posting that refers to its document by the ordinal of the document in the user's index,
+// ordinals are mapped to document IDs by rows of SQLIndexedDocument.
+type ordinalPosting struct {
+	Ordinal   uint32
+	Field     string
+	TF        int
+	Positions []int
+}
+
+// encodePostings encodes a posting list of a token, it sorts the postings by ordinal and field.
+//
+//	version | fields: count, names | postings: count, (ordinal delta, field number, tf, positions: count, deltas)...
+//
+// Fields are few, so postings refer to them by their numbers in the list of fields.
+func encodePostings(postings []ordinalPosting) []byte {
+	sort.Slice(postings, func(i, j int) bool {
+		a, b := postings[i], postings[j]
+		if a.Ordinal != b.Ordinal {
+			return a.Ordinal < b.Ordinal
+		}
+		return a.Field < b.Field
+	})
+	fields := map[string]uint64{}
+	var names []string
+	for _, posting := range postings {
+		if _, ok := fields[posting.Field]; !ok {
+			fields[posting.Field] = 0
+			names = append(names, posting.Field)
+		}
+	}
+	sort.Strings(names)
+
+	e := newEncoder(8 * len(postings))
+	e.uint(uint64(len(names)))
+	for i, name := range names {
+		fields[name] = uint64(i)
+		e.string(name)
+	}
+	e.uint(uint64(len(postings)))
+	var ordinal uint32
+	for _, posting := range postings {
+		e.uint(uint64(posting.Ordinal - ordinal))
+		ordinal = posting.Ordinal
+		e.uint(fields[posting.Field])
+		e.uint(uint64(posting.TF))
+		e.deltas(posting.Positions)
+	}
+	return e.buf
+}
+
+func decodePostings(data []byte) ([]ordinalPosting, error) {
+	d, err := newDecoder(data)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, d.count())
+	for i := range names {
+		names[i] = d.string()
+	}
+	postings := make([]ordinalPosting, d.count())
+	var ordinal uint64
+	for i := range postings {
+		ordinal += d.uint()
+		field := d.uint()
+		if d.err == nil && (field >= uint64(len(names)) || ordinal > 1<<32-1) {
+			return nil, errCorrupted
+		}
+		postings[i] = ordinalPosting{Ordinal: uint32(ordinal), TF: int(d.uint()), Positions: d.deltas()}
+		if d.err == nil {
+			postings[i].Field = names[field]
+		}
+	}
+	if err := d.end(); err != nil {
+		return nil, err
+	}
+	return postings, nil
+}
+
+// encodeOrdinals encodes ordinals of documents as differences between neighbours: version | count | deltas...
+// It sorts the ordinals.
+func encodeOrdinals(ordinals []uint32) []byte {
+	sort.Slice(ordinals, func(i, j int) bool { return ordinals[i] < ordinals[j] })
+	e := newEncoder(len(ordinals))
+	e.uint(uint64(len(ordinals)))
+	var prev uint32
+	for _, ordinal := range ordinals {
+		e.uint(uint64(ordinal - prev))
+		prev = ordinal
+	}
+	return e.buf
+}
+
+func decodeOrdinals(data []byte) ([]uint32, error) {
+	d, err := newDecoder(data)
+	if err != nil {
+		return nil, err
+	}
+	ordinals := make([]uint32, d.count())
+	var ordinal uint64
+	for i := range ordinals {
+		ordinal += d.uint()
+		if ordinal > 1<<32-1 {
+			return nil, errCorrupted
+		}
+		ordinals[i] = uint32(ordinal)
+	}
+	if err := d.end(); err != nil {
+		return nil, err
+	}
+	return ordinals, nil
+}
+
+// encodeDictionary encodes words as a sorted dictionary without duplicates, every word is stored as the length
+// of the prefix it shares with the previous word and the rest of the word: version | count | (prefix length, suffix)...
+// It sorts the words.
+func encodeDictionary(words []string) []byte {
+	sort.Strings(words)
+	n := 0
+	for _, word := range words {
+		if n == 0 || words[n-1] != word {
+			words[n] = word
+			n++
+		}
+	}
+	words = words[:n]
+
+	e := newEncoder(4 * len(words))
+	e.uint(uint64(len(words)))
+	prev := ""
+	for _, word := range words {
+		shared := 0
+		for shared < len(prev) && shared < len(word) && prev[shared] == word[shared] {
+			shared++
+		}
+		e.uint(uint64(shared))
+		e.string(word[shared:])
+		prev = word
+	}
+	return e.buf
+}
+
+func decodeDictionary(data []byte) ([]string, error) {
+	d, err := newDecoder(data)
+	if err != nil {
+		return nil, err
+	}
+	words := make([]string, d.count())
+	prev := ""
+	for i := range words {
+		shared := d.uint()
+		if shared > uint64(len(prev)) {
+			return nil, errCorrupted
+		}
+		words[i] = prev[:shared] + d.string()
+		prev = words[i]
+	}
+	if err := d.end(); err != nil {
+		return nil, err
+	}
+	return words, nil
+}
+
+// encodeLengths encodes lengths of fields of a document: version | count | (field, length)...
+func encodeLengths(lengths map[string]int) []byte {
+	fields := make([]string, 0, len(lengths))
+	for field := range lengths {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	e := newEncoder(8 * len(fields))
+	e.uint(uint64(len(fields)))
+	for _, field := range fields {
+		e.string(field)
+		e.uint(uint64(lengths[field]))
+	}
+	return e.buf
+}
+
+func decodeLengths(data []byte) (map[string]int, error) {
+	d, err := newDecoder(data)
+	if err != nil {
+		return nil, err
+	}
+	n := d.count()
+	lengths := make(map[string]int, n)
+	for i := 0; i < n; i++ {
+		field := d.string()
+		lengths[field] = int(d.uint())
+	}
+	if err := d.end(); err != nil {
+		return nil, err
+	}
+	return lengths, nil
+}
+
+// encoder appends unsigned varints and strings to a buffer that starts with codecVersion.
+type encoder struct {
+	buf []byte
+}
+
+func newEncoder(size int) *encoder {
+	buf := make([]byte, 1, 1+size)
+	buf[0] = codecVersion
+	return &encoder{buf: buf}
+}
+
+func (e *encoder) uint(v uint64) {
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+func (e *encoder) string(s string) {
+	e.uint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// deltas encodes ascending numbers as differences between neighbours: count | deltas...
+func (e *encoder) deltas(numbers []int) {
+	e.uint(uint64(len(numbers)))
+	prev := 0
+	for _, n := range numbers {
+		e.uint(uint64(n - prev))
+		prev = n
+	}
+}
+
+// decoder reads values written by encoder, the first error stops decoding and is returned by end.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func newDecoder(data []byte) (*decoder, error) {
+	if len(data) == 0 {
+		return nil, errCorrupted
+	}
+	if data[0] != codecVersion {
+		return nil, fmt.Errorf("unsupported index encoding version %d", data[0])
+	}
+	return &decoder{buf: data[1:]}, nil
+}
+
+func (d *decoder) uint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = errCorrupted
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+// count reads the number of encoded values, every value takes a byte at least,
+// so a count larger than the rest of the data is corrupted and isn't allocated.
+func (d *decoder) count() int {
+	n := d.uint()
+	if n > uint64(len(d.buf)) {
+		d.err = errCorrupted
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) string() string {
+	n := d.uint()
+	if n > uint64(len(d.buf)) {
+		d.err = errCorrupted
+		return ""
+	}
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
+
+func (d *decoder) deltas() []int {
+	numbers := make([]int, d.count())
+	prev := 0
+	for i := range numbers {
+		prev += int(d.uint())
+		numbers[i] = prev
+	}
+	return numbers
+}
+
+func (d *decoder) end() error {
+	if d.err == nil && len(d.buf) > 0 {
+		d.err = errCorrupted
+	}
+	return d.err
+}
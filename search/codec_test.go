@@ -0,0 +1,157 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPostingsCodec(t *testing.T) {
+	postings := []ordinalPosting{
+		{Ordinal: 300, Field: "title", TF: 1, Positions: []int{0}},
+		{Ordinal: 2, Field: "description", TF: 2, Positions: []int{3, 170}},
+		{Ordinal: 2, Field: "title", TF: 1, Positions: []int{1}},
+		{Ordinal: 1<<32 - 1, Field: "description", TF: 1, Positions: []int{5}},
+	}
+	want := []ordinalPosting{postings[1], postings[2], postings[0], postings[3]}
+
+	got, err := decodePostings(encodePostings(postings))
+	if err != nil {
+		t.Fatalf("decodePostings() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodePostings() = %v, want %v", got, want)
+	}
+}
+
+func TestOrdinalsCodec(t *testing.T) {
+	got, err := decodeOrdinals(encodeOrdinals([]uint32{70000, 0, 5, 6}))
+	if err != nil {
+		t.Fatalf("decodeOrdinals() error = %v", err)
+	}
+	if want := []uint32{0, 5, 6, 70000}; !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeOrdinals() = %v, want %v", got, want)
+	}
+}
+
+func TestDictionaryCodec(t *testing.T) {
+	data := encodeDictionary([]string{"release", "relapse", "notes", "release", "réunion", "rel"})
+	got, err := decodeDictionary(data)
+	if err != nil {
+		t.Fatalf("decodeDictionary() error = %v", err)
+	}
+	if want := []string{"notes", "rel", "relapse", "release", "réunion"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeDictionary() = %v, want %v", got, want)
+	}
+}
+
+func TestLengthsCodec(t *testing.T) {
+	lengths := map[string]int{"title": 3, "description": 1000, "status": 0}
+	got, err := decodeLengths(encodeLengths(lengths))
+	if err != nil {
+		t.Fatalf("decodeLengths() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, lengths) {
+		t.Errorf("decodeLengths() = %v, want %v", got, lengths)
+	}
+}
+
+func TestDecode_malformed(t *testing.T) {
+	valid := encodePostings([]ordinalPosting{{Ordinal: 1, Field: "title", TF: 2, Positions: []int{0, 1}}})
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "unknown version", data: append([]byte{codecVersion + 1}, valid[1:]...)},
+		{name: "JSON", data: []byte(`[{"id":"1","f":"title","tf":1,"pos":[0]}]`)},
+		{name: "truncated", data: valid[:len(valid)-1]},
+		{name: "trailing bytes", data: append(append([]byte{}, valid...), 0)},
+		{name: "unknown field", data: []byte{codecVersion, 1, 1, 't', 1, 0, 1, 1, 1, 0}},
+		{name: "huge count", data: []byte{codecVersion, 0, 0xff, 0xff, 0xff, 0xff, 0x0f}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := decodePostings(tt.data); err == nil {
+				t.Errorf("decodePostings() = %v, want error", got)
+			}
+		})
+	}
+}
+
+// benchmarkPostings returns postings of a token found in every document of a heavy user,
+// IDs of the documents are UUIDs like IDs of tasks.
+func benchmarkPostings(n int) ([]Posting, []ordinalPosting) {
+	postings := make([]Posting, n)
+	ordinalPostings := make([]ordinalPosting, n)
+	for i := range postings {
+		positions := []int{i % 7, i%7 + 12}
+		postings[i] = Posting{DocID: uuid.NewString(), Field: "description", TF: len(positions), Positions: positions}
+		ordinalPostings[i] = ordinalPosting{Ordinal: uint32(i), Field: "description", TF: len(positions), Positions: positions}
+	}
+	return postings, ordinalPostings
+}
+
+// BenchmarkPostings compares the binary encoding of a posting list with JSON, which stored document IDs
+// in every posting. Sizes of encoded postings are reported as bytes/posting.
+func BenchmarkPostings(b *testing.B) {
+	for _, n := range []int{100, 10000} {
+		postings, ordinalPostings := benchmarkPostings(n)
+		jsonData, err := json.Marshal(postings)
+		if err != nil {
+			b.Fatal(err)
+		}
+		binaryData := encodePostings(ordinalPostings)
+
+		b.Run(fmt.Sprintf("json/encode/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := json.Marshal(postings); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(jsonData))/float64(n), "bytes/posting")
+		})
+		b.Run(fmt.Sprintf("json/decode/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var decoded []Posting
+				if err := json.Unmarshal(jsonData, &decoded); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("binary/encode/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				encodePostings(ordinalPostings)
+			}
+			b.ReportMetric(float64(len(binaryData))/float64(n), "bytes/posting")
+		})
+		b.Run(fmt.Sprintf("binary/decode/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := decodePostings(binaryData); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkBuildRows measures preparing rows of a user's index, which encodes all lists of the index.
+func BenchmarkBuildRows(b *testing.B) {
+	idx := &UserIndex{UserID: 1, Index: Index{}, Schema: backendSchema}
+	for i := 0; i < 1000; i++ {
+		idx.Insert(backendDocument(uuid.NewString(), fmt.Sprintf("Task %d", i), "Write the notes for the next release", "created"))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, postings, terms := buildRows(idx, 0)
+		for _, list := range postings {
+			encodePostings(list)
+		}
+		for _, ordinals := range terms {
+			encodeOrdinals(ordinals)
+		}
+	}
+}
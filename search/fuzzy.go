@@ -0,0 +1,219 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxFuzziness is the maximum number of edits allowed in a fuzzy term.
+	maxFuzziness = 2
+	// autoFuzziness makes fuzziness of a term depend on the term length, see fuzziness.
+	autoFuzziness = -1
+	// fuzzyPenalty lowers scores of fuzzy matches for each edit.
+	fuzzyPenalty = 0.5
+)
+
+// FuzzyTerm is a term found by a fuzzy search and its distance from the searched word.
+type FuzzyTerm struct {
+	Term
+	Distance int
+}
+
+// Fuzzy returns terms that are no more than maxDistance edits(insertions, deletions, substitutions
+// and transpositions of adjacent letters) away from the word.
+//
+// Terms are sorted, so words with a common prefix share rows of the edit distance matrix. When no word starting
+// with a prefix can be close enough, all of them are skipped at once, so only a small part of terms is visited.
+func (t Terms) Fuzzy(word string, maxDistance int) []FuzzyTerm {
+	target := []rune(word)
+	// rows[k] is the row of the edit distance matrix for the first k letters of the current term
+	rows := [][]int{make([]int, len(target)+1)}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+
+	var found []FuzzyTerm
+	var prev []rune
+	for i := 0; i < len(t); {
+		current := []rune(t[i].Word)
+		// rows of the common prefix with the previous term are valid already
+		k := commonPrefix(prev, current, len(rows)-1)
+		rows = rows[:k+1]
+
+		pruned := false
+		for ; k < len(current); k++ {
+			rows = append(rows, nextRow(rows, current, target))
+			if tooFar(rows, maxDistance) {
+				pruned = true
+				break
+			}
+		}
+		prev = current
+
+		if pruned {
+			// no term that starts with the same k+1 letters is close enough
+			prefix := string(current[:k+1])
+			i += sort.Search(len(t)-i, func(j int) bool { return !strings.HasPrefix(t[i+j].Word, prefix) })
+			continue
+		}
+		if distance := rows[len(current)][len(target)]; distance <= maxDistance {
+			found = append(found, FuzzyTerm{Term: t[i], Distance: distance})
+		}
+		i++
+	}
+	return found
+}
+
+// nextRow calculates the row of the edit distance matrix for the next letter of the word,
+// using optimal string alignment distance.
+func nextRow(rows [][]int, word, target []rune) []int {
+	i := len(rows)
+	prev := rows[i-1]
+	row := make([]int, len(target)+1)
+	row[0] = i
+	for j := 1; j <= len(target); j++ {
+		cost := 1
+		if word[i-1] == target[j-1] {
+			cost = 0
+		}
+		row[j] = min3(prev[j]+1, row[j-1]+1, prev[j-1]+cost)
+		if i > 1 && j > 1 && word[i-1] == target[j-2] && word[i-2] == target[j-1] {
+			if transposed := rows[i-2][j-2] + 1; transposed < row[j] {
+				row[j] = transposed
+			}
+		}
+	}
+	return row
+}
+
+// tooFar reports whether every extension of the current prefix is farther than maxDistance from the target.
+// Next rows can't be less than the last row or the row before it plus a transposition.
+func tooFar(rows [][]int, maxDistance int) bool {
+	last := rows[len(rows)-1]
+	if minOf(last) <= maxDistance {
+		return false
+	}
+	return len(rows) < 2 || minOf(rows[len(rows)-2])+1 > maxDistance
+}
+
+func minOf(row []int) int {
+	m := row[0]
+	for _, v := range row[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+func commonPrefix(a, b []rune, limit int) int {
+	n := 0
+	for n < len(a) && n < len(b) && n < limit && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// fuzziness returns the number of edits allowed in a term: short words are matched exactly,
+// longer words may contain one or two typos.
+func fuzziness(word string, requested int) int {
+	if requested != autoFuzziness {
+		return requested
+	}
+	switch length := utf8.RuneCountInString(word); {
+	case length >= 9:
+		return 2
+	case length >= 5:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// fuzzyLengths returns the range of lengths of words that may be similar to fuzzy terms of the query,
+// false means the query has no fuzzy terms. It's used to load only terms that may be found by fuzzy terms.
+func fuzzyLengths(q Query, analyzer *Analyzer) (int, int, bool) {
+	if q, ok := q.(*termQuery); ok {
+		distance := fuzziness(q.text, q.fuzziness)
+		if distance == 0 || len(analyzer.Analyze(q.text)) != 1 {
+			return 0, 0, false
+		}
+		length := utf8.RuneCountInString(q.text)
+		return length - distance, length + distance, true
+	}
+
+	minLength, maxLength, found := 0, 0, false
+	for _, clause := range clauses(q) {
+		clauseMin, clauseMax, ok := fuzzyLengths(clause, analyzer)
+		if !ok {
+			continue
+		}
+		if !found || clauseMin < minLength {
+			minLength = clauseMin
+		}
+		if !found || clauseMax > maxLength {
+			maxLength = clauseMax
+		}
+		found = true
+	}
+	return minLength, maxLength, found
+}
+
+// matchFuzzy returns documents that contain words similar to the word, but analyzed into another token.
+// Scores are lowered for every edit.
+func (idx *UserIndex) matchFuzzy(word, token, field string, maxDistance int) matches {
+	result := matches{}
+	for _, term := range idx.Terms.Fuzzy(strings.ToLower(word), maxDistance) {
+		penalty := math.Pow(fuzzyPenalty, float64(term.Distance))
+		for _, fuzzyToken := range idx.Analyzer.Analyze(term.Word) {
+			if fuzzyToken == token {
+				// the same token is matched exactly
+				continue
+			}
+			for id, score := range idx.scoreToken(fuzzyToken, field) {
+				if score*penalty > result[id] {
+					result[id] = score * penalty
+				}
+			}
+		}
+	}
+	return result
+}
+
+// withFuzzy adds fuzzy matches to exact ones. Fuzzy matches are scaled below the weakest exact match,
+// so documents that contain the exact term always rank higher.
+func withFuzzy(exact, fuzzy matches) matches {
+	if len(exact) == 0 {
+		return fuzzy
+	}
+
+	minExact, maxFuzzy := math.Inf(1), 0.0
+	for _, score := range exact {
+		minExact = math.Min(minExact, score)
+	}
+	for id, score := range fuzzy {
+		if _, ok := exact[id]; !ok {
+			maxFuzzy = math.Max(maxFuzzy, score)
+		}
+	}
+	for id, score := range fuzzy {
+		if _, ok := exact[id]; ok || maxFuzzy == 0 {
+			continue
+		}
+		exact[id] = score / maxFuzzy * minExact * fuzzyPenalty
+	}
+	return exact
+}
@@ -0,0 +1,68 @@
+package search
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestTerms_Fuzzy(t *testing.T) {
+	words := []string{
+		"meet", "meeting", "meetings", "melting", "metting", "mettle", "meat", "eating", "greeting",
+		"deploy", "deployment", "staging", "stage", "release", "relax", "notes", "nodes", "votes",
+		"a", "ab", "ba", "abc", "acb", "ёжик", "ежик",
+	}
+	var terms Terms
+	for _, word := range words {
+		terms.add(word, "1")
+	}
+
+	queries := []string{"meetng", "meeting", "metting", "stagign", "relese", "notes", "ab", "ежик", "", "zzz"}
+	for _, query := range queries {
+		for maxDistance := 0; maxDistance <= maxFuzziness; maxDistance++ {
+			var want []string
+			for _, word := range words {
+				if osaDistance([]rune(word), []rune(query)) <= maxDistance {
+					want = append(want, word)
+				}
+			}
+			sort.Strings(want)
+
+			var got []string
+			for _, term := range terms.Fuzzy(query, maxDistance) {
+				if d := osaDistance([]rune(term.Word), []rune(query)); d != term.Distance {
+					t.Errorf("Terms.Fuzzy(%q, %d) distance of %q = %d, want %d", query, maxDistance, term.Word, term.Distance, d)
+				}
+				got = append(got, term.Word)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Terms.Fuzzy(%q, %d) = %v, want %v", query, maxDistance, got, want)
+			}
+		}
+	}
+}
+
+// osaDistance is a straightforward implementation of optimal string alignment distance.
+func osaDistance(a, b []rune) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min3(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] && d[i-2][j-2]+1 < d[i][j] {
+				d[i][j] = d[i-2][j-2] + 1
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
@@ -0,0 +1,113 @@
+package search
+
+import "strings"
+
+// germanStem stems a German word with the snowball German algorithm, see
+// https://snowballstem.org/algorithms/german/stemmer.html. The word is expected to be lower cased.
+func germanStem(word string, _ bool) string {
+	w := []rune(strings.ReplaceAll(word, "ß", "ss"))
+
+	// u and y between vowels are consonants, they're marked by upper case
+	for i := 1; i < len(w)-1; i++ {
+		if (w[i] == 'u' || w[i] == 'y') && isGermanVowel(w[i-1]) && isGermanVowel(w[i+1]) {
+			w[i] = w[i] - 'a' + 'A'
+		}
+	}
+	// R2 follows the unadjusted R1, only R1 is adjusted to start after at least 3 letters
+	r1 := germanRegion(w, 0)
+	r2 := germanRegion(w, r1)
+	if r1 < 3 {
+		r1 = 3
+	}
+	if r1 > len(w) {
+		r1 = len(w)
+	}
+
+	// step 1: inflectional endings
+	switch suffix := longestSuffix(w, "ern", "em", "er", "en", "es", "e", "s"); {
+	case suffix == "":
+	case len(w)-len(suffix) < r1:
+	case suffix == "s":
+		if len(w) > 1 && strings.ContainsRune("bdfghklmnrt", w[len(w)-2]) {
+			w = w[:len(w)-1]
+		}
+	case suffix == "e" || suffix == "en" || suffix == "es":
+		w = w[:len(w)-len(suffix)]
+		if hasSuffix(w, "niss") {
+			w = w[:len(w)-1]
+		}
+	default:
+		w = w[:len(w)-len(suffix)]
+	}
+
+	// step 2: more inflectional endings
+	switch suffix := longestSuffix(w, "est", "en", "er", "st"); {
+	case suffix == "":
+	case len(w)-len(suffix) < r1:
+	case suffix == "st":
+		// st is removed only after a valid ending that's preceded by at least 3 letters
+		if len(w) > 5 && strings.ContainsRune("bdfghklmnt", w[len(w)-3]) {
+			w = w[:len(w)-2]
+		}
+	default:
+		w = w[:len(w)-len(suffix)]
+	}
+
+	// step 3: derivational endings
+	switch suffix := longestSuffix(w, "isch", "lich", "heit", "keit", "end", "ung", "ig", "ik"); {
+	case suffix == "":
+	case len(w)-len(suffix) < r2:
+	case suffix == "end" || suffix == "ung":
+		w = w[:len(w)-len(suffix)]
+		if hasSuffix(w, "ig") && len(w)-2 >= r2 && !hasSuffix(w[:len(w)-2], "e") {
+			w = w[:len(w)-2]
+		}
+	case suffix == "ig" || suffix == "ik" || suffix == "isch":
+		if !hasSuffix(w[:len(w)-len(suffix)], "e") {
+			w = w[:len(w)-len(suffix)]
+		}
+	case suffix == "lich" || suffix == "heit":
+		w = w[:len(w)-len(suffix)]
+		if (hasSuffix(w, "er") || hasSuffix(w, "en")) && len(w)-2 >= r1 {
+			w = w[:len(w)-2]
+		}
+	case suffix == "keit":
+		w = w[:len(w)-len(suffix)]
+		if hasSuffix(w, "lich") && len(w)-4 >= r2 {
+			w = w[:len(w)-4]
+		} else if hasSuffix(w, "ig") && len(w)-2 >= r2 {
+			w = w[:len(w)-2]
+		}
+	}
+
+	return strings.NewReplacer("U", "u", "Y", "y", "ä", "a", "ö", "o", "ü", "u").Replace(string(w))
+}
+
+// germanRegion returns the start of the region after the first non-vowel following a vowel,
+// the vowel is searched from the start offset.
+func germanRegion(w []rune, start int) int {
+	for i := start + 1; i < len(w); i++ {
+		if !isGermanVowel(w[i]) && isGermanVowel(w[i-1]) {
+			return i + 1
+		}
+	}
+	return len(w)
+}
+
+func isGermanVowel(r rune) bool {
+	return strings.ContainsRune("aeiouyäöü", r)
+}
+
+// longestSuffix returns the first of the suffixes the word ends with, so suffixes should be sorted by length.
+func longestSuffix(w []rune, suffixes ...string) string {
+	for _, suffix := range suffixes {
+		if hasSuffix(w, suffix) {
+			return suffix
+		}
+	}
+	return ""
+}
+
+func hasSuffix(w []rune, suffix string) bool {
+	return strings.HasSuffix(string(w), suffix)
+}
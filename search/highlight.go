@@ -0,0 +1,198 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	DefaultPreTag  = "<em>"
+	DefaultPostTag = "</em>"
+)
+
+const ellipsis = "…"
+
+// Highlighter wraps words of a text that match search tokens in markers.
+// Words are matched after analysis, so "meetings" is highlighted for the token "meet".
+type Highlighter struct {
+	Analyzer *Analyzer
+	PreTag   string
+	PostTag  string
+}
+
+// NewHighlighter creates a highlighter with default markers.
+func NewHighlighter(analyzer *Analyzer) *Highlighter {
+	return &Highlighter{
+		Analyzer: analyzer,
+		PreTag:   DefaultPreTag,
+		PostTag:  DefaultPostTag,
+	}
+}
+
+// Highlight returns the whole text with matched words highlighted.
+func (h *Highlighter) Highlight(text string, tokens []string) string {
+	return h.Snippet(text, tokens, 0)
+}
+
+// Snippet returns a fragment of the text of about size characters around the first matched word,
+// matched words are highlighted. Size 0 means the whole text.
+func (h *Highlighter) Snippet(text string, tokens []string, size int) string {
+	spans := h.matched(text, tokens)
+	start, end := 0, len(text)
+	if size > 0 && utf8.RuneCountInString(text) > size {
+		start, end = fragment(text, spans, size)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString(ellipsis)
+	}
+	pos := start
+	for _, span := range spans {
+		if span.Start < pos || span.End > end {
+			continue
+		}
+		b.WriteString(text[pos:span.Start])
+		b.WriteString(h.PreTag)
+		b.WriteString(text[span.Start:span.End])
+		b.WriteString(h.PostTag)
+		pos = span.End
+	}
+	b.WriteString(text[pos:end])
+	if end < len(text) {
+		b.WriteString(ellipsis)
+	}
+	return b.String()
+}
+
+// matched returns spans of words of the text that are analyzed into any of the tokens.
+func (h *Highlighter) matched(text string, tokens []string) []Span {
+	if len(tokens) == 0 {
+		return nil
+	}
+	set := make(map[string]struct{}, len(tokens))
+	for _, token := range tokens {
+		set[token] = struct{}{}
+	}
+
+	var spans []Span
+	for _, span := range h.Analyzer.AnalyzeSpans(text) {
+		if _, ok := set[span.Token]; ok {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+// fragment returns byte offsets of a fragment of about size characters that starts a bit before the first span.
+// Words at the edges of the fragment aren't cut.
+func fragment(text string, spans []Span, size int) (int, int) {
+	anchor := 0
+	if len(spans) > 0 {
+		anchor = spans[0].Start
+	}
+	start := moveRunes(text, anchor, -size/4)
+	end := moveRunes(text, start, size)
+	if end == len(text) {
+		// the end of the text is reached, use the rest of the size before the anchor
+		start = moveRunes(text, end, -size)
+	}
+
+	// move the start to the beginning of the next word, the end to the end of the previous word
+	for start > 0 && start < anchor && !separatorBefore(text, start) {
+		start = moveRunes(text, start, 1)
+	}
+	for start < anchor && separatorAt(text, start) {
+		start = moveRunes(text, start, 1)
+	}
+	minEnd := anchor
+	if len(spans) > 0 {
+		minEnd = spans[0].End
+	}
+	for end < len(text) && end > minEnd && !separatorAt(text, end) {
+		end = moveRunes(text, end, -1)
+	}
+	for end > minEnd && separatorBefore(text, end) {
+		end = moveRunes(text, end, -1)
+	}
+	return start, end
+}
+
+// moveRunes moves the byte offset n characters forward, or backward if n is negative.
+func moveRunes(text string, offset, n int) int {
+	for ; n > 0 && offset < len(text); n-- {
+		_, size := utf8.DecodeRuneInString(text[offset:])
+		offset += size
+	}
+	for ; n < 0 && offset > 0; n++ {
+		_, size := utf8.DecodeLastRuneInString(text[:offset])
+		offset -= size
+	}
+	return offset
+}
+
+func separatorAt(text string, offset int) bool {
+	r, _ := utf8.DecodeRuneInString(text[offset:])
+	return isSeparator(r)
+}
+
+func separatorBefore(text string, offset int) bool {
+	r, _ := utf8.DecodeLastRuneInString(text[:offset])
+	return isSeparator(r)
+}
+
+// queryTokens returns tokens that make documents match the query, including similar tokens of fuzzy terms.
+// Tokens of negated clauses are skipped unless withNegated is set, since they're not found in matched documents.
+func queryTokens(q Query, idx *UserIndex, withNegated bool) []string {
+	switch q := q.(type) {
+	case *termQuery:
+		tokens := idx.queryAnalyzer().Analyze(q.text)
+		distance := fuzziness(q.text, q.fuzziness)
+		if distance == 0 || len(idx.Analyzer.Analyze(q.text)) != 1 {
+			return tokens
+		}
+		for _, term := range idx.Terms.Fuzzy(strings.ToLower(q.text), distance) {
+			tokens = append(tokens, idx.Analyzer.Analyze(term.Word)...)
+		}
+		return tokens
+	case *phraseQuery:
+		return idx.Analyzer.Analyze(q.text)
+	case *anyQuery:
+		return clausesTokens(q.clauses, idx, withNegated)
+	case *andQuery:
+		return clausesTokens(q.clauses, idx, withNegated)
+	case *orQuery:
+		return clausesTokens(q.clauses, idx, withNegated)
+	case *notQuery:
+		if withNegated {
+			return queryTokens(q.clause, idx, withNegated)
+		}
+		return nil
+	default:
+		return nil
+	}
+}
+
+func clausesTokens(clauses []Query, idx *UserIndex, withNegated bool) []string {
+	var tokens []string
+	for _, clause := range clauses {
+		tokens = append(tokens, queryTokens(clause, idx, withNegated)...)
+	}
+	return tokens
+}
+
+// matchedTokens sets tokens of the query found in each hit.
+func (idx *UserIndex) matchedTokens(hits []Hit, query Query) {
+	byDoc := map[string][]string{}
+	for _, token := range distinct(queryTokens(query, idx, false)) {
+		for _, posting := range idx.Index[token] {
+			byDoc[posting.DocID] = append(byDoc[posting.DocID], token)
+		}
+	}
+	for i := range hits {
+		tokens := byDoc[hits[i].ID]
+		sort.Strings(tokens)
+		hits[i].Tokens = tokens
+	}
+}
@@ -0,0 +1,82 @@
+package search
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHighlighter_Snippet(t *testing.T) {
+	long := strings.Repeat("lorem ipsum ", 10) + "deploy the release to staging " + strings.Repeat("dolor sit amet ", 10)
+	tests := []struct {
+		name   string
+		text   string
+		tokens []string
+		size   int
+		want   string
+	}{
+		{
+			name:   "stemmed words are highlighted",
+			text:   "Meetings, meeting notes and a meet-up",
+			tokens: []string{"meet", "note"},
+			want:   "<em>Meetings</em>, <em>meeting</em> <em>notes</em> and a <em>meet</em>-up",
+		},
+		{
+			name:   "nothing matched",
+			text:   "release notes",
+			tokens: []string{"deploy"},
+			want:   "release notes",
+		},
+		{
+			name:   "short text isn't cut",
+			text:   "release notes",
+			tokens: []string{"releas"},
+			size:   20,
+			want:   "<em>release</em> notes",
+		},
+		{
+			name:   "fragment around the first match",
+			text:   long,
+			tokens: []string{"releas"},
+			size:   40,
+			want:   "…the <em>release</em> to staging dolor sit…",
+		},
+		{
+			name:   "fragment at the start without a match",
+			text:   long,
+			tokens: []string{"unknown"},
+			size:   20,
+			want:   "lorem ipsum lorem…",
+		},
+		{
+			name:   "fragment at the end",
+			text:   "lorem ipsum dolor sit amet release",
+			tokens: []string{"releas"},
+			size:   20,
+			want:   "…sit amet <em>release</em>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHighlighter(NewEnglishAnalyzer())
+			if got := h.Snippet(tt.text, tt.tokens, tt.size); got != tt.want {
+				t.Errorf("Highlighter.Snippet() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserIndex_Search_tokens(t *testing.T) {
+	idx := UserIndex{Index: Index{}}
+	idx.Insert(textDocument("1", "team meeting notes"))
+	idx.Insert(textDocument("2", "release notes"))
+
+	query, err := ParseQuery("meetng OR notes -release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits := idx.Search(query)
+	if len(hits) != 1 || !reflect.DeepEqual(hits[0].Tokens, []string{"meet", "note"}) {
+		t.Errorf("UserIndex.Search() = %v, want tokens [meet note] of document 1", hits)
+	}
+}
@@ -0,0 +1,133 @@
+package search
+
+import (
+	"encoding/json"
+	snowballeng "github.com/kljensen/snowball/english"
+	snowballfr "github.com/kljensen/snowball/french"
+	snowballru "github.com/kljensen/snowball/russian"
+	snowballes "github.com/kljensen/snowball/spanish"
+	"strings"
+)
+
+// analyzers are configs of the available analyzers by name.
+var analyzers = map[string]AnalyzerConfig{
+	"english": {
+		Name:    "english",
+		Filters: []FilterConfig{{Type: "lowercase"}, languageFilter("stop", "english"), languageFilter("stemmer", "english")},
+	},
+	"russian": {
+		Name: "russian",
+		Filters: []FilterConfig{
+			{Type: "lowercase"}, {Type: "yo"}, languageFilter("stop", "russian"), languageFilter("stemmer", "russian"),
+		},
+	},
+	"german": {
+		Name:    "german",
+		Filters: []FilterConfig{{Type: "lowercase"}, languageFilter("stop", "german"), languageFilter("stemmer", "german")},
+	},
+	"french": {
+		Name:    "french",
+		Filters: []FilterConfig{{Type: "lowercase"}, languageFilter("stop", "french"), languageFilter("stemmer", "french")},
+	},
+	"spanish": {
+		Name:    "spanish",
+		Filters: []FilterConfig{{Type: "lowercase"}, languageFilter("stop", "spanish"), languageFilter("stemmer", "spanish")},
+	},
+	// standard is a language neutral analyzer, it only lower cases words, so it works for any language,
+	// but doesn't match different forms of a word.
+	"standard": {
+		Name:    "standard",
+		Filters: []FilterConfig{{Type: "lowercase"}},
+	},
+}
+
+// languageFilter returns the config of a filter that takes only a language, ex: a stemmer.
+func languageFilter(filterType, language string) FilterConfig {
+	return FilterConfig{Type: filterType, Params: json.RawMessage(`{"language":"` + language + `"}`)}
+}
+
+// stopWordLists are stop words of languages of the "stop" filter.
+var stopWordLists = map[string]map[string]struct{}{
+	"english": stopWords,
+	"russian": russianStopWords,
+	"german":  germanStopWords,
+	"french":  frenchStopWords,
+	"spanish": spanishStopWords,
+}
+
+// stemmers are stemmers of languages of the "stemmer" filter.
+var stemmers = map[string]func(word string, stemStopWords bool) string{
+	"english": snowballeng.Stem,
+	"russian": snowballru.Stem,
+	"german":  germanStem,
+	"french":  snowballfr.Stem,
+	"spanish": snowballes.Stem,
+}
+
+// NewRussianAnalyzer creates an analyzer to analyze Russian text.
+func NewRussianAnalyzer() *Analyzer {
+	return builtinAnalyzer("russian")
+}
+
+// NewGermanAnalyzer creates an analyzer to analyze German text.
+func NewGermanAnalyzer() *Analyzer {
+	return builtinAnalyzer("german")
+}
+
+// NewFrenchAnalyzer creates an analyzer to analyze French text.
+func NewFrenchAnalyzer() *Analyzer {
+	return builtinAnalyzer("french")
+}
+
+// NewSpanishAnalyzer creates an analyzer to analyze Spanish text.
+func NewSpanishAnalyzer() *Analyzer {
+	return builtinAnalyzer("spanish")
+}
+
+// NewStandardAnalyzer creates a language neutral analyzer, it only lower cases words,
+// so it works for any language, but doesn't match different forms of a word.
+func NewStandardAnalyzer() *Analyzer {
+	return builtinAnalyzer("standard")
+}
+
+// stemmerFilter creates a filter that stems words with a snowball stemmer.
+func stemmerFilter(stem func(word string, stemStopWords bool) string) Filter {
+	return func(tokens []string) []string {
+		r := make([]string, len(tokens))
+		for i, token := range tokens {
+			r[i] = stem(token, false)
+		}
+		return r
+	}
+}
+
+// yoFilter replaces ё with е, since Russian texts are often written without ё.
+func yoFilter(tokens []string) []string {
+	r := make([]string, len(tokens))
+	for i, token := range tokens {
+		r[i] = strings.ReplaceAll(token, "ё", "е")
+	}
+	return r
+}
+
+var russianStopWords = map[string]struct{}{
+	"а": {}, "в": {}, "во": {}, "и": {}, "к": {}, "ко": {}, "на": {}, "не": {}, "но": {},
+	"о": {}, "об": {}, "от": {}, "по": {}, "с": {}, "со": {}, "у": {}, "что": {}, "это": {},
+}
+
+var germanStopWords = map[string]struct{}{
+	"der": {}, "die": {}, "das": {}, "den": {}, "dem": {}, "des": {}, "ein": {}, "eine": {},
+	"einen": {}, "einem": {}, "und": {}, "oder": {}, "zu": {}, "zum": {}, "zur": {}, "im": {},
+	"in": {}, "mit": {}, "von": {}, "für": {}, "auf": {}, "ist": {}, "nicht": {},
+}
+
+var frenchStopWords = map[string]struct{}{
+	"le": {}, "la": {}, "les": {}, "l": {}, "un": {}, "une": {}, "des": {}, "de": {}, "du": {},
+	"d": {}, "et": {}, "ou": {}, "à": {}, "au": {}, "aux": {}, "en": {}, "pour": {}, "sur": {},
+	"dans": {}, "par": {}, "est": {}, "que": {}, "qui": {},
+}
+
+var spanishStopWords = map[string]struct{}{
+	"el": {}, "la": {}, "los": {}, "las": {}, "un": {}, "una": {}, "de": {}, "del": {}, "y": {},
+	"o": {}, "a": {}, "al": {}, "en": {}, "con": {}, "por": {}, "para": {}, "que": {}, "es": {},
+}
@@ -0,0 +1,258 @@
+package search
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// standardTokenizer is the name of the tokenizer used when a config doesn't choose one.
+const standardTokenizer = "standard"
+
+// maxNGramSize bounds sizes of n-grams, every token of n letters produces up to n n-grams of every size.
+const maxNGramSize = 20
+
+var ErrInvalidAnalyzer = fmt.Errorf("invalid analyzer")
+
+// AnalyzerConfig describes an analyzer declaratively: the tokenizer that splits text into tokens and filters
+// applied to the tokens in order, ex:
+//
+//	{"name":"english","filters":[{"type":"lowercase"},{"type":"stemmer","params":{"language":"english"}}]}
+type AnalyzerConfig struct {
+	Name string `json:"name"`
+	// Tokenizer is the name of a tokenizer: "standard" splits text on characters that aren't letters or numbers,
+	// "whitespace" splits text on white space. Empty means "standard".
+	Tokenizer string         `json:"tokenizer,omitempty"`
+	Filters   []FilterConfig `json:"filters"`
+}
+
+// FilterConfig is the name of a registered filter and its parameters.
+type FilterConfig struct {
+	Type   string          `json:"type"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// Build creates the analyzer described by the config, it returns ErrInvalidAnalyzer if the config refers
+// to an unknown tokenizer or filter, or parameters of a filter are invalid.
+func (c AnalyzerConfig) Build() (*Analyzer, error) {
+	tokenizerName := c.Tokenizer
+	if tokenizerName == "" {
+		tokenizerName = standardTokenizer
+	}
+	tokenizer, ok := tokenizers[tokenizerName]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown tokenizer %q, available tokenizers: %s", ErrInvalidAnalyzer, c.Tokenizer, strings.Join(sortedNames(tokenizers), ", "))
+	}
+
+	filters := make([]Filter, len(c.Filters))
+	for i, filterConfig := range c.Filters {
+		factory, ok := filterFactories[filterConfig.Type]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown filter %q, available filters: %s", ErrInvalidAnalyzer, filterConfig.Type, strings.Join(FilterNames(), ", "))
+		}
+		filter, err := factory(filterConfig.Params)
+		if err != nil {
+			return nil, fmt.Errorf("%w: filter %q: %v", ErrInvalidAnalyzer, filterConfig.Type, err)
+		}
+		filters[i] = filter
+	}
+
+	config := c
+	config.Filters = append([]FilterConfig{}, c.Filters...)
+	return &Analyzer{Name: c.Name, Filters: filters, Tokenizer: tokenizer, Config: &config}, nil
+}
+
+// ParseAnalyzer creates an analyzer from JSON: the name of an available analyzer, ex: "english", or a config.
+func ParseAnalyzer(data []byte) (*Analyzer, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		var name string
+		if err := json.Unmarshal(data, &name); err != nil {
+			return nil, err
+		}
+		return NewAnalyzer(name)
+	}
+
+	var config AnalyzerConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAnalyzer, err)
+	}
+	return config.Build()
+}
+
+// FilterFactory creates a filter from its parameters, params are empty if the config of the filter has none.
+type FilterFactory func(params json.RawMessage) (Filter, error)
+
+// filterFactories are the registered filters by name.
+var filterFactories = map[string]FilterFactory{
+	"lowercase":  staticFilter(lowercaseFilter),
+	"yo":         staticFilter(yoFilter),
+	"stop":       newStopWordFilter,
+	"stemmer":    newStemmerFilter,
+	"min_length": newMinLengthFilter,
+	"ngram":      newNGramFilter(false),
+	"edge_ngram": newNGramFilter(true),
+}
+
+// RegisterFilter adds a filter to the registry, so configs of analyzers can refer to it by name.
+// Filters are expected to be registered on init, it panics if the name is registered already.
+func RegisterFilter(name string, factory FilterFactory) {
+	if _, ok := filterFactories[name]; ok {
+		panic(fmt.Sprintf("search: filter %q is registered already", name))
+	}
+	filterFactories[name] = factory
+}
+
+// FilterNames returns sorted names of the registered filters.
+func FilterNames() []string {
+	return sortedNames(filterFactories)
+}
+
+// Tokenizer splits a text into tokens and records their locations.
+type Tokenizer func(text string) []Span
+
+// tokenizers are the available tokenizers by name.
+var tokenizers = map[string]Tokenizer{
+	standardTokenizer: tokenizeSpans,
+	"whitespace":      whitespaceSpans,
+}
+
+// decodeParams decodes parameters of a filter, unknown parameters are errors, so typos aren't ignored.
+func decodeParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// staticFilter returns the factory of a filter without parameters.
+func staticFilter(filter Filter) FilterFactory {
+	return func(params json.RawMessage) (Filter, error) {
+		if err := decodeParams(params, &struct{}{}); err != nil {
+			return nil, err
+		}
+		return filter, nil
+	}
+}
+
+// newStopWordFilter creates a filter that removes stop words of a language and/or the listed words,
+// ex: {"language":"english","words":["todo"]}.
+func newStopWordFilter(params json.RawMessage) (Filter, error) {
+	var p struct {
+		Language string   `json:"language"`
+		Words    []string `json:"words"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Language == "" && len(p.Words) == 0 {
+		return nil, fmt.Errorf("language or words are required")
+	}
+	words := map[string]struct{}{}
+	if p.Language != "" {
+		languageWords, ok := stopWordLists[p.Language]
+		if !ok {
+			return nil, fmt.Errorf("unknown language %q, available languages: %s", p.Language, strings.Join(sortedNames(stopWordLists), ", "))
+		}
+		for word := range languageWords {
+			words[word] = struct{}{}
+		}
+	}
+	for _, word := range p.Words {
+		words[word] = struct{}{}
+	}
+	return stopWordFilter(words), nil
+}
+
+// newStemmerFilter creates a filter that stems words of a language, ex: {"language":"english"}.
+func newStemmerFilter(params json.RawMessage) (Filter, error) {
+	var p struct {
+		Language string `json:"language"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	stem, ok := stemmers[p.Language]
+	if !ok {
+		return nil, fmt.Errorf("unknown language %q, available languages: %s", p.Language, strings.Join(sortedNames(stemmers), ", "))
+	}
+	return stemmerFilter(stem), nil
+}
+
+// newMinLengthFilter creates a filter that removes tokens shorter than min letters, ex: {"min":2}.
+func newMinLengthFilter(params json.RawMessage) (Filter, error) {
+	var p struct {
+		Min int `json:"min"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Min < 1 {
+		return nil, fmt.Errorf("min must be positive")
+	}
+	return func(tokens []string) []string {
+		r := make([]string, 0, len(tokens))
+		for _, token := range tokens {
+			if utf8.RuneCountInString(token) >= p.Min {
+				r = append(r, token)
+			}
+		}
+		return r
+	}, nil
+}
+
+// newNGramFilter returns the factory of a filter that replaces tokens by their n-grams of min to max letters,
+// ex: {"min":2,"max":3}, edge n-grams are prefixes of tokens only. Tokens shorter than min are kept as they are,
+// so short words are still found.
+func newNGramFilter(edge bool) FilterFactory {
+	return func(params json.RawMessage) (Filter, error) {
+		var p struct {
+			Min int `json:"min"`
+			Max int `json:"max"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		if p.Min < 1 || p.Max < p.Min || p.Max > maxNGramSize {
+			return nil, fmt.Errorf("sizes must be 1 <= min <= max <= %d", maxNGramSize)
+		}
+		return func(tokens []string) []string {
+			var r []string
+			for _, token := range tokens {
+				letters := []rune(token)
+				if len(letters) < p.Min {
+					r = append(r, token)
+					continue
+				}
+				for start := 0; start < len(letters); start++ {
+					if edge && start > 0 {
+						break
+					}
+					for size := p.Min; size <= p.Max && start+size <= len(letters); size++ {
+						r = append(r, string(letters[start:start+size]))
+					}
+				}
+			}
+			return r
+		}, nil
+	}
+}
+
+// sortedNames returns sorted names of a registry, a map with string keys.
+func sortedNames(registry interface{}) []string {
+	keys := reflect.ValueOf(registry).MapKeys()
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = key.String()
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,182 @@
+package search
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAnalyzer(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		text   string
+		want   []string
+	}{
+		{
+			name:   "available analyzer by name",
+			config: `"english"`,
+			text:   "Preparing the reports",
+			want:   []string{"prepar", "report"},
+		},
+		{
+			name:   "whitespace tokenizer",
+			config: `{"name":"code","tokenizer":"whitespace","filters":[{"type":"lowercase"}]}`,
+			text:   "Fix C++ e-mail parser",
+			want:   []string{"fix", "c++", "e-mail", "parser"},
+		},
+		{
+			name:   "stop words of a language and listed words",
+			config: `{"filters":[{"type":"lowercase"},{"type":"stop","params":{"language":"english","words":["todo"]}}]}`,
+			text:   "TODO: write the notes",
+			want:   []string{"write", "notes"},
+		},
+		{
+			name:   "min length",
+			config: `{"filters":[{"type":"min_length","params":{"min":3}}]}`,
+			text:   "go to the store",
+			want:   []string{"the", "store"},
+		},
+		{
+			name:   "n-grams",
+			config: `{"filters":[{"type":"ngram","params":{"min":2,"max":3}}]}`,
+			text:   "bug a",
+			want:   []string{"bu", "bug", "ug", "a"},
+		},
+		{
+			name:   "edge n-grams",
+			config: `{"filters":[{"type":"lowercase"},{"type":"edge_ngram","params":{"min":1,"max":3}}]}`,
+			text:   "Ёлка",
+			want:   []string{"ё", "ёл", "ёлк"},
+		},
+		{
+			name:   "filters are applied in order",
+			config: `{"filters":[{"type":"stop","params":{"language":"english"}},{"type":"lowercase"}]}`,
+			text:   "The notes of the release",
+			want:   []string{"the", "notes", "release"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analyzer, err := ParseAnalyzer([]byte(tt.config))
+			if err != nil {
+				t.Fatalf("ParseAnalyzer() error = %v", err)
+			}
+			if got := analyzer.Analyze(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Analyze() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAnalyzer_invalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown tokenizer":         `{"tokenizer":"camel","filters":[]}`,
+		"unknown filter":            `{"filters":[{"type":"soundex"}]}`,
+		"unknown parameter":         `{"filters":[{"type":"stemmer","params":{"lang":"english"}}]}`,
+		"unexpected parameter":      `{"filters":[{"type":"lowercase","params":{"language":"english"}}]}`,
+		"unknown language":          `{"filters":[{"type":"stemmer","params":{"language":"klingon"}}]}`,
+		"stop filter without words": `{"filters":[{"type":"stop"}]}`,
+		"min length isn't positive": `{"filters":[{"type":"min_length","params":{"min":0}}]}`,
+		"n-gram sizes":              `{"filters":[{"type":"ngram","params":{"min":3,"max":2}}]}`,
+		"unknown field":             `{"filters":[],"stemmer":"english"}`,
+	}
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseAnalyzer([]byte(config)); !errors.Is(err, ErrInvalidAnalyzer) {
+				t.Errorf("ParseAnalyzer() error = %v, want %v", err, ErrInvalidAnalyzer)
+			}
+		})
+	}
+	if _, err := ParseAnalyzer([]byte(`"klingon"`)); !errors.Is(err, ErrUnknownAnalyzer) {
+		t.Errorf("ParseAnalyzer(unknown name) error = %v, want %v", err, ErrUnknownAnalyzer)
+	}
+}
+
+func TestRegisterFilter(t *testing.T) {
+	RegisterFilter("test_reverse", func(params json.RawMessage) (Filter, error) {
+		return func(tokens []string) []string {
+			r := make([]string, len(tokens))
+			for i, token := range tokens {
+				r[len(tokens)-1-i] = token
+			}
+			return r
+		}, nil
+	})
+	defer delete(filterFactories, "test_reverse")
+
+	analyzer, err := AnalyzerConfig{Name: "reversed", Filters: []FilterConfig{{Type: "lowercase"}, {Type: "test_reverse"}}}.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := analyzer.Analyze("Write Notes"), []string{"notes", "write"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Analyze() = %v, want %v", got, want)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("RegisterFilter() of a registered name didn't panic")
+		}
+	}()
+	RegisterFilter("lowercase", staticFilter(lowercaseFilter))
+}
+
+func TestAnalyzer_AnalyzeStages(t *testing.T) {
+	stages := NewEnglishAnalyzer().AnalyzeStages("Writing the Notes")
+	want := []Stage{
+		{Kind: "tokenizer", Name: "standard", Tokens: []string{"Writing", "the", "Notes"}},
+		{Kind: "filter", Name: "lowercase", Tokens: []string{"writing", "the", "notes"}},
+		{Kind: "filter", Name: "stop", Tokens: []string{"writing", "notes"}},
+		{Kind: "filter", Name: "stemmer", Tokens: []string{"write", "note"}},
+	}
+	if !reflect.DeepEqual(stages, want) {
+		t.Errorf("AnalyzeStages() = %v, want %v", stages, want)
+	}
+}
+
+func TestAnalyzer_JSON_config(t *testing.T) {
+	config := `{"name":"code","tokenizer":"whitespace","filters":[{"type":"lowercase"},{"type":"edge_ngram","params":{"min":2,"max":4}}]}`
+	analyzer, err := ParseAnalyzer([]byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(analyzer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != config {
+		t.Errorf("Marshal() = %s, want %s", data, config)
+	}
+
+	var got *Analyzer
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	text := "Parse C++ headers"
+	if !reflect.DeepEqual(got.Analyze(text), analyzer.Analyze(text)) {
+		t.Errorf("restored analyzer analyzes %q as %v, want %v", text, got.Analyze(text), analyzer.Analyze(text))
+	}
+
+	// analyzers saved by name before configs are restored from available analyzers
+	if err := json.Unmarshal([]byte(`"german"`), &got); err != nil || got.Name != "german" {
+		t.Errorf("Unmarshal(name) = %v, %v, want german analyzer", got, err)
+	}
+	if data, err := json.Marshal(got); err != nil || !strings.HasPrefix(string(data), `{"name":"german"`) {
+		t.Errorf("Marshal() = %s, %v, want config of german analyzer", data, err)
+	}
+}
+
+func Test_sameAnalyzer(t *testing.T) {
+	custom, err := ParseAnalyzer([]byte(`{"name":"english","filters":[{"type":"lowercase"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameAnalyzer(NewEnglishAnalyzer(), &Analyzer{Name: "english"}) {
+		t.Error("sameAnalyzer() of english analyzers = false")
+	}
+	if sameAnalyzer(NewEnglishAnalyzer(), custom) {
+		t.Error("sameAnalyzer() of analyzers with the same name and different filters = true")
+	}
+}
@@ -0,0 +1,637 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"sort"
+	"strings"
+	"todo/user"
+)
+
+// postgresWeights are weights of lexemes of a tsvector, fields of documents get them in order.
+const postgresWeights = "ABCD"
+
+// postgresConfigs maps analyzers to text search configurations of PostgreSQL.
+var postgresConfigs = map[string]string{
+	"english":  "english",
+	"russian":  "russian",
+	"german":   "german",
+	"french":   "french",
+	"spanish":  "spanish",
+	"standard": "simple",
+}
+
+// PostgresBackend is a backend that uses full-text search of PostgreSQL. Documents are rows of a table with id and
+// user_id columns(ex: tasks), their fields are stored in a weighted tsvector column with a GIN index and ranked by
+// ts_rank, so indexing a document updates only its row.
+//
+// Text is analyzed by the text search configuration matching the analyzer, so results differ slightly from
+// IndexBackend: fuzzy terms match only exact words and proximity queries match documents that contain all words.
+type PostgresBackend struct {
+	db *gorm.DB
+	// Table contains documents, the search columns are added by Migrate.
+	Table string
+	// Fields are names of indexed fields of documents, they get weights A, B, C and D in order.
+	Fields []string
+	Schema Schema
+}
+
+func NewPostgresBackend(gorm *gorm.DB, table string, fields []string, schema Schema) (*PostgresBackend, error) {
+	if len(fields) == 0 || len(fields) > len(postgresWeights) {
+		return nil, fmt.Errorf("postgres search backend indexes from 1 to %d fields, got %d", len(postgresWeights), len(fields))
+	}
+	return &PostgresBackend{
+		db:     gorm,
+		Table:  table,
+		Fields: fields,
+		Schema: schema,
+	}, nil
+}
+
+// Migrate adds search columns and the GIN index to the table and indexes documents of users whose rows aren't
+// indexed yet, ex: rows that were created before the backend was chosen. Documents are analyzed by the analyzer
+// of the user's indexed rows, or by the analyzer of the user's settings if none are indexed.
+func (b *PostgresBackend) Migrate(ctx context.Context, source DocumentSource, users user.Repository) error {
+	db := b.db.WithContext(ctx)
+	err := db.Exec(fmt.Sprintf(`ALTER TABLE %s
+		ADD COLUMN IF NOT EXISTS search_vector tsvector,
+		ADD COLUMN IF NOT EXISTS search_words tsvector,
+		ADD COLUMN IF NOT EXISTS search_analyzer text`, b.Table)).Error
+	if err != nil {
+		return fmt.Errorf("could not add search columns: %w", err)
+	}
+	err = db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_search_vector_idx ON %s USING GIN (search_vector)", b.Table, b.Table)).Error
+	if err != nil {
+		return fmt.Errorf("could not create search index: %w", err)
+	}
+
+	var userIDs []uint
+	err = db.Table(b.Table).Distinct("user_id").Where("search_vector IS NULL").Pluck("user_id", &userIDs).Error
+	if err != nil {
+		return fmt.Errorf("could not find unindexed documents: %w", err)
+	}
+	for _, userID := range userIDs {
+		documents, err := source(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("could not load documents of user %d: %w", userID, err)
+		}
+		usr := user.User{ID: userID}
+		found, err := users.FindByID(ctx, userID)
+		switch {
+		case err == nil:
+			usr = *found
+		case !errors.Is(err, user.ErrNotFound):
+			return fmt.Errorf("could not find user %d: %w", userID, err)
+		}
+		userCtx := context.WithValue(ctx, user.UserContextKey, usr)
+		if err := b.Rebuild(userCtx, nil, documents...); err != nil {
+			return fmt.Errorf("could not index documents of user %d: %w", userID, err)
+		}
+	}
+	return nil
+}
+
+func (b *PostgresBackend) Search(ctx context.Context, query Query, synonyms Synonyms) ([]Hit, error) {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	analyzer, err := b.analyzer(ctx, b.db, usr)
+	if err != nil {
+		return nil, err
+	}
+	t := &tsTranslator{backend: b, analyzer: analyzer, config: postgresConfig(analyzer), synonyms: synonyms}
+	condition, args, ok := t.translate(query, false)
+	if !ok {
+		return []Hit{}, nil
+	}
+
+	rank := "0"
+	if len(t.ranks) > 0 {
+		rank = strings.Join(t.ranks, " + ")
+	}
+	var rows []struct {
+		ID    string
+		Score float64
+	}
+	err = b.db.WithContext(ctx).Raw(
+		fmt.Sprintf("SELECT id, %s AS score FROM %s WHERE user_id = ? AND search_vector IS NOT NULL AND %s ORDER BY score DESC, id", rank, b.Table, condition),
+		append(append(t.rankArgs, usr.ID), args...)...,
+	).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to search documents: %w", err)
+	}
+
+	// Hits contain all tokens of the query, highlighting skips tokens that aren't found in a document
+	tokens := distinct(queryTokens(query, &UserIndex{Analyzer: analyzer, Synonyms: synonyms}, false))
+	sort.Strings(tokens)
+	hits := make([]Hit, len(rows))
+	for i, row := range rows {
+		hits[i] = Hit{ID: row.ID, Score: row.Score, Tokens: tokens}
+	}
+	return hits, nil
+}
+
+func (b *PostgresBackend) Suggest(ctx context.Context, prefix string, limit int) ([]Suggestion, error) {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	head, last, ok := completedWord(prefix)
+	if !ok {
+		return []Suggestion{}, nil
+	}
+
+	analyzer, err := b.analyzer(ctx, b.db, usr)
+	if err != nil {
+		return nil, err
+	}
+	var stats []struct {
+		Word string
+		Ndoc int
+	}
+	documents := fmt.Sprintf("SELECT search_words FROM %s WHERE user_id = %d AND search_words IS NOT NULL", b.Table, usr.ID)
+	err = b.db.WithContext(ctx).Raw(`SELECT word, ndoc FROM ts_stat(?) WHERE word LIKE ?`, documents, likeEscaper.Replace(last)+"%").
+		Scan(&stats).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest words: %w", err)
+	}
+
+	suggestions := make([]Suggestion, 0, len(stats))
+	for _, stat := range stats {
+		// words are indexed by the simple configuration, so stop words are skipped here
+		if len(analyzer.Analyze(stat.Word)) == 0 {
+			continue
+		}
+		suggestions = append(suggestions, Suggestion{Text: head + stat.Word, Kind: TermSuggestion, DocCount: stat.Ndoc})
+	}
+	SortSuggestions(suggestions)
+	if limit > 0 && len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
+
+func (b *PostgresBackend) Insert(ctx context.Context, documents ...Document) error {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	return b.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		analyzer, err := b.analyzer(ctx, tx, usr)
+		if err != nil {
+			return err
+		}
+		return b.insert(tx, usr.ID, analyzer, documents)
+	})
+}
+
+func (b *PostgresBackend) Delete(ctx context.Context, document Document) error {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	err := b.db.WithContext(ctx).Table(b.Table).Where("id = ? AND user_id = ?", document.ID, usr.ID).Updates(map[string]interface{}{
+		"search_vector":   nil,
+		"search_words":    nil,
+		"search_analyzer": nil,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to delete document from search: %w", err)
+	}
+	return nil
+}
+
+func (b *PostgresBackend) Rebuild(ctx context.Context, analyzer *Analyzer, documents ...Document) error {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	return b.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if analyzer == nil {
+			var err error
+			analyzer, err = b.analyzer(ctx, tx, usr)
+			if err != nil {
+				return err
+			}
+		}
+		err := tx.Table(b.Table).Where("user_id = ?", usr.ID).Updates(map[string]interface{}{
+			"search_vector":   nil,
+			"search_words":    nil,
+			"search_analyzer": nil,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to clear search documents: %w", err)
+		}
+		return b.insert(tx, usr.ID, analyzer, documents)
+	})
+}
+
+func (b *PostgresBackend) DocumentIDs(ctx context.Context) ([]string, error) {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	ids := []string{}
+	err := b.db.WithContext(ctx).Table(b.Table).
+		Where("user_id = ? AND search_vector IS NOT NULL", usr.ID).
+		Order("id").
+		Pluck("id", &ids).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find indexed documents: %w", err)
+	}
+	return ids, nil
+}
+
+// Terms reads words of the user's documents from search_words, words are indexed by the simple configuration,
+// so stop words are skipped here.
+func (b *PostgresBackend) Terms(ctx context.Context, filter TermFilter) (Terms, error) {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	analyzer, err := b.analyzer(ctx, b.db, usr)
+	if err != nil {
+		return nil, err
+	}
+	tx := b.db.WithContext(ctx).
+		Table(fmt.Sprintf("%s, unnest(%s.search_words) AS w", b.Table, b.Table)).
+		Select(fmt.Sprintf("w.lexeme AS word, %s.id AS doc_id", b.Table)).
+		Where(fmt.Sprintf("%s.user_id = ? AND %s.search_words IS NOT NULL", b.Table, b.Table), usr.ID)
+	if filter.Prefix != "" {
+		tx = tx.Where("w.lexeme LIKE ?", likeEscaper.Replace(filter.Prefix)+"%")
+	}
+	if filter.MinLength > 0 {
+		tx = tx.Where("char_length(w.lexeme) >= ?", filter.MinLength)
+	}
+	if filter.MaxLength > 0 {
+		tx = tx.Where("char_length(w.lexeme) <= ?", filter.MaxLength)
+	}
+	var rows []struct {
+		Word  string
+		DocID string
+	}
+	if err := tx.Order("word, doc_id").Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to find words: %w", err)
+	}
+
+	terms := Terms{}
+	for _, row := range rows {
+		if len(terms) > 0 && terms[len(terms)-1].Word == row.Word {
+			terms[len(terms)-1].DocIDs = append(terms[len(terms)-1].DocIDs, row.DocID)
+			continue
+		}
+		if len(analyzer.Analyze(row.Word)) == 0 {
+			continue
+		}
+		terms = append(terms, Term{Word: row.Word, DocIDs: []string{row.DocID}})
+	}
+	// words are ordered by the collation of the database, terms are sorted by bytes
+	sort.Slice(terms, func(i, j int) bool {
+		return terms[i].Word < terms[j].Word
+	})
+	return terms, nil
+}
+
+// Related compares the document with relatedCandidates documents ranked by ts_rank of its lexemes,
+// vectors are built from lexemes of tsvectors weighted by boosts of their fields.
+func (b *PostgresBackend) Related(ctx context.Context, document Document, limit int) ([]Hit, error) {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	analyzer, err := b.analyzer(ctx, b.db, usr)
+	if err != nil {
+		return nil, err
+	}
+	weights, ok := b.weights("")
+	if !ok {
+		return []Hit{}, nil
+	}
+	db := b.db.WithContext(ctx)
+
+	expression, args := b.vector(postgresConfig(analyzer), document)
+	var lexemes []postgresLexeme
+	err = db.Raw(fmt.Sprintf(`SELECT w.lexeme, p.weight, count(*) AS tf
+		FROM unnest(ts_filter(%s, %s)) AS w, unnest(w.weights) AS p(weight)
+		GROUP BY w.lexeme, p.weight`, expression, weights), args...).Scan(&lexemes).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to analyze document: %w", err)
+	}
+	vector := b.termVectors(lexemes)[""]
+	if len(vector) == 0 {
+		return []Hit{}, nil
+	}
+	tokens := make([]string, 0, len(vector))
+	for token := range vector {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+	tsquery := tsLexemes(tokens)
+
+	var rows []postgresLexeme
+	err = db.Raw(fmt.Sprintf(`SELECT c.id, w.lexeme, p.weight, count(*) AS tf
+		FROM (
+			SELECT id, ts_filter(search_vector, %s) AS v FROM %s
+			WHERE user_id = ? AND id <> ? AND search_vector IS NOT NULL AND ts_filter(search_vector, %s) @@ ?::tsquery
+			ORDER BY ts_rank(%s, ts_filter(search_vector, %s), ?::tsquery) DESC, id
+			LIMIT %d
+		) AS c, unnest(c.v) AS w, unnest(w.weights) AS p(weight)
+		GROUP BY c.id, w.lexeme, p.weight`, weights, b.Table, weights, b.rankWeights(), weights, relatedCandidates),
+		usr.ID, document.ID, tsquery, tsquery).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find similar documents: %w", err)
+	}
+	candidates := b.termVectors(rows)
+	if len(candidates) == 0 {
+		return []Hit{}, nil
+	}
+
+	seen := map[string]bool{}
+	var candidateTokens []string
+	for _, candidate := range candidates {
+		for token := range candidate {
+			if !seen[token] {
+				seen[token] = true
+				candidateTokens = append(candidateTokens, token)
+			}
+		}
+	}
+	for _, token := range tokens {
+		if !seen[token] {
+			candidateTokens = append(candidateTokens, token)
+		}
+	}
+	var stats []struct {
+		Lexeme string
+		DF     int
+	}
+	err = db.Table(fmt.Sprintf("%s, unnest(ts_filter(%s.search_vector, %s)) AS w", b.Table, b.Table, weights)).
+		Select("w.lexeme, count(*) AS df").
+		Where(fmt.Sprintf("%s.user_id = ? AND %s.search_vector IS NOT NULL AND w.lexeme IN ?", b.Table, b.Table), usr.ID, candidateTokens).
+		Group("w.lexeme").
+		Scan(&stats).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count documents of lexemes: %w", err)
+	}
+	df := make(map[string]int, len(stats))
+	for _, stat := range stats {
+		df[stat.Lexeme] = stat.DF
+	}
+	var n int64
+	if err := db.Table(b.Table).Where("user_id = ? AND search_vector IS NOT NULL", usr.ID).Count(&n).Error; err != nil {
+		return nil, fmt.Errorf("failed to count documents: %w", err)
+	}
+	return similar(vector, candidates, df, int(n), limit), nil
+}
+
+// postgresLexeme is the number of positions of a lexeme of a weight in a tsvector of a document.
+type postgresLexeme struct {
+	ID     string
+	Lexeme string
+	Weight string
+	TF     int
+}
+
+// termVectors returns vectors of documents of the lexemes, frequencies of lexemes are multiplied by boosts
+// of fields of their weights.
+func (b *PostgresBackend) termVectors(lexemes []postgresLexeme) map[string]termVector {
+	boosts := map[string]float64{}
+	for i, name := range b.Fields {
+		boosts[string(postgresWeights[i])] = 1
+		if boost := b.Schema[name].Boost; boost > 0 {
+			boosts[string(postgresWeights[i])] = boost
+		}
+	}
+	vectors := map[string]termVector{}
+	for _, lexeme := range lexemes {
+		vector, ok := vectors[lexeme.ID]
+		if !ok {
+			vector = termVector{}
+			vectors[lexeme.ID] = vector
+		}
+		vector[lexeme.Lexeme] += boosts[strings.ToUpper(lexeme.Weight)] * float64(lexeme.TF)
+	}
+	return vectors
+}
+
+// insert updates search columns of rows of the documents.
+func (b *PostgresBackend) insert(tx *gorm.DB, userID uint, analyzer *Analyzer, documents []Document) error {
+	config := postgresConfig(analyzer)
+	for _, document := range documents {
+		var words []string
+		for _, field := range document.Fields {
+			if !b.Schema[field.Name].Scoped {
+				words = append(words, field.Text)
+			}
+		}
+
+		vector, vectorArgs := b.vector(config, document)
+		update := fmt.Sprintf("UPDATE %s SET search_analyzer = ?, search_vector = %s, search_words = to_tsvector('simple', ?) WHERE id = ? AND user_id = ?",
+			b.Table, vector)
+		args := append([]interface{}{analyzer.Name}, vectorArgs...)
+		args = append(args, strings.Join(words, "\n"), document.ID, userID)
+		if err := tx.Exec(update, args...).Error; err != nil {
+			return fmt.Errorf("failed to index document %s: %w", document.ID, err)
+		}
+	}
+	return nil
+}
+
+// vector returns the expression of the weighted tsvector of fields of the document and its arguments.
+func (b *PostgresBackend) vector(config string, document Document) (string, []interface{}) {
+	texts := make(map[string]string, len(document.Fields))
+	for _, field := range document.Fields {
+		texts[field.Name] = field.Text
+	}
+	vectors := make([]string, len(b.Fields))
+	args := make([]interface{}, 0, 2*len(b.Fields))
+	for i, field := range b.Fields {
+		vectors[i] = fmt.Sprintf("setweight(to_tsvector(?::regconfig, ?), '%c')", postgresWeights[i])
+		args = append(args, config, texts[field])
+	}
+	return strings.Join(vectors, " || "), args
+}
+
+// analyzer returns the analyzer of the user's indexed documents, or the analyzer of the user's settings
+// if no documents are indexed yet, so all documents of a user are analyzed the same way.
+func (b *PostgresBackend) analyzer(ctx context.Context, db *gorm.DB, usr user.User) (*Analyzer, error) {
+	var names []string
+	err := db.WithContext(ctx).Table(b.Table).
+		Where("user_id = ? AND search_analyzer IS NOT NULL", usr.ID).
+		Limit(1).
+		Pluck("search_analyzer", &names).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find search analyzer: %w", err)
+	}
+	if len(names) == 0 {
+		return userAnalyzer(usr), nil
+	}
+	analyzer, err := NewAnalyzer(names[0])
+	if err != nil {
+		return NewEnglishAnalyzer(), nil
+	}
+	return analyzer, nil
+}
+
+// weights returns weights of lexemes of the field as a "char"[] literal, an empty field means all fields,
+// except scoped ones. It returns false if the field isn't indexed.
+func (b *PostgresBackend) weights(field string) (string, bool) {
+	var weights []string
+	for i, name := range b.Fields {
+		if field == "" && !b.Schema[name].Scoped || field == name {
+			weights = append(weights, string(postgresWeights[i]))
+		}
+	}
+	if len(weights) == 0 {
+		return "", false
+	}
+	return "'{" + strings.Join(weights, ",") + "}'", true
+}
+
+// rankWeights returns ts_rank weights of fields({D,C,B,A}) as a real[] literal, weights are proportional
+// to boosts of fields, so the most boosted field gets 1.
+func (b *PostgresBackend) rankWeights() string {
+	boosts := make([]float64, len(postgresWeights))
+	max := 0.0
+	for i, name := range b.Fields {
+		boosts[i] = 1
+		if boost := b.Schema[name].Boost; boost > 0 {
+			boosts[i] = boost
+		}
+		if boosts[i] > max {
+			max = boosts[i]
+		}
+	}
+	weights := make([]string, len(boosts))
+	for i, boost := range boosts {
+		weights[len(boosts)-1-i] = fmt.Sprintf("%g", boost/max)
+	}
+	return "'{" + strings.Join(weights, ",") + "}'::real[]"
+}
+
+// postgresConfig returns the text search configuration of the analyzer.
+func postgresConfig(analyzer *Analyzer) string {
+	if config, ok := postgresConfigs[analyzer.Name]; ok {
+		return config
+	}
+	return "simple"
+}
+
+// likeEscaper escapes wildcards of LIKE patterns.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// tsEscaper escapes quoted lexemes of tsquery literals.
+var tsEscaper = strings.NewReplacer(`\`, `\\`, `'`, `''`)
+
+// tsLexemes returns a tsquery literal that matches any of the lexemes.
+func tsLexemes(lexemes []string) string {
+	quoted := make([]string, len(lexemes))
+	for i, lexeme := range lexemes {
+		quoted[i] = "'" + tsEscaper.Replace(lexeme) + "'"
+	}
+	return strings.Join(quoted, " | ")
+}
+
+// tsTranslator translates a query to a condition on search vectors of documents.
+// Conditions of positive terms are ranked, their ts_rank expressions are collected in ranks.
+type tsTranslator struct {
+	backend  *PostgresBackend
+	analyzer *Analyzer
+	config   string
+	synonyms Synonyms
+	ranks    []string
+	rankArgs []interface{}
+}
+
+// translate returns the condition of the query and its arguments, false means the query doesn't restrict documents,
+// ex: it consists of stop words only. Terms of negated queries aren't ranked.
+func (t *tsTranslator) translate(q Query, negated bool) (string, []interface{}, bool) {
+	switch q := q.(type) {
+	case *termQuery:
+		var words []string
+		var args []interface{}
+		for _, word := range lowercaseFilter(tokenize(q.text)) {
+			if len(t.analyzer.Analyze(word)) == 0 {
+				continue
+			}
+			alternatives := []string{"plainto_tsquery(?::regconfig, ?)"}
+			args = append(args, t.config, word)
+			for _, synonym := range t.synonyms[word] {
+				alternatives = append(alternatives, "plainto_tsquery(?::regconfig, ?)")
+				args = append(args, t.config, synonym)
+			}
+			words = append(words, "("+strings.Join(alternatives, " || ")+")")
+		}
+		if len(words) == 0 {
+			return "", nil, false
+		}
+		condition, args := t.match(q.field, strings.Join(words, " && "), args, negated)
+		return condition, args, true
+	case *phraseQuery:
+		if len(t.analyzer.Analyze(q.text)) == 0 {
+			return "", nil, false
+		}
+		function := "phraseto_tsquery"
+		if q.within > 0 {
+			function = "plainto_tsquery"
+		}
+		condition, args := t.match(q.field, function+"(?::regconfig, ?)", []interface{}{t.config, q.text}, negated)
+		return condition, args, true
+	case *anyQuery:
+		return t.combine(q.clauses, " OR ", negated)
+	case *andQuery:
+		return t.combine(q.clauses, " AND ", negated)
+	case *orQuery:
+		var conditions []string
+		var args []interface{}
+		for _, clause := range q.clauses {
+			if condition, clauseArgs, ok := t.translate(clause, negated); ok {
+				conditions = append(conditions, condition)
+				args = append(args, clauseArgs...)
+			}
+		}
+		if len(conditions) == 0 {
+			return "", nil, false
+		}
+		return "(" + strings.Join(conditions, " OR ") + ")", args, true
+	case *notQuery:
+		condition, args, ok := t.translate(q.clause, !negated)
+		if !ok {
+			return "", nil, false
+		}
+		return "NOT " + condition, args, true
+	default:
+		return "", nil, false
+	}
+}
+
+// match returns the condition of a tsquery on lexemes of the field, a field that isn't indexed matches nothing.
+func (t *tsTranslator) match(field, tsquery string, args []interface{}, negated bool) (string, []interface{}) {
+	weights, ok := t.backend.weights(field)
+	if !ok {
+		return "FALSE", nil
+	}
+	vector := fmt.Sprintf("ts_filter(search_vector, %s)", weights)
+	if !negated {
+		t.ranks = append(t.ranks, fmt.Sprintf("ts_rank(%s, %s, %s)", t.backend.rankWeights(), vector, tsquery))
+		t.rankArgs = append(t.rankArgs, args...)
+	}
+	return "(" + vector + " @@ " + tsquery + ")", args
+}
+
+// combine joins conditions of positive clauses with the operator and excludes documents that match negated clauses,
+// the same way as combine of queries matched by a UserIndex.
+func (t *tsTranslator) combine(clauses []Query, operator string, negated bool) (string, []interface{}, bool) {
+	var positive, excluded []string
+	var positiveArgs, excludedArgs []interface{}
+	for _, clause := range clauses {
+		if not, ok := clause.(*notQuery); ok {
+			if condition, args, ok := t.translate(not.clause, !negated); ok {
+				excluded = append(excluded, "NOT "+condition)
+				excludedArgs = append(excludedArgs, args...)
+			}
+			continue
+		}
+		if condition, args, ok := t.translate(clause, negated); ok {
+			positive = append(positive, condition)
+			positiveArgs = append(positiveArgs, args...)
+		}
+	}
+
+	var conditions []string
+	if len(positive) > 0 {
+		conditions = append(conditions, "("+strings.Join(positive, operator)+")")
+	}
+	conditions = append(conditions, excluded...)
+	if len(conditions) == 0 {
+		return "", nil, false
+	}
+	return "(" + strings.Join(conditions, " AND ") + ")", append(positiveArgs, excludedArgs...), true
+}
@@ -0,0 +1,760 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Query is a parsed search query. It supports:
+//   - terms, documents that contain any of them are found: quick fox
+//   - AND between clauses requires all of them: fox AND dog
+//   - OR between clauses: fox OR dog
+//   - NOT or minus before a clause excludes documents: fox NOT dog, fox -dog
+//   - quoted phrases, their tokens must be adjacent: "brown fox"
+//   - proximity, tokens must be within N positions from each other: "fox dog"~3
+//   - fuzzy terms with up to N typos: meetng~1, terms of 5 letters and longer are fuzzy by default, ~0 disables it,
+//     negated terms are exact unless fuzziness is given: -meetng~1
+//   - grouping: (fox OR dog) AND -cat
+//   - field queries: title:fox, title:"brown fox", title:(fox OR dog)
+//
+// Operators must be written in upper case, otherwise they're searched as terms.
+type Query interface {
+	// match returns scores of documents that match the query.
+	// nil means the query doesn't restrict documents, ex: it consists of stop words only.
+	match(idx *UserIndex) matches
+}
+
+// matches is a set of matched documents and their scores.
+type matches map[string]float64
+
+// ParseError describes a malformed query and the position(in characters) of the problem.
+type ParseError struct {
+	Pos int
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid query at position %d: %s", e.Pos, e.Msg)
+}
+
+type termQuery struct {
+	text string
+	// field scopes the term to a field of documents, empty field means all fields, except scoped ones.
+	field string
+	// fuzziness is the number of edits allowed in the term, or autoFuzziness.
+	fuzziness int
+}
+
+type phraseQuery struct {
+	text  string
+	field string
+	// within is the maximum distance between tokens of a proximity query, 0 for an exact phrase.
+	within int
+}
+
+// anyQuery is a sequence of clauses without an operator between them.
+type anyQuery struct {
+	clauses []Query
+}
+
+type andQuery struct {
+	clauses []Query
+}
+
+type orQuery struct {
+	clauses []Query
+}
+
+type notQuery struct {
+	clause Query
+}
+
+// ParseQuery parses the query text, see Query for the syntax.
+func ParseQuery(text string) (Query, error) {
+	p := &parser{tokens: lex(text)}
+	if err := p.lexErr(); err != nil {
+		return nil, err
+	}
+	if len(p.tokens) == 1 {
+		return nil, &ParseError{Pos: 0, Msg: "query is empty"}
+	}
+
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != eofToken {
+		return nil, &ParseError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %q", t.text)}
+	}
+	return q, nil
+}
+
+// match of a term also finds documents with synonyms of its words and with similar words,
+// but similar words are ranked lower than exact matches.
+func (q *termQuery) match(idx *UserIndex) matches {
+	tokens := idx.Analyzer.Analyze(q.text)
+	exact := idx.matchWords(idx.queryAnalyzer().AnalyzeSpans(q.text), q.field)
+	distance := fuzziness(q.text, q.fuzziness)
+	if distance == 0 || len(tokens) != 1 {
+		return exact
+	}
+	return withFuzzy(exact, idx.matchFuzzy(q.text, tokens[0], q.field, distance))
+}
+
+// match of a phrase requires its tokens to go one after another in a document,
+// match of a proximity query requires its tokens to be found within the window in any order.
+func (q *phraseQuery) match(idx *UserIndex) matches {
+	tokens := idx.Analyzer.Analyze(q.text)
+	if q.within > 0 {
+		tokens = distinct(tokens)
+	}
+	result := idx.matchTokens(tokens, q.field)
+	if len(tokens) < 2 || len(result) == 0 {
+		return result
+	}
+
+	// Positions of every phrase token in fields of the matched documents
+	positions := make([]map[string]map[string][]int, len(tokens))
+	for i, token := range tokens {
+		positions[i] = make(map[string]map[string][]int, len(result))
+		for _, posting := range idx.Index[token] {
+			if _, ok := result[posting.DocID]; !ok || !idx.searchable(posting.Field, q.field) {
+				continue
+			}
+			if positions[i][posting.DocID] == nil {
+				positions[i][posting.DocID] = map[string][]int{}
+			}
+			positions[i][posting.DocID][posting.Field] = posting.Positions
+		}
+	}
+
+	// The phrase must be found in a single field
+	fieldPositions := make([][]int, len(tokens))
+	for id := range result {
+		found := false
+		for field := range positions[0][id] {
+			for i := range tokens {
+				fieldPositions[i] = positions[i][id][field]
+			}
+			if q.within > 0 {
+				found = withinWindow(fieldPositions, q.within)
+			} else {
+				found = adjacent(fieldPositions)
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			delete(result, id)
+		}
+	}
+	return result
+}
+
+// adjacent reports whether there is a sequence of positions, where i-th position is taken from positions[i].
+func adjacent(positions [][]int) bool {
+	for _, start := range positions[0] {
+		found := true
+		for i := 1; i < len(positions) && found; i++ {
+			j := sort.SearchInts(positions[i], start+i)
+			found = j < len(positions[i]) && positions[i][j] == start+i
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// withinWindow reports whether there are positions of every token(positions[i] belong to the i-th token),
+// which are no farther than window from each other.
+func withinWindow(positions [][]int, window int) bool {
+	type occurrence struct {
+		pos   int
+		token int
+	}
+	var occurrences []occurrence
+	for token, tokenPositions := range positions {
+		for _, pos := range tokenPositions {
+			occurrences = append(occurrences, occurrence{pos: pos, token: token})
+		}
+	}
+	sort.Slice(occurrences, func(i, j int) bool {
+		return occurrences[i].pos < occurrences[j].pos
+	})
+
+	// Slide a window over occurrences, shrinking it from the left while it contains every token
+	counts := make([]int, len(positions))
+	covered, start := 0, 0
+	for _, o := range occurrences {
+		if counts[o.token] == 0 {
+			covered++
+		}
+		counts[o.token]++
+		for covered == len(positions) {
+			first := occurrences[start]
+			if o.pos-first.pos <= window {
+				return true
+			}
+			counts[first.token]--
+			if counts[first.token] == 0 {
+				covered--
+			}
+			start++
+		}
+	}
+	return false
+}
+
+func distinct(tokens []string) []string {
+	seen := make(map[string]struct{}, len(tokens))
+	r := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if _, ok := seen[token]; !ok {
+			seen[token] = struct{}{}
+			r = append(r, token)
+		}
+	}
+	return r
+}
+
+// match of clauses without an operator unites positive clauses and subtracts negated ones.
+func (q *anyQuery) match(idx *UserIndex) matches {
+	return combine(idx, q.clauses, unite)
+}
+
+// match of AND intersects positive clauses and subtracts negated ones.
+func (q *andQuery) match(idx *UserIndex) matches {
+	return combine(idx, q.clauses, intersect)
+}
+
+// match of OR unites clauses, documents matching several clauses get higher scores.
+func (q *orQuery) match(idx *UserIndex) matches {
+	var result matches
+	for _, clause := range q.clauses {
+		m := clause.match(idx)
+		switch {
+		case m == nil:
+			continue
+		case result == nil:
+			result = m
+		default:
+			result = unite(result, m)
+		}
+	}
+	return result
+}
+
+// match of NOT returns all documents that don't match the clause.
+func (q *notQuery) match(idx *UserIndex) matches {
+	m := q.clause.match(idx)
+	if m == nil {
+		return nil
+	}
+	result := idx.allDocuments()
+	for id := range m {
+		delete(result, id)
+	}
+	return result
+}
+
+// matchTokens returns documents that contain all tokens in the field with the sum of tokens scores.
+func (idx *UserIndex) matchTokens(tokens []string, field string) matches {
+	if len(tokens) == 0 {
+		return nil
+	}
+	var result matches
+	seen := map[string]struct{}{}
+	for _, token := range tokens {
+		if _, ok := seen[token]; ok {
+			continue
+		}
+		seen[token] = struct{}{}
+
+		scores := matches(idx.scoreToken(token, field))
+		if len(scores) == 0 {
+			// the token isn't indexed, so no document contains all tokens
+			return matches{}
+		}
+		if result == nil {
+			result = scores
+		} else {
+			result = intersect(result, scores)
+		}
+	}
+	return result
+}
+
+// matchWords returns documents that contain every word in the field. Tokens of the same word(ex: the word and
+// its synonyms) are alternatives, a document matches the word by its best scored alternative.
+func (idx *UserIndex) matchWords(spans []Span, field string) matches {
+	var words [][]string
+	for i, span := range spans {
+		if i > 0 && span.Start == spans[i-1].Start {
+			words[len(words)-1] = append(words[len(words)-1], span.Token)
+			continue
+		}
+		words = append(words, []string{span.Token})
+	}
+	if len(words) == 0 {
+		return nil
+	}
+
+	var result matches
+	seen := map[string]struct{}{}
+	for _, alternatives := range words {
+		key := strings.Join(alternatives, " ")
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		scores := matches{}
+		for _, token := range distinct(alternatives) {
+			for id, score := range idx.scoreToken(token, field) {
+				if score > scores[id] {
+					scores[id] = score
+				}
+			}
+		}
+		if len(scores) == 0 {
+			// no alternative is indexed, so no document contains all words
+			return matches{}
+		}
+		if result == nil {
+			result = scores
+		} else {
+			result = intersect(result, scores)
+		}
+	}
+	return result
+}
+
+// allDocuments returns every indexed document with zero score.
+func (idx *UserIndex) allDocuments() matches {
+	result := make(matches, len(idx.DocLengths))
+	for id := range idx.DocLengths {
+		result[id] = 0
+	}
+	return result
+}
+
+// combine merges matches of positive clauses and removes documents that match negated clauses.
+// If there are only negated clauses, they're removed from all documents.
+func combine(idx *UserIndex, clauses []Query, merge func(a, b matches) matches) matches {
+	var result matches
+	var excluded []matches
+	for _, clause := range clauses {
+		if not, ok := clause.(*notQuery); ok {
+			if m := not.clause.match(idx); m != nil {
+				excluded = append(excluded, m)
+			}
+			continue
+		}
+
+		m := clause.match(idx)
+		switch {
+		case m == nil:
+			continue
+		case result == nil:
+			result = m
+		default:
+			result = merge(result, m)
+		}
+	}
+
+	if len(excluded) == 0 {
+		return result
+	}
+	if result == nil {
+		result = idx.allDocuments()
+	}
+	for _, m := range excluded {
+		for id := range m {
+			delete(result, id)
+		}
+	}
+	return result
+}
+
+// unite returns documents found in any set, scores of documents found in both are summed up.
+func unite(a, b matches) matches {
+	result := make(matches, len(a)+len(b))
+	for id, score := range a {
+		result[id] = score
+	}
+	for id, score := range b {
+		result[id] += score
+	}
+	return result
+}
+
+// intersect returns documents found in both sets, their scores are summed up.
+func intersect(a, b matches) matches {
+	result := matches{}
+	for id, score := range a {
+		if other, ok := b[id]; ok {
+			result[id] = score + other
+		}
+	}
+	return result
+}
+
+type tokenKind int
+
+const (
+	eofToken tokenKind = iota
+	wordToken
+	phraseToken
+	andToken
+	orToken
+	notToken
+	openToken
+	closeToken
+	fieldToken
+	errToken
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// pos is the position of the token in the query, in characters
+	pos int
+	// within is the proximity of a phrase token, or fuzziness of a word token
+	within int
+}
+
+// lex splits the query into tokens, the last token is always either EOF or an error.
+func lex(text string) []token {
+	var tokens []token
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: openToken, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: closeToken, text: ")", pos: i})
+			i++
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]):
+			tokens = append(tokens, token{kind: notToken, text: "-", pos: i})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return append(tokens, token{kind: errToken, text: "unterminated quote", pos: i})
+			}
+			phrase := token{kind: phraseToken, text: string(runes[i+1 : end]), pos: i}
+			i = end + 1
+			if i < len(runes) && runes[i] == '~' {
+				digits := i + 1
+				for digits < len(runes) && unicode.IsDigit(runes[digits]) {
+					digits++
+				}
+				within, err := strconv.Atoi(string(runes[i+1 : digits]))
+				if err != nil || within <= 0 {
+					return append(tokens, token{kind: errToken, text: "expected a positive number after ~", pos: i})
+				}
+				phrase.within = within
+				i = digits
+			}
+			tokens = append(tokens, phrase)
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune(`()"`, runes[end]) {
+				end++
+			}
+			word := string(runes[i:end])
+			if field, ok := fieldName(word); ok {
+				tokens = append(tokens, token{kind: fieldToken, text: field, pos: i})
+				i += utf8.RuneCountInString(field) + 1
+				continue
+			}
+			t := token{kind: wordToken, text: word, pos: i, within: autoFuzziness}
+			switch word {
+			case "AND":
+				t.kind = andToken
+			case "OR":
+				t.kind = orToken
+			case "NOT":
+				t.kind = notToken
+			}
+			if tilde := strings.IndexRune(word, '~'); tilde >= 0 {
+				tildePos := i + utf8.RuneCountInString(word[:tilde])
+				edits, ok := parseFuzziness(word[tilde+1:])
+				if tilde == 0 || !ok {
+					return append(tokens, token{kind: errToken, text: "expected a word followed by ~ and a number from 0 to 2", pos: tildePos})
+				}
+				t.text, t.within = word[:tilde], edits
+			}
+			tokens = append(tokens, t)
+			i = end
+		}
+	}
+	return append(tokens, token{kind: eofToken, text: "end of query", pos: len(runes)})
+}
+
+// fieldName returns the field of a field query, ex: title of title:fox.
+// Field names consist of letters, digits and underscores and start with a letter.
+func fieldName(word string) (string, bool) {
+	colon := strings.IndexRune(word, ':')
+	if colon <= 0 {
+		return "", false
+	}
+	for i, r := range word[:colon] {
+		if !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r) && r != '_') {
+			return "", false
+		}
+	}
+	return strings.ToLower(word[:colon]), true
+}
+
+// checkFields returns *ParseError if the query has a field query of a field that isn't in the schema,
+// ex: a misspelled field, that would find nothing.
+func checkFields(text string, schema Schema) error {
+	for _, t := range lex(text) {
+		if t.kind != fieldToken {
+			continue
+		}
+		if _, ok := schema[t.text]; !ok {
+			msg := fmt.Sprintf("unknown field %q, known fields: %s", t.text, strings.Join(sortedNames(schema), ", "))
+			return &ParseError{Pos: t.pos, Msg: msg}
+		}
+	}
+	return nil
+}
+
+// parseFuzziness parses the number after ~ of a fuzzy term, no number means the maximum fuzziness.
+func parseFuzziness(s string) (int, bool) {
+	if s == "" {
+		return maxFuzziness, true
+	}
+	edits, err := strconv.Atoi(s)
+	if err != nil || edits < 0 || edits > maxFuzziness {
+		return 0, false
+	}
+	return edits, true
+}
+
+// clauses returns clauses of a compound query, nil for terms and phrases.
+func clauses(q Query) []Query {
+	switch q := q.(type) {
+	case *anyQuery:
+		return q.clauses
+	case *andQuery:
+		return q.clauses
+	case *orQuery:
+		return q.clauses
+	case *notQuery:
+		return []Query{q.clause}
+	default:
+		return nil
+	}
+}
+
+// negated reports whether the query has a negated clause.
+func negated(q Query) bool {
+	if _, ok := q.(*notQuery); ok {
+		return true
+	}
+	for _, clause := range clauses(q) {
+		if negated(clause) {
+			return true
+		}
+	}
+	return false
+}
+
+// scope restricts terms and phrases of the query to the field, unless they're scoped to another field already.
+func scope(q Query, field string) Query {
+	switch q := q.(type) {
+	case *termQuery:
+		if q.field == "" {
+			q.field = field
+		}
+	case *phraseQuery:
+		if q.field == "" {
+			q.field = field
+		}
+	case *anyQuery:
+		for _, clause := range q.clauses {
+			scope(clause, field)
+		}
+	case *andQuery:
+		for _, clause := range q.clauses {
+			scope(clause, field)
+		}
+	case *orQuery:
+		for _, clause := range q.clauses {
+			scope(clause, field)
+		}
+	case *notQuery:
+		scope(q.clause, field)
+	}
+	return q
+}
+
+// exact disables automatic fuzziness of terms of a negated query, so documents with words similar to an excluded
+// term aren't excluded. Fuzziness given explicitly, ex: -meetng~1, is kept.
+func exact(q Query) Query {
+	if term, ok := q.(*termQuery); ok && term.fuzziness == autoFuzziness {
+		term.fuzziness = 0
+	}
+	for _, clause := range clauses(q) {
+		exact(clause)
+	}
+	return q
+}
+
+// parser is a recursive descent parser of the grammar:
+//
+//	or      = any { "OR" any }
+//	any     = and { and }
+//	and     = unary { "AND" unary }
+//	unary   = ( "NOT" | "-" ) unary | primary
+//	primary = field ":" primary | "(" or ")" | phrase [ "~" number ] | word [ "~" [ number ] ]
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if p.pos < len(p.tokens)-1 {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) lexErr() error {
+	last := p.tokens[len(p.tokens)-1]
+	if last.kind == errToken {
+		return &ParseError{Pos: last.pos, Msg: last.text}
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (Query, error) {
+	clauses, err := p.parseSeq(p.parseAny, orToken)
+	if err != nil {
+		return nil, err
+	}
+	if len(clauses) == 1 {
+		return clauses[0], nil
+	}
+	return &orQuery{clauses: clauses}, nil
+}
+
+func (p *parser) parseAny() (Query, error) {
+	clause, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	clauses := []Query{clause}
+	for p.startsClause() {
+		clause, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+	if len(clauses) == 1 {
+		return clauses[0], nil
+	}
+	return &anyQuery{clauses: clauses}, nil
+}
+
+func (p *parser) parseAnd() (Query, error) {
+	clauses, err := p.parseSeq(p.parseUnary, andToken)
+	if err != nil {
+		return nil, err
+	}
+	if len(clauses) == 1 {
+		return clauses[0], nil
+	}
+	return &andQuery{clauses: clauses}, nil
+}
+
+// parseSeq parses clauses separated by the operator.
+func (p *parser) parseSeq(parse func() (Query, error), operator tokenKind) ([]Query, error) {
+	clause, err := parse()
+	if err != nil {
+		return nil, err
+	}
+	clauses := []Query{clause}
+	for p.peek().kind == operator {
+		p.next()
+		clause, err := parse()
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+	return clauses, nil
+}
+
+// startsClause reports whether the next token can start a clause.
+func (p *parser) startsClause() bool {
+	switch p.peek().kind {
+	case wordToken, phraseToken, notToken, openToken, fieldToken:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *parser) parseUnary() (Query, error) {
+	if p.peek().kind == notToken {
+		p.next()
+		clause, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notQuery{clause: exact(clause)}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Query, error) {
+	t := p.next()
+	switch t.kind {
+	case wordToken:
+		return &termQuery{text: t.text, fuzziness: t.within}, nil
+	case phraseToken:
+		return &phraseQuery{text: t.text, within: t.within}, nil
+	case openToken:
+		q, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != closeToken {
+			return nil, &ParseError{Pos: t.pos, Msg: "unmatched parenthesis"}
+		}
+		return q, nil
+	case fieldToken:
+		q, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return scope(q, t.text), nil
+	case errToken:
+		return nil, &ParseError{Pos: t.pos, Msg: t.text}
+	default:
+		return nil, &ParseError{Pos: t.pos, Msg: fmt.Sprintf("expected a term, got %q", t.text)}
+	}
+}
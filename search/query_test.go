@@ -0,0 +1,80 @@
+package search
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantErr bool
+		wantPos int
+	}{
+		{name: "terms", query: "quick fox"},
+		{name: "operators", query: `(quick OR lazy) AND fox NOT "brown dog" -cat`},
+		{name: "lower case operators are terms", query: "fox and dog"},
+		{name: "hyphenated word", query: "e-mail"},
+		{name: "proximity", query: `"deploy staging"~3 OR fox`},
+		{name: "fuzzy terms", query: "meetng~1 OR stagign~"},
+		{name: "field queries", query: `title:invoice description:"release notes" title:(fox OR dog~1) -status:archived`},
+		{name: "field without a term", query: "fox title:", wantErr: true, wantPos: 10},
+		{name: "too fuzzy", query: "fox meetng~3", wantErr: true, wantPos: 10},
+		{name: "fuzziness without a word", query: "~1", wantErr: true, wantPos: 0},
+		{name: "empty", query: "  ", wantErr: true, wantPos: 0},
+		{name: "unterminated quote", query: `fox "brown dog`, wantErr: true, wantPos: 4},
+		{name: "proximity without distance", query: `"deploy staging"~ fox`, wantErr: true, wantPos: 16},
+		{name: "zero proximity", query: `"deploy staging"~0`, wantErr: true, wantPos: 16},
+		{name: "unmatched parenthesis", query: "(fox OR dog", wantErr: true, wantPos: 0},
+		{name: "unexpected closing parenthesis", query: "fox)", wantErr: true, wantPos: 3},
+		{name: "missing operand", query: "fox AND", wantErr: true, wantPos: 7},
+		{name: "operator without left operand", query: "OR fox", wantErr: true, wantPos: 0},
+		{name: "empty group", query: "fox ()", wantErr: true, wantPos: 5},
+		{name: "position in characters", query: "ёжик AND", wantErr: true, wantPos: 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseQuery(tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				return
+			}
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("ParseQuery() error = %v, want *ParseError", err)
+			}
+			if parseErr.Pos != tt.wantPos {
+				t.Errorf("ParseQuery() error position = %d, want %d", parseErr.Pos, tt.wantPos)
+			}
+		})
+	}
+}
+
+func Test_checkFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantErr bool
+		wantPos int
+	}{
+		{name: "known fields", query: `title:invoice status:(created OR finished)`},
+		{name: "field names are case insensitive", query: "Title:invoice"},
+		{name: "misspelled field", query: "fox -titel:invoice", wantErr: true, wantPos: 5},
+		{name: "colon inside a phrase", query: `"titel:invoice"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkFields(tt.query, backendSchema)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkFields() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var parseErr *ParseError
+			if tt.wantErr && (!errors.As(err, &parseErr) || parseErr.Pos != tt.wantPos) {
+				t.Errorf("checkFields() error = %v, want *ParseError at position %d", err, tt.wantPos)
+			}
+		})
+	}
+}
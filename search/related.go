@@ -0,0 +1,111 @@
+package search
+
+import (
+	"math"
+	"sort"
+)
+
+// relatedCandidates is the number of documents sharing the most weighted tokens with a document
+// whose whole vectors are loaded to compute their similarity to it.
+const relatedCandidates = 50
+
+// termVector maps tokens of a document to their frequencies, frequencies of tokens of fields are multiplied
+// by boosts of the fields. Tokens of scoped fields aren't in vectors.
+type termVector map[string]float64
+
+// similar returns up to limit candidates most similar to the vector by cosine similarity of their TF-IDF vectors,
+// scores are from 0 to 1 and the most similar candidates go first. Candidates without common tokens are skipped.
+// n is the number of documents and df is the number of documents that contain each token.
+func similar(vector termVector, candidates map[string]termVector, df map[string]int, n, limit int) []Hit {
+	idf := func(token string) float64 {
+		return inverseFrequency(n, df[token])
+	}
+	weights := make(map[string]float64, len(vector))
+	norm := 0.0
+	for token, tf := range vector {
+		weights[token] = tf * idf(token)
+		norm += weights[token] * weights[token]
+	}
+
+	hits := []Hit{}
+	if norm == 0 {
+		return hits
+	}
+	for id, candidate := range candidates {
+		dot, candidateNorm := 0.0, 0.0
+		for token, tf := range candidate {
+			weight := tf * idf(token)
+			dot += weight * weights[token]
+			candidateNorm += weight * weight
+		}
+		if dot == 0 {
+			continue
+		}
+		hits = append(hits, Hit{ID: id, Score: math.Min(dot/math.Sqrt(norm*candidateNorm), 1)})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// inverseFrequency returns the IDF of a token contained in df of n documents. It's smoothed,
+// so a token that no document contains, ex: a token of a new document, doesn't divide by zero.
+func inverseFrequency(n, df int) float64 {
+	return math.Log(float64(1+n)/float64(1+df)) + 1
+}
+
+// vectors returns term vectors of documents of the index postings, postings of scoped fields are skipped.
+func (idx *UserIndex) vectors() map[string]termVector {
+	vectors := map[string]termVector{}
+	for token, postings := range idx.Index {
+		for _, posting := range postings {
+			if !idx.searchable(posting.Field, "") {
+				continue
+			}
+			vector, ok := vectors[posting.DocID]
+			if !ok {
+				vector = termVector{}
+				vectors[posting.DocID] = vector
+			}
+			vector[token] += idx.boost(posting.Field) * float64(posting.TF)
+		}
+	}
+	return vectors
+}
+
+// frequencies returns the number of vectors that contain each token.
+func frequencies(vectors map[string]termVector) map[string]int {
+	df := map[string]int{}
+	for _, vector := range vectors {
+		for token := range vector {
+			df[token]++
+		}
+	}
+	return df
+}
+
+// closest returns IDs of up to limit candidates with the largest dot products with the vector,
+// it's used to choose candidates before their whole vectors are loaded.
+func closest(dots map[string]float64, limit int) []string {
+	ids := make([]string, 0, len(dots))
+	for id := range dots {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if dots[ids[i]] != dots[ids[j]] {
+			return dots[ids[i]] > dots[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	return ids
+}
@@ -0,0 +1,38 @@
+package search
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestSimilar(t *testing.T) {
+	vector := termVector{"releas": 2, "note": 1}
+	candidates := map[string]termVector{
+		"copy":      {"releas": 2, "note": 1},
+		"scaled":    {"releas": 4, "note": 2},
+		"partial":   {"releas": 1, "process": 3},
+		"unrelated": {"bug": 1},
+	}
+	df := map[string]int{"releas": 3, "note": 2, "process": 1, "bug": 1}
+
+	hits := similar(vector, candidates, df, 4, 0)
+	if got, want := IDs(hits), []string{"copy", "scaled", "partial"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("similar() = %v, want %v", got, want)
+	}
+	for _, hit := range hits[:2] {
+		if math.Abs(hit.Score-1) > 1e-9 {
+			t.Errorf("similar() score of %s = %v, want 1", hit.ID, hit.Score)
+		}
+	}
+	if hits[2].Score <= 0 || hits[2].Score >= 1 {
+		t.Errorf("similar() score of partial = %v, want between 0 and 1", hits[2].Score)
+	}
+
+	if got := similar(termVector{}, candidates, df, 4, 0); len(got) != 0 {
+		t.Errorf("similar() of an empty vector = %v, want no hits", got)
+	}
+	if got := IDs(similar(vector, candidates, df, 4, 1)); !reflect.DeepEqual(got, []string{"copy"}) {
+		t.Errorf("similar() with limit 1 = %v, want [copy]", got)
+	}
+}
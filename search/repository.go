@@ -2,27 +2,110 @@ package search
 
 import "context"
 
-// UserIndexRepository is a repository for each user's search index.
+// UserIndexRepository is a repository for each user's search index. Indexes are stored by tokens, so inserting
+// or deleting a document touches only lists of its tokens, and a search loads only postings of its tokens.
 type UserIndexRepository interface {
+	// Find returns the user's index with its stats but without documents, they're loaded by the Find* methods
+	// on demand.
 	Find(ctx context.Context, userID uint) (*UserIndex, error)
-	Update(ctx context.Context, userIndex *UserIndex) error
+	// FindDocLengths returns lengths of fields of the user's documents by IDs, all documents if docIDs is nil.
+	FindDocLengths(ctx context.Context, userID uint, docIDs []string) (map[string]map[string]int, error)
+	// FindPostings returns postings of the tokens.
+	FindPostings(ctx context.Context, userID uint, tokens []string) (Index, error)
+	FindTerms(ctx context.Context, userID uint, filter TermFilter) (Terms, error)
+	// FindDocTokens returns tokens of the user's documents by IDs of the documents.
+	FindDocTokens(ctx context.Context, userID uint, docIDs []string) (map[string][]string, error)
 	Create(ctx context.Context, userIndex *UserIndex) error
+	// Update replaces the whole index of the user with the index.
+	Update(ctx context.Context, userIndex *UserIndex) error
+	// Insert adds documents of the index to the user's index, documents that are indexed already are replaced.
+	Insert(ctx context.Context, userIndex *UserIndex) error
+	Delete(ctx context.Context, userID uint, docIDs ...string) error
+}
+
+// TermFilter selects terms of an index, zero fields don't restrict terms.
+type TermFilter struct {
+	Prefix string
+	// MinLength and MaxLength limit the number of letters of words.
+	MinLength int
+	MaxLength int
 }
 
 type MockUserIndexRepository struct {
-	FindFn   func(ctx context.Context, userID uint) (*UserIndex, error)
-	UpdateFn func(ctx context.Context, userIndex *UserIndex) error
-	CreateFn func(ctx context.Context, userIndex *UserIndex) error
+	FindFn           func(ctx context.Context, userID uint) (*UserIndex, error)
+	FindDocLengthsFn func(ctx context.Context, userID uint, docIDs []string) (map[string]map[string]int, error)
+	FindPostingsFn   func(ctx context.Context, userID uint, tokens []string) (Index, error)
+	FindTermsFn      func(ctx context.Context, userID uint, filter TermFilter) (Terms, error)
+	FindDocTokensFn  func(ctx context.Context, userID uint, docIDs []string) (map[string][]string, error)
+	CreateFn         func(ctx context.Context, userIndex *UserIndex) error
+	UpdateFn         func(ctx context.Context, userIndex *UserIndex) error
+	InsertFn         func(ctx context.Context, userIndex *UserIndex) error
+	DeleteFn         func(ctx context.Context, userID uint, docIDs ...string) error
 }
 
 func (m MockUserIndexRepository) Find(ctx context.Context, userID uint) (*UserIndex, error) {
 	return m.FindFn(ctx, userID)
 }
 
-func (m MockUserIndexRepository) Update(ctx context.Context, userIndex *UserIndex) error {
-	return m.UpdateFn(ctx, userIndex)
+func (m MockUserIndexRepository) FindDocLengths(ctx context.Context, userID uint, docIDs []string) (map[string]map[string]int, error) {
+	return m.FindDocLengthsFn(ctx, userID, docIDs)
+}
+
+func (m MockUserIndexRepository) FindPostings(ctx context.Context, userID uint, tokens []string) (Index, error) {
+	return m.FindPostingsFn(ctx, userID, tokens)
+}
+
+func (m MockUserIndexRepository) FindTerms(ctx context.Context, userID uint, filter TermFilter) (Terms, error) {
+	return m.FindTermsFn(ctx, userID, filter)
+}
+
+func (m MockUserIndexRepository) FindDocTokens(ctx context.Context, userID uint, docIDs []string) (map[string][]string, error) {
+	return m.FindDocTokensFn(ctx, userID, docIDs)
 }
 
 func (m MockUserIndexRepository) Create(ctx context.Context, userIndex *UserIndex) error {
 	return m.CreateFn(ctx, userIndex)
 }
+
+func (m MockUserIndexRepository) Update(ctx context.Context, userIndex *UserIndex) error {
+	return m.UpdateFn(ctx, userIndex)
+}
+
+func (m MockUserIndexRepository) Insert(ctx context.Context, userIndex *UserIndex) error {
+	return m.InsertFn(ctx, userIndex)
+}
+
+func (m MockUserIndexRepository) Delete(ctx context.Context, userID uint, docIDs ...string) error {
+	return m.DeleteFn(ctx, userID, docIDs...)
+}
+
+// SynonymRepository is a repository for users' synonym sets.
+type SynonymRepository interface {
+	FindAll(ctx context.Context, userID uint) ([]*SynonymSet, error)
+	Create(ctx context.Context, set *SynonymSet) (*SynonymSet, error)
+	Update(ctx context.Context, userID uint, set *SynonymSet) error
+	Delete(ctx context.Context, userID uint, id string) error
+}
+
+type MockSynonymRepository struct {
+	FindAllFn func(ctx context.Context, userID uint) ([]*SynonymSet, error)
+	CreateFn  func(ctx context.Context, set *SynonymSet) (*SynonymSet, error)
+	UpdateFn  func(ctx context.Context, userID uint, set *SynonymSet) error
+	DeleteFn  func(ctx context.Context, userID uint, id string) error
+}
+
+func (m MockSynonymRepository) FindAll(ctx context.Context, userID uint) ([]*SynonymSet, error) {
+	return m.FindAllFn(ctx, userID)
+}
+
+func (m MockSynonymRepository) Create(ctx context.Context, set *SynonymSet) (*SynonymSet, error) {
+	return m.CreateFn(ctx, set)
+}
+
+func (m MockSynonymRepository) Update(ctx context.Context, userID uint, set *SynonymSet) error {
+	return m.UpdateFn(ctx, userID, set)
+}
+
+func (m MockSynonymRepository) Delete(ctx context.Context, userID uint, id string) error {
+	return m.DeleteFn(ctx, userID, id)
+}
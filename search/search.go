@@ -1,73 +1,262 @@
 package search
 
 import (
-	"golang.org/x/exp/slices"
+	"math"
+	"sort"
 	"time"
 )
 
-// Document is a searchable document
+// BM25 parameters: k1 limits how much repeated tokens raise the score, b controls document length normalization.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Document is a searchable document. Its fields are indexed separately, so queries can be scoped to a field.
 type Document struct {
-	ID      string `json:"id"`
-	Content string `json:"content"`
+	ID     string  `json:"id"`
+	Fields []Field `json:"fields"`
+}
+
+// Field is a named text of a document, ex: title.
+type Field struct {
+	Name string `json:"name"`
+	Text string `json:"text"`
+}
+
+// FieldOptions configure how a field is searched.
+type FieldOptions struct {
+	// Boost multiplies the weight of the field's matches, it's 1 by default.
+	Boost float64
+	// Scoped fields are searched only by field queries(ex: status:finished) and aren't suggested.
+	Scoped bool
 }
 
-// Index is an inverted index of token -> list of document IDs which contain the token
-type Index map[string][]string
+// Schema configures search over fields of documents, fields that aren't in the schema use default options.
+// Service rejects field queries of fields that aren't in the schema, so the schema should list all fields.
+type Schema map[string]FieldOptions
+
+// Posting is an occurrence of a token in a field of a document.
+type Posting struct {
+	DocID string `json:"id"`
+	Field string `json:"f"`
+	// TF is the number of times the token occurs in the field.
+	TF int `json:"tf"`
+	// Positions are ascending positions of the token among the field tokens, they're used to match phrases.
+	// Positions are counted after analysis, so stop words don't separate tokens.
+	Positions []int `json:"pos"`
+}
+
+// Index is an inverted index of token -> list of postings of documents which contain the token
+type Index map[string][]Posting
+
+// documentIDs returns sorted IDs of documents in the postings.
+func (i Index) documentIDs() []string {
+	seen := map[string]struct{}{}
+	ids := []string{}
+	for _, postings := range i {
+		for _, posting := range postings {
+			if _, ok := seen[posting.DocID]; !ok {
+				seen[posting.DocID] = struct{}{}
+				ids = append(ids, posting.DocID)
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Hit is a document that matched a search query and its relevance score.
+type Hit struct {
+	ID    string  `json:"id"`
+	Score float64 `json:"score"`
+	// Tokens are tokens of the query found in the document, they're used to highlight matched words.
+	Tokens []string `json:"tokens,omitempty"`
+}
 
 // UserIndex contains an inverted index of a user's documents and analyzer used to tokenize documents
 type UserIndex struct {
-	UserID    uint      `json:"user_id"`
-	Index     Index     `json:"index"`
-	Analyzer  *Analyzer `json:"analyzer"`
+	UserID uint  `json:"user_id"`
+	Index  Index `json:"index"`
+	// DocLengths is the number of tokens in each field of indexed documents, it's used to normalize scores.
+	DocLengths map[string]map[string]int `json:"doc_lengths"`
+	// Stats are totals of all documents of the index, they're set by repositories that load DocLengths
+	// of only some documents. Without stats they're computed from DocLengths.
+	Stats *IndexStats `json:"-"`
+	// Terms is a dictionary of words of the documents, it's used for suggestions.
+	Terms    Terms     `json:"terms"`
+	Analyzer *Analyzer `json:"analyzer"`
+	// Schema isn't stored with the index, it's set by the service.
+	Schema Schema `json:"-"`
+	// Synonyms are expanded in queries, they aren't stored with the index and are set by the service.
+	Synonyms  Synonyms `json:"-"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
-// Insert adds a document to the user index
+// IndexStats are the number of documents of an index and summed lengths of their fields.
+type IndexStats struct {
+	DocCount     int
+	FieldLengths map[string]int
+}
+
+// newIndexStats sums up lengths of the documents.
+func newIndexStats(docLengths map[string]map[string]int) *IndexStats {
+	stats := &IndexStats{FieldLengths: map[string]int{}}
+	for _, lengths := range docLengths {
+		stats.add(lengths, 1)
+	}
+	return stats
+}
+
+// add adds lengths of a document to the stats, a negative sign removes them.
+func (s *IndexStats) add(lengths map[string]int, sign int) {
+	s.DocCount += sign
+	for field, length := range lengths {
+		s.FieldLengths[field] += sign * length
+		if s.FieldLengths[field] <= 0 {
+			delete(s.FieldLengths, field)
+		}
+	}
+}
+
+// Insert adds a document to the user index, a document that's indexed already is replaced.
 func (idx *UserIndex) Insert(document Document) {
-	// Split document content into tokens
 	if idx.Analyzer == nil {
 		idx.Analyzer = NewEnglishAnalyzer()
 	}
-	tokens := idx.Analyzer.Analyze(document.Content)
+	if idx.DocLengths == nil {
+		idx.DocLengths = map[string]map[string]int{}
+	}
+	if _, ok := idx.DocLengths[document.ID]; ok {
+		idx.purge(document.ID)
+	}
 
-	// Insert document ID to each token's
-	for _, token := range tokens {
-		ids, ok := idx.Index[token]
-		if !ok {
-			ids = []string{}
+	lengths := make(map[string]int, len(document.Fields))
+	for _, field := range document.Fields {
+		// Split field text into tokens
+		tokens := idx.Analyzer.Analyze(field.Text)
+		lengths[field.Name] = len(tokens)
+		if !idx.Schema[field.Name].Scoped {
+			for _, word := range idx.words(field.Text) {
+				idx.Terms.add(word, document.ID)
+			}
 		}
-		if slices.Contains(ids, document.ID) {
-			continue
+
+		// Collect positions of each token in the field
+		positions := map[string][]int{}
+		for i, token := range tokens {
+			positions[token] = append(positions[token], i)
+		}
+
+		// Insert field posting to each token's list
+		for token, pos := range positions {
+			idx.Index[token] = append(idx.Index[token], Posting{DocID: document.ID, Field: field.Name, TF: len(pos), Positions: pos})
 		}
-		idx.Index[token] = append(ids, document.ID)
 	}
+	idx.DocLengths[document.ID] = lengths
 }
 
-// Search returns a list of document IDs which contain all tokens in the query
-func (idx *UserIndex) Search(text string) []string {
-	// Split query into tokens
+// Search returns a list of documents that match the query, the most relevant documents go first.
+// Documents are ranked by BM25F: term frequencies of fields are weighted by boosts of the fields.
+func (idx *UserIndex) Search(query Query) []Hit {
 	if idx.Analyzer == nil {
 		idx.Analyzer = NewEnglishAnalyzer()
 	}
-	// analyzer search query
-	tokens := idx.Analyzer.Analyze(text)
+	hits := rank(query.match(idx))
+	idx.matchedTokens(hits, query)
+	return hits
+}
+
+// queryAnalyzer returns the analyzer of query terms, it adds synonyms of analyzed tokens.
+func (idx *UserIndex) queryAnalyzer() *Analyzer {
+	if len(idx.Synonyms) == 0 {
+		return idx.Analyzer
+	}
+	filters := make([]Filter, 0, len(idx.Analyzer.Filters)+1)
+	filters = append(filters, idx.Analyzer.Filters...)
+	filters = append(filters, SynonymFilter(idx.Synonyms.Analyze(idx.Analyzer)))
+	return &Analyzer{Name: idx.Analyzer.Name, Filters: filters, Tokenizer: idx.Analyzer.Tokenizer}
+}
 
-	// Get deduplicated document IDs for each token
-	set := map[string]struct{}{}
-	for _, token := range tokens {
-		for _, id := range idx.Index[token] {
-			set[id] = struct{}{}
+// scoreToken returns BM25F scores of the token for every document that contains it in the field.
+// An empty field means all fields, except scoped ones.
+func (idx *UserIndex) scoreToken(token, field string) map[string]float64 {
+	// Sum up normalized and boosted frequencies of the token in fields of each document
+	frequencies := map[string]float64{}
+	avgLengths := map[string]float64{}
+	for _, posting := range idx.Index[token] {
+		if !idx.searchable(posting.Field, field) {
+			continue
 		}
+		avgLength, ok := avgLengths[posting.Field]
+		if !ok {
+			avgLength = idx.avgFieldLength(posting.Field)
+			avgLengths[posting.Field] = avgLength
+		}
+		norm := 1.0
+		if avgLength > 0 {
+			norm = 1 - bm25B + bm25B*float64(idx.DocLengths[posting.DocID][posting.Field])/avgLength
+		}
+		frequencies[posting.DocID] += idx.boost(posting.Field) * float64(posting.TF) / norm
+	}
+	if len(frequencies) == 0 {
+		return nil
 	}
 
-	// Convert set to slice
-	var ids []string
-	for k := range set {
-		ids = append(ids, k)
+	n := float64(idx.docCount())
+	df := float64(len(frequencies))
+	if n < df {
+		// documents indexed without lengths, ex: an index built by an older version
+		n = df
 	}
+	idf := math.Log(1 + (n-df+0.5)/(df+0.5))
 
-	return ids
+	scores := make(map[string]float64, len(frequencies))
+	for id, tf := range frequencies {
+		scores[id] = idf * tf * (bm25K1 + 1) / (tf + bm25K1)
+	}
+	return scores
+}
+
+// searchable reports whether postings of the field are searched by a query scoped to the queryField.
+func (idx *UserIndex) searchable(field, queryField string) bool {
+	if queryField == "" {
+		return !idx.Schema[field].Scoped
+	}
+	return field == queryField
+}
+
+func (idx *UserIndex) boost(field string) float64 {
+	if boost := idx.Schema[field].Boost; boost > 0 {
+		return boost
+	}
+	return 1
+}
+
+func (idx *UserIndex) avgFieldLength(field string) float64 {
+	if idx.Stats != nil {
+		if idx.Stats.DocCount <= 0 {
+			return 0
+		}
+		return float64(idx.Stats.FieldLengths[field]) / float64(idx.Stats.DocCount)
+	}
+	if len(idx.DocLengths) == 0 {
+		return 0
+	}
+	total := 0
+	for _, lengths := range idx.DocLengths {
+		total += lengths[field]
+	}
+	return float64(total) / float64(len(idx.DocLengths))
+}
+
+// docCount returns the number of documents of the index.
+func (idx *UserIndex) docCount() int {
+	if idx.Stats != nil {
+		return idx.Stats.DocCount
+	}
+	return len(idx.DocLengths)
 }
 
 // Delete searches for a document occurrences in the index and removes it
@@ -75,29 +264,101 @@ func (idx *UserIndex) Delete(document Document) {
 	if idx.Analyzer == nil {
 		idx.Analyzer = NewEnglishAnalyzer()
 	}
-	// Split document content into tokens
-	tokens := idx.Analyzer.Analyze(document.Content)
+	delete(idx.DocLengths, document.ID)
 
-	// Search for all tokens that document contain
-	for _, token := range tokens {
-		ids, ok := idx.Index[token]
-		if !ok {
-			continue
+	for _, field := range document.Fields {
+		for _, word := range idx.words(field.Text) {
+			idx.Terms.remove(word, document.ID)
 		}
-		// And remove document ID from token's list
-		for i, id := range ids {
-			if id == document.ID {
-				ids = append(ids[:i], ids[i+1:]...)
-				break
+
+		// Search for all tokens that the field contains
+		for _, token := range idx.Analyzer.Analyze(field.Text) {
+			postings, ok := idx.Index[token]
+			if !ok {
+				continue
+			}
+			// And remove field posting from token's list
+			if i := findPosting(postings, document.ID, field.Name); i >= 0 {
+				postings = append(postings[:i], postings[i+1:]...)
+			}
+
+			if len(postings) == 0 {
+				// if token has no more documents associated, remove it from index
+				delete(idx.Index, token)
+			} else {
+				idx.Index[token] = postings
 			}
 		}
+	}
+}
 
-		if len(ids) == 0 {
-			// if token has no more documents associated, remove it from index
+// purge removes all postings of a document, unlike Delete it doesn't need the document content.
+func (idx *UserIndex) purge(docID string) {
+	idx.Terms.purge(docID)
+	for token, postings := range idx.Index {
+		kept := postings[:0]
+		for _, posting := range postings {
+			if posting.DocID != docID {
+				kept = append(kept, posting)
+			}
+		}
+		if len(kept) == 0 {
 			delete(idx.Index, token)
-		} else {
-			idx.Index[token] = ids
+			continue
+		}
+		idx.Index[token] = kept
+	}
+}
+
+// DocumentIDs returns sorted IDs of indexed documents. Documents are collected from postings too,
+// so a document whose length was deleted, but postings weren't, is still reported.
+func (idx *UserIndex) DocumentIDs() []string {
+	seen := make(map[string]struct{}, len(idx.DocLengths))
+	for id := range idx.DocLengths {
+		seen[id] = struct{}{}
+	}
+	for _, postings := range idx.Index {
+		for _, posting := range postings {
+			seen[posting.DocID] = struct{}{}
+		}
+	}
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// IDs returns document IDs of the hits in the same order.
+func IDs(hits []Hit) []string {
+	ids := make([]string, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+	return ids
+}
+
+// rank sorts documents by score, documents with equal score are sorted by ID to keep the order stable.
+func rank(scores map[string]float64) []Hit {
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
 		}
+		return hits[i].ID < hits[j].ID
+	})
+	return hits
+}
 
+func findPosting(postings []Posting, docID, field string) int {
+	for i, posting := range postings {
+		if posting.DocID == docID && posting.Field == field {
+			return i
+		}
 	}
+	return -1
 }
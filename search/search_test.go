@@ -11,56 +11,75 @@ func TestUserIndex_Add(t *testing.T) {
 		userIndex UserIndex
 		inputDocs []Document
 		wantIndex Index
+		// wantDocLengths is checked only when set
+		wantDocLengths map[string]map[string]int
 	}{
 		{
 			name:      "add 1 document",
 			userIndex: UserIndex{Index: Index{}},
 			inputDocs: []Document{
-				{ID: "1", Content: "Did I hear it right? Did the quick brown fox jump over the lazy dog?"},
+				textDocument("1", "Did I hear it right? Did the quick brown fox jump over the lazy dog?"),
 			},
 			wantIndex: Index{
-				"did":   []string{"1"},
-				"brown": []string{"1"},
-				"dog":   []string{"1"},
-				"fox":   []string{"1"},
-				"hear":  []string{"1"},
-				"it":    []string{"1"},
-				"jump":  []string{"1"},
-				"lazi":  []string{"1"},
-				"over":  []string{"1"},
-				"quick": []string{"1"},
-				"right": []string{"1"},
+				"did":   []Posting{{DocID: "1", Field: "content", TF: 2, Positions: []int{0, 4}}},
+				"brown": []Posting{{DocID: "1", Field: "content", TF: 1, Positions: []int{6}}},
+				"dog":   []Posting{{DocID: "1", Field: "content", TF: 1, Positions: []int{11}}},
+				"fox":   []Posting{{DocID: "1", Field: "content", TF: 1, Positions: []int{7}}},
+				"hear":  []Posting{{DocID: "1", Field: "content", TF: 1, Positions: []int{1}}},
+				"it":    []Posting{{DocID: "1", Field: "content", TF: 1, Positions: []int{2}}},
+				"jump":  []Posting{{DocID: "1", Field: "content", TF: 1, Positions: []int{8}}},
+				"lazi":  []Posting{{DocID: "1", Field: "content", TF: 1, Positions: []int{10}}},
+				"over":  []Posting{{DocID: "1", Field: "content", TF: 1, Positions: []int{9}}},
+				"quick": []Posting{{DocID: "1", Field: "content", TF: 1, Positions: []int{5}}},
+				"right": []Posting{{DocID: "1", Field: "content", TF: 1, Positions: []int{3}}},
 			},
+			wantDocLengths: map[string]map[string]int{"1": {"content": 12}},
 		},
 		{
 
 			name:      "add a few documents",
-			userIndex: UserIndex{Index: Index{"some_random_existing_token": []string{"15"}}},
+			userIndex: UserIndex{Index: Index{"some_random_existing_token": []Posting{{DocID: "15", Field: "content", TF: 1}}}},
 			inputDocs: []Document{
-				{ID: "1", Content: "Did I hear it right? Did the quick brown fox jump over the lazy dog?"},
-				{ID: "2", Content: "Did you hear that fox?"},
-				{ID: "3", Content: "I heard something, I think it was a fox jumping over my dog!"},
+				textDocument("1", "Did I hear it right? Did the quick brown fox jump over the lazy dog?"),
+				textDocument("2", "Did you hear that fox?"),
+				textDocument("3", "I heard something, I think it was a fox jumping over my dog!"),
 			},
 			wantIndex: Index{
-				"did":                        []string{"1", "2"},
-				"brown":                      []string{"1"},
-				"dog":                        []string{"1", "3"},
-				"fox":                        []string{"1", "2", "3"},
-				"hear":                       []string{"1", "2"},
-				"heard":                      []string{"3"},
-				"it":                         []string{"1", "3"},
-				"my":                         []string{"3"},
-				"jump":                       []string{"1", "3"},
-				"lazi":                       []string{"1"},
-				"over":                       []string{"1", "3"},
-				"quick":                      []string{"1"},
-				"right":                      []string{"1"},
-				"some_random_existing_token": []string{"15"},
-				"someth":                     []string{"3"},
-				"think":                      []string{"3"},
-				"was":                        []string{"3"},
-				"you":                        []string{"2"},
+				"did":                        []Posting{{DocID: "1", Field: "content", TF: 2, Positions: []int{0, 4}}, {DocID: "2", Field: "content", TF: 1, Positions: []int{0}}},
+				"brown":                      []Posting{{DocID: "1", Field: "content", TF: 1, Positions: []int{6}}},
+				"dog":                        []Posting{{DocID: "1", Field: "content", TF: 1, Positions: []int{11}}, {DocID: "3", Field: "content", TF: 1, Positions: []int{9}}},
+				"fox":                        []Posting{{DocID: "1", Field: "content", TF: 1, Positions: []int{7}}, {DocID: "2", Field: "content", TF: 1, Positions: []int{3}}, {DocID: "3", Field: "content", TF: 1, Positions: []int{5}}},
+				"hear":                       []Posting{{DocID: "1", Field: "content", TF: 1, Positions: []int{1}}, {DocID: "2", Field: "content", TF: 1, Positions: []int{2}}},
+				"heard":                      []Posting{{DocID: "3", Field: "content", TF: 1, Positions: []int{0}}},
+				"it":                         []Posting{{DocID: "1", Field: "content", TF: 1, Positions: []int{2}}, {DocID: "3", Field: "content", TF: 1, Positions: []int{3}}},
+				"my":                         []Posting{{DocID: "3", Field: "content", TF: 1, Positions: []int{8}}},
+				"jump":                       []Posting{{DocID: "1", Field: "content", TF: 1, Positions: []int{8}}, {DocID: "3", Field: "content", TF: 1, Positions: []int{6}}},
+				"lazi":                       []Posting{{DocID: "1", Field: "content", TF: 1, Positions: []int{10}}},
+				"over":                       []Posting{{DocID: "1", Field: "content", TF: 1, Positions: []int{9}}, {DocID: "3", Field: "content", TF: 1, Positions: []int{7}}},
+				"quick":                      []Posting{{DocID: "1", Field: "content", TF: 1, Positions: []int{5}}},
+				"right":                      []Posting{{DocID: "1", Field: "content", TF: 1, Positions: []int{3}}},
+				"some_random_existing_token": []Posting{{DocID: "15", Field: "content", TF: 1}},
+				"someth":                     []Posting{{DocID: "3", Field: "content", TF: 1, Positions: []int{1}}},
+				"think":                      []Posting{{DocID: "3", Field: "content", TF: 1, Positions: []int{2}}},
+				"was":                        []Posting{{DocID: "3", Field: "content", TF: 1, Positions: []int{4}}},
+				"you":                        []Posting{{DocID: "2", Field: "content", TF: 1, Positions: []int{1}}},
 			},
+			wantDocLengths: map[string]map[string]int{"1": {"content": 12}, "2": {"content": 4}, "3": {"content": 10}},
+		},
+		{
+			name:      "reinsert a changed document",
+			userIndex: UserIndex{Index: Index{}},
+			inputDocs: []Document{
+				textDocument("1", "release notes"),
+				textDocument("2", "notes"),
+				textDocument("1", "draft release"),
+			},
+			wantIndex: Index{
+				"draft":  []Posting{{DocID: "1", Field: "content", TF: 1, Positions: []int{0}}},
+				"releas": []Posting{{DocID: "1", Field: "content", TF: 1, Positions: []int{1}}},
+				"note":   []Posting{{DocID: "2", Field: "content", TF: 1, Positions: []int{0}}},
+			},
+			wantDocLengths: map[string]map[string]int{"1": {"content": 2}, "2": {"content": 1}},
 		},
 	}
 	for _, tt := range tests {
@@ -71,6 +90,9 @@ func TestUserIndex_Add(t *testing.T) {
 			if !reflect.DeepEqual(tt.userIndex.Index, tt.wantIndex) {
 				t.Errorf("UserIndex.Insert() = \n%v, wantIndex \n%v", tt.userIndex.Index, tt.wantIndex)
 			}
+			if tt.wantDocLengths != nil && !reflect.DeepEqual(tt.userIndex.DocLengths, tt.wantDocLengths) {
+				t.Errorf("UserIndex.Insert() doc lengths = \n%v, want \n%v", tt.userIndex.DocLengths, tt.wantDocLengths)
+			}
 		})
 	}
 }
@@ -78,24 +100,24 @@ func TestUserIndex_Add(t *testing.T) {
 func TestUserIndex_Remove(t *testing.T) {
 	defaultIndex := func() Index {
 		return Index{
-			"did":                        []string{"1", "2"},
-			"brown":                      []string{"1"},
-			"dog":                        []string{"1", "3"},
-			"fox":                        []string{"1", "2", "3"},
-			"hear":                       []string{"1", "2"},
-			"heard":                      []string{"3"},
-			"it":                         []string{"1", "3"},
-			"my":                         []string{"3"},
-			"jump":                       []string{"1", "3"},
-			"lazi":                       []string{"1"},
-			"over":                       []string{"1", "3"},
-			"quick":                      []string{"1"},
-			"right":                      []string{"1"},
-			"some_random_existing_token": []string{"15"},
-			"someth":                     []string{"3"},
-			"think":                      []string{"3"},
-			"was":                        []string{"3"},
-			"you":                        []string{"2"},
+			"did":                        []Posting{{DocID: "1", Field: "content", TF: 2}, {DocID: "2", Field: "content", TF: 1}},
+			"brown":                      []Posting{{DocID: "1", Field: "content", TF: 1}},
+			"dog":                        []Posting{{DocID: "1", Field: "content", TF: 1}, {DocID: "3", Field: "content", TF: 1}},
+			"fox":                        []Posting{{DocID: "1", Field: "content", TF: 1}, {DocID: "2", Field: "content", TF: 1}, {DocID: "3", Field: "content", TF: 1}},
+			"hear":                       []Posting{{DocID: "1", Field: "content", TF: 1}, {DocID: "2", Field: "content", TF: 1}},
+			"heard":                      []Posting{{DocID: "3", Field: "content", TF: 1}},
+			"it":                         []Posting{{DocID: "1", Field: "content", TF: 1}, {DocID: "3", Field: "content", TF: 1}},
+			"my":                         []Posting{{DocID: "3", Field: "content", TF: 1}},
+			"jump":                       []Posting{{DocID: "1", Field: "content", TF: 1}, {DocID: "3", Field: "content", TF: 1}},
+			"lazi":                       []Posting{{DocID: "1", Field: "content", TF: 1}},
+			"over":                       []Posting{{DocID: "1", Field: "content", TF: 1}, {DocID: "3", Field: "content", TF: 1}},
+			"quick":                      []Posting{{DocID: "1", Field: "content", TF: 1}},
+			"right":                      []Posting{{DocID: "1", Field: "content", TF: 1}},
+			"some_random_existing_token": []Posting{{DocID: "15", Field: "content", TF: 1}},
+			"someth":                     []Posting{{DocID: "3", Field: "content", TF: 1}},
+			"think":                      []Posting{{DocID: "3", Field: "content", TF: 1}},
+			"was":                        []Posting{{DocID: "3", Field: "content", TF: 1}},
+			"you":                        []Posting{{DocID: "2", Field: "content", TF: 1}},
 		}
 	}
 	tests := []struct {
@@ -107,27 +129,27 @@ func TestUserIndex_Remove(t *testing.T) {
 		{
 			name:      "remove non-existing document of index",
 			userIndex: UserIndex{Index: defaultIndex()},
-			deleteDoc: Document{ID: "345", Content: "some_random_existing_token"},
+			deleteDoc: textDocument("345", "some_random_existing_token"),
 			wantIndex: defaultIndex(),
 		},
 		{
 			name:      "remove existing document of index",
 			userIndex: UserIndex{Index: defaultIndex()},
-			deleteDoc: Document{ID: "3", Content: "I heard something, I think it was a fox jumping over my dog!"},
+			deleteDoc: textDocument("3", "I heard something, I think it was a fox jumping over my dog!"),
 			wantIndex: Index{
-				"did":                        []string{"1", "2"},
-				"brown":                      []string{"1"},
-				"dog":                        []string{"1"},
-				"fox":                        []string{"1", "2"},
-				"hear":                       []string{"1", "2"},
-				"it":                         []string{"1"},
-				"jump":                       []string{"1"},
-				"lazi":                       []string{"1"},
-				"over":                       []string{"1"},
-				"quick":                      []string{"1"},
-				"right":                      []string{"1"},
-				"you":                        []string{"2"},
-				"some_random_existing_token": []string{"15"},
+				"did":                        []Posting{{DocID: "1", Field: "content", TF: 2}, {DocID: "2", Field: "content", TF: 1}},
+				"brown":                      []Posting{{DocID: "1", Field: "content", TF: 1}},
+				"dog":                        []Posting{{DocID: "1", Field: "content", TF: 1}},
+				"fox":                        []Posting{{DocID: "1", Field: "content", TF: 1}, {DocID: "2", Field: "content", TF: 1}},
+				"hear":                       []Posting{{DocID: "1", Field: "content", TF: 1}, {DocID: "2", Field: "content", TF: 1}},
+				"it":                         []Posting{{DocID: "1", Field: "content", TF: 1}},
+				"jump":                       []Posting{{DocID: "1", Field: "content", TF: 1}},
+				"lazi":                       []Posting{{DocID: "1", Field: "content", TF: 1}},
+				"over":                       []Posting{{DocID: "1", Field: "content", TF: 1}},
+				"quick":                      []Posting{{DocID: "1", Field: "content", TF: 1}},
+				"right":                      []Posting{{DocID: "1", Field: "content", TF: 1}},
+				"you":                        []Posting{{DocID: "2", Field: "content", TF: 1}},
+				"some_random_existing_token": []Posting{{DocID: "15", Field: "content", TF: 1}},
 			},
 		},
 	}
@@ -140,3 +162,287 @@ func TestUserIndex_Remove(t *testing.T) {
 		})
 	}
 }
+
+func TestUserIndex_Search(t *testing.T) {
+	tests := []struct {
+		name    string
+		docs    []Document
+		query   string
+		wantIDs []string
+	}{
+		{
+			name:    "nothing found",
+			docs:    []Document{textDocument("1", "quick brown fox")},
+			query:   "dog",
+			wantIDs: []string{},
+		},
+		{
+			name: "documents matching more tokens go first",
+			docs: []Document{
+				textDocument("1", "lazy fox"),
+				textDocument("2", "quick brown fox"),
+				textDocument("3", "lazy dog"),
+			},
+			query:   "quick fox",
+			wantIDs: []string{"2", "1"},
+		},
+		{
+			name: "rare tokens weigh more than common ones",
+			docs: []Document{
+				textDocument("1", "fox report"),
+				textDocument("2", "fox meeting"),
+				textDocument("3", "fox notes"),
+			},
+			query:   "fox meeting",
+			wantIDs: []string{"2", "1", "3"},
+		},
+		{
+			name: "shorter documents go first",
+			docs: []Document{
+				textDocument("1", "release notes for the quick brown fox project"),
+				textDocument("2", "release notes"),
+			},
+			query:   "release",
+			wantIDs: []string{"2", "1"},
+		},
+		{
+			name: "equal scores are sorted by id",
+			docs: []Document{
+				textDocument("2", "fox"),
+				textDocument("1", "fox"),
+			},
+			query:   "fox",
+			wantIDs: []string{"1", "2"},
+		},
+		{
+			name:    "AND requires all clauses",
+			docs:    booleanDocs,
+			query:   "fox AND brown",
+			wantIDs: []string{"1"},
+		},
+		{
+			name:    "OR",
+			docs:    booleanDocs,
+			query:   "brown OR lazy",
+			wantIDs: []string{"3", "2", "1"},
+		},
+		{
+			name:    "minus excludes documents",
+			docs:    booleanDocs,
+			query:   "fox -lazy",
+			wantIDs: []string{"4", "1"},
+		},
+		{
+			name:    "NOT excludes documents",
+			docs:    booleanDocs,
+			query:   "fox AND NOT brown",
+			wantIDs: []string{"4", "2"},
+		},
+		{
+			name:    "only negated clauses",
+			docs:    booleanDocs,
+			query:   "-fox",
+			wantIDs: []string{"3"},
+		},
+		{
+			name:    "grouping",
+			docs:    booleanDocs,
+			query:   "(brown OR dog) AND -quick",
+			wantIDs: []string{"3"},
+		},
+		{
+			name:    "phrase",
+			docs:    booleanDocs,
+			query:   `"lazy fox"`,
+			wantIDs: []string{"2"},
+		},
+		{
+			name: "phrase tokens must be adjacent",
+			docs: []Document{
+				textDocument("1", "notes on the release"),
+				textDocument("2", "write release notes"),
+				textDocument("3", "release the notes"),
+			},
+			query:   `"release notes"`,
+			wantIDs: []string{"3", "2"},
+		},
+		{
+			name: "phrase tokens must go in order",
+			docs: []Document{
+				textDocument("1", "notes release"),
+				textDocument("2", "release notes notes release"),
+			},
+			query:   `"release notes"`,
+			wantIDs: []string{"2"},
+		},
+		{
+			name: "proximity",
+			docs: []Document{
+				textDocument("1", "deploy the new build to staging"),
+				textDocument("2", "deploy build, then run tests on staging"),
+				textDocument("3", "staging deploy"),
+			},
+			query:   `"deploy staging"~3`,
+			wantIDs: []string{"3", "1"},
+		},
+		{
+			name: "typos in long words are tolerated",
+			docs: []Document{
+				textDocument("1", "team meeting"),
+				textDocument("2", "lunch"),
+			},
+			query:   "meetng",
+			wantIDs: []string{"1"},
+		},
+		{
+			name: "exact matches rank above fuzzy ones",
+			docs: []Document{
+				textDocument("1", "melting"),
+				textDocument("2", "meeting about the quarterly budget and hiring plans for next year"),
+				textDocument("3", "meeting"),
+			},
+			query:   "meeting",
+			wantIDs: []string{"3", "2", "1"},
+		},
+		{
+			name: "explicit fuzziness",
+			docs: []Document{
+				textDocument("1", "deploy"),
+				textDocument("2", "employ"),
+			},
+			query:   "deplyo~1",
+			wantIDs: []string{"1"},
+		},
+		{
+			name:    "fuzziness can be disabled",
+			docs:    []Document{textDocument("1", "team meeting")},
+			query:   "meetng~0",
+			wantIDs: []string{},
+		},
+		{
+			name:    "short words must match exactly",
+			docs:    []Document{textDocument("1", "fix")},
+			query:   "fox",
+			wantIDs: []string{},
+		},
+		{
+			name:    "stop words don't restrict AND",
+			docs:    booleanDocs,
+			query:   "the AND fox AND lazy",
+			wantIDs: []string{"2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := UserIndex{Index: Index{}}
+			for _, document := range tt.docs {
+				idx.Insert(document)
+			}
+			query, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			hits := idx.Search(query)
+			if got := IDs(hits); !reflect.DeepEqual(got, tt.wantIDs) {
+				t.Errorf("UserIndex.Search() = %v, want %v", hits, tt.wantIDs)
+			}
+		})
+	}
+}
+
+var booleanDocs = []Document{
+	textDocument("1", "quick brown fox"),
+	textDocument("2", "lazy fox"),
+	textDocument("3", "lazy brown dog"),
+	textDocument("4", "fox"),
+}
+
+// textDocument creates a document with a single content field.
+func textDocument(id, text string) Document {
+	return Document{ID: id, Fields: []Field{{Name: "content", Text: text}}}
+}
+
+func TestUserIndex_Search_fields(t *testing.T) {
+	docs := []Document{
+		{ID: "1", Fields: []Field{{Name: "title", Text: "Pay invoice"}, {Name: "description", Text: "Before friday"}, {Name: "status", Text: "finished"}}},
+		{ID: "2", Fields: []Field{{Name: "title", Text: "Call accountant"}, {Name: "description", Text: "Ask about the invoice"}, {Name: "status", Text: "created"}}},
+		{ID: "3", Fields: []Field{{Name: "title", Text: "Write release"}, {Name: "description", Text: "notes are finished"}, {Name: "status", Text: "created"}}},
+	}
+	schema := Schema{"title": {Boost: 2}, "status": {Scoped: true}}
+	tests := []struct {
+		name    string
+		query   string
+		wantIDs []string
+	}{
+		{
+			name:    "title matches rank above description matches",
+			query:   "invoice",
+			wantIDs: []string{"1", "2"},
+		},
+		{
+			name:    "field query",
+			query:   "description:invoice",
+			wantIDs: []string{"2"},
+		},
+		{
+			name:    "field query of a group",
+			query:   "title:(invoice OR accountant)",
+			wantIDs: []string{"1", "2"},
+		},
+		{
+			name:    "scoped fields are searched only by field queries",
+			query:   "finished",
+			wantIDs: []string{"3"},
+		},
+		{
+			name:    "scoped field query",
+			query:   "status:finished",
+			wantIDs: []string{"1"},
+		},
+		{
+			name:    "phrase must be found in a single field",
+			query:   `"release notes"`,
+			wantIDs: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := UserIndex{Index: Index{}, Schema: schema}
+			for _, document := range docs {
+				idx.Insert(document)
+			}
+			query, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			if got := IDs(idx.Search(query)); !reflect.DeepEqual(got, tt.wantIDs) {
+				t.Errorf("UserIndex.Search() = %v, want %v", got, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestUserIndex_Delete_fields(t *testing.T) {
+	document := Document{ID: "1", Fields: []Field{{Name: "title", Text: "notes"}, {Name: "description", Text: "release notes"}}}
+	idx := UserIndex{Index: Index{}}
+	idx.Insert(document)
+	idx.Insert(textDocument("2", "notes"))
+	idx.Delete(document)
+
+	wantIndex := Index{"note": []Posting{{DocID: "2", Field: "content", TF: 1, Positions: []int{0}}}}
+	if !reflect.DeepEqual(idx.Index, wantIndex) {
+		t.Errorf("UserIndex.Delete() = %v, want %v", idx.Index, wantIndex)
+	}
+}
+
+func TestUserIndex_DocumentIDs(t *testing.T) {
+	idx := UserIndex{Index: Index{}}
+	idx.Insert(textDocument("2", "release notes"))
+	idx.Insert(textDocument("1", "notes"))
+	// a document that lost its length, but not its postings
+	idx.Index["draft"] = []Posting{{DocID: "3", Field: "content", TF: 1, Positions: []int{0}}}
+
+	if got, want := idx.DocumentIDs(), []string{"1", "2", "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("UserIndex.DocumentIDs() = %v, want %v", got, want)
+	}
+}
@@ -8,70 +8,176 @@ import (
 
 var (
 	ErrNotFound = fmt.Errorf("user index not found")
+	// ErrConflict is returned when a user index is created or changed by a concurrent request.
+	ErrConflict = fmt.Errorf("user index was changed concurrently")
 )
 
-// Service is a service for searching documents.
+// Service is a service for searching documents, documents are stored and searched by a Backend.
 type Service struct {
-	Repo UserIndexRepository
+	Backend     Backend
+	SynonymRepo SynonymRepository
+	// Schema lists the fields of documents, field queries of other fields are rejected. Nil accepts any field.
+	Schema Schema
 }
 
-func NewService(repo UserIndexRepository) *Service {
+func NewService(backend Backend, synonymRepo SynonymRepository, schema Schema) *Service {
 	return &Service{
-		Repo: repo,
+		Backend:     backend,
+		SynonymRepo: synonymRepo,
+		Schema:      schema,
 	}
 }
 
-func (s *Service) Search(ctx context.Context, query string) ([]string, error) {
+// Search returns documents that match the query, the most relevant documents go first.
+// It returns *ParseError if the query is malformed or queries a field that isn't in the schema.
+func (s *Service) Search(ctx context.Context, query string) ([]Hit, error) {
 	usr := ctx.Value(user.UserContextKey).(user.User)
-
-	userIndex, err := s.Repo.Find(ctx, usr.ID)
-	if err == ErrNotFound {
-		userIndex = &UserIndex{UserID: usr.ID, Index: Index{}}
-		err = s.Repo.Create(ctx, userIndex)
-		if err != nil {
-			return nil, err
-		}
+	q, err := s.parse(query)
+	if err != nil {
+		return nil, err
 	}
+
+	sets, err := s.SynonymRepo.FindAll(ctx, usr.ID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find user index: %w", err)
+		return nil, fmt.Errorf("failed to find synonyms: %w", err)
 	}
-	return userIndex.Search(query), nil
+	return s.Backend.Search(ctx, q, NewSynonyms(sets))
 }
 
-func (s *Service) Insert(ctx context.Context, document Document) error {
-	usr := ctx.Value(user.UserContextKey).(user.User)
+// ValidateQuery returns *ParseError if the query would be rejected by Search, it's used to check saved queries.
+func (s *Service) ValidateQuery(query string) error {
+	_, err := s.parse(query)
+	return err
+}
 
-	userIndex, err := s.Repo.Find(ctx, usr.ID)
-	if err == ErrNotFound {
-		userIndex = &UserIndex{UserID: usr.ID, Index: Index{}}
-		err = s.Repo.Create(ctx, userIndex)
-		if err != nil {
-			return err
+// parse parses the query and checks that its fields are in the schema.
+func (s *Service) parse(query string) (Query, error) {
+	q, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if s.Schema != nil {
+		if err := checkFields(query, s.Schema); err != nil {
+			return nil, err
 		}
 	}
+	return q, nil
+}
+
+// DidYouMean returns up to MaxCorrections queries where misspelled words of the query are replaced by words
+// of the user's documents, it's used when the query found nothing. Only corrections that find documents are returned.
+func (s *Service) DidYouMean(ctx context.Context, query string) ([]string, error) {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+	minLength, maxLength, ok := correctionLengths(query)
+	if !ok {
+		return []string{}, nil
+	}
+
+	terms, err := s.Backend.Terms(ctx, TermFilter{MinLength: minLength, MaxLength: maxLength})
 	if err != nil {
-		return fmt.Errorf("failed to find user index: %w", err)
+		return nil, err
 	}
-	userIndex.Insert(document)
-	err = s.Repo.Update(ctx, userIndex)
+	sets, err := s.SynonymRepo.FindAll(ctx, usr.ID)
 	if err != nil {
-		return fmt.Errorf("failed to update user index: %w", err)
+		return nil, fmt.Errorf("failed to find synonyms: %w", err)
 	}
-	return nil
+	synonyms := NewSynonyms(sets)
+
+	found := []string{}
+	// corrections that find nothing are skipped, so more of them are tried
+	for _, correction := range terms.Corrections(query, s.Analyzer(ctx), 3*MaxCorrections) {
+		q, err := ParseQuery(correction)
+		if err != nil {
+			continue
+		}
+		hits, err := s.Backend.Search(ctx, q, synonyms)
+		if err != nil {
+			return nil, err
+		}
+		if len(hits) > 0 {
+			found = append(found, correction)
+		}
+		if len(found) == MaxCorrections {
+			break
+		}
+	}
+	return found, nil
+}
+
+// Related returns up to limit of the user's documents most similar to the document, the most similar go first.
+// The document doesn't have to be indexed, ex: it's a new document checked for duplicates.
+func (s *Service) Related(ctx context.Context, document Document, limit int) ([]Hit, error) {
+	return s.Backend.Related(ctx, document, limit)
+}
 
+// Suggest returns completions of the last word of the prefix drawn from the user's documents.
+func (s *Service) Suggest(ctx context.Context, prefix string, limit int) ([]Suggestion, error) {
+	return s.Backend.Suggest(ctx, prefix, limit)
+}
+
+// Insert adds documents to the user's index, documents that are indexed already are replaced.
+func (s *Service) Insert(ctx context.Context, documents ...Document) error {
+	return s.Backend.Insert(ctx, documents...)
 }
 
 func (s *Service) Delete(ctx context.Context, document Document) error {
+	return s.Backend.Delete(ctx, document)
+}
+
+// Synonyms returns the user's synonym sets.
+func (s *Service) Synonyms(ctx context.Context) ([]*SynonymSet, error) {
 	usr := ctx.Value(user.UserContextKey).(user.User)
 
-	userIndex, err := s.Repo.Find(ctx, usr.ID)
+	return s.SynonymRepo.FindAll(ctx, usr.ID)
+}
+
+// CreateSynonyms adds a synonym set, it returns ErrInvalidSynonyms if the rule is malformed.
+func (s *Service) CreateSynonyms(ctx context.Context, set *SynonymSet) (*SynonymSet, error) {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+	set.UserID = usr.ID
+	if err := set.Validate(); err != nil {
+		return nil, err
+	}
+	created, err := s.SynonymRepo.Create(ctx, set)
 	if err != nil {
-		return fmt.Errorf("failed to find user index: %w", err)
+		return nil, fmt.Errorf("failed to create synonym set: %w", err)
 	}
-	userIndex.Delete(document)
-	err = s.Repo.Update(ctx, userIndex)
+	return created, nil
+}
+
+// UpdateSynonyms replaces the rule of a synonym set, it's applied to the next searches without reindexing.
+func (s *Service) UpdateSynonyms(ctx context.Context, set *SynonymSet) error {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+	if err := set.Validate(); err != nil {
+		return err
+	}
+	return s.SynonymRepo.Update(ctx, usr.ID, set)
+}
+
+func (s *Service) DeleteSynonyms(ctx context.Context, id string) error {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	err := s.SynonymRepo.Delete(ctx, usr.ID, id)
 	if err != nil {
-		return fmt.Errorf("failed to update user index: %w", err)
+		return fmt.Errorf("failed to delete synonym set: %w", err)
 	}
 	return nil
 }
+
+// Rebuild replaces the user's index with a new one built from the documents by the analyzer.
+// A nil analyzer keeps the analyzer of the index.
+func (s *Service) Rebuild(ctx context.Context, analyzer *Analyzer, documents ...Document) error {
+	return s.Backend.Rebuild(ctx, analyzer, documents...)
+}
+
+// DocumentIDs returns sorted IDs of documents in the user's index, it's used to check the index consistency.
+func (s *Service) DocumentIDs(ctx context.Context) ([]string, error) {
+	return s.Backend.DocumentIDs(ctx)
+}
+
+// Analyzer returns the analyzer chosen in the user's settings.
+func (s *Service) Analyzer(ctx context.Context) *Analyzer {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	return userAnalyzer(usr)
+}
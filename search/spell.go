@@ -0,0 +1,168 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MaxCorrections is the number of alternative queries suggested for a query that found nothing.
+	MaxCorrections = 3
+	// minCorrectedLength is the length of the shortest word that is corrected, shorter words are kept as they are.
+	minCorrectedLength = 3
+	// maxCorrectedWords is the number of words of a query that are corrected, the rest are kept as they are.
+	maxCorrectedWords = 4
+	// maxCandidates is the number of similar words tried for every misspelled word.
+	maxCandidates = 3
+)
+
+// misspelling is a word of a query that isn't in the dictionary and words of the dictionary similar to it.
+type misspelling struct {
+	// start and end are positions of the word in the query, in characters
+	start, end int
+	candidates []FuzzyTerm
+}
+
+// correction is a query where misspelled words are replaced by candidates.
+type correction struct {
+	text      string
+	distance  int
+	frequency int
+}
+
+// Corrections returns up to limit queries where words of the query that documents don't contain are replaced by
+// similar words of the dictionary. Corrections with fewer edits go first, then ones with more frequent words.
+// Only words outside of phrases are corrected, operators, fields and fuzziness of the query are kept.
+func (t Terms) Corrections(query string, analyzer *Analyzer, limit int) []string {
+	var misspellings []misspelling
+	for _, word := range correctedWords(query) {
+		text := strings.ToLower(word.text)
+		// stop words aren't in the dictionary, but they aren't misspelled
+		if t.contains(text) || len(analyzer.Analyze(text)) == 0 {
+			continue
+		}
+		candidates := t.Fuzzy(text, spellingDistance(text))
+		sort.Slice(candidates, func(i, j int) bool {
+			a, b := candidates[i], candidates[j]
+			if a.Distance != b.Distance {
+				return a.Distance < b.Distance
+			}
+			if len(a.DocIDs) != len(b.DocIDs) {
+				return len(a.DocIDs) > len(b.DocIDs)
+			}
+			return a.Word < b.Word
+		})
+		if len(candidates) > maxCandidates {
+			candidates = candidates[:maxCandidates]
+		}
+		if len(candidates) > 0 {
+			misspellings = append(misspellings, misspelling{start: word.pos, end: word.pos + utf8.RuneCountInString(word.text), candidates: candidates})
+		}
+		if len(misspellings) == maxCorrectedWords {
+			break
+		}
+	}
+	if len(misspellings) == 0 {
+		return []string{}
+	}
+
+	corrections := combineCorrections([]rune(query), misspellings)
+	sort.Slice(corrections, func(i, j int) bool {
+		a, b := corrections[i], corrections[j]
+		if a.distance != b.distance {
+			return a.distance < b.distance
+		}
+		if a.frequency != b.frequency {
+			return a.frequency > b.frequency
+		}
+		return a.text < b.text
+	})
+	if limit > 0 && len(corrections) > limit {
+		corrections = corrections[:limit]
+	}
+	texts := make([]string, len(corrections))
+	for i, c := range corrections {
+		texts[i] = c.text
+	}
+	return texts
+}
+
+// combineCorrections returns queries with every combination of candidates of the misspelled words.
+func combineCorrections(query []rune, misspellings []misspelling) []correction {
+	corrections := []correction{{}}
+	end := 0
+	for _, m := range misspellings {
+		between := string(query[end:m.start])
+		next := make([]correction, 0, len(corrections)*len(m.candidates))
+		for _, c := range corrections {
+			for _, candidate := range m.candidates {
+				next = append(next, correction{
+					text:      c.text + between + candidate.Word,
+					distance:  c.distance + candidate.Distance,
+					frequency: c.frequency + len(candidate.DocIDs),
+				})
+			}
+		}
+		corrections = next
+		end = m.end
+	}
+	for i := range corrections {
+		corrections[i].text += string(query[end:])
+	}
+	return corrections
+}
+
+// contains reports whether the dictionary contains the word.
+func (t Terms) contains(word string) bool {
+	i := sort.Search(len(t), func(i int) bool { return t[i].Word >= word })
+	return i < len(t) && t[i].Word == word
+}
+
+// correctedWords returns word tokens of the query that may be corrected: plain words outside of phrases.
+// Malformed queries have no corrected words.
+func correctedWords(query string) []token {
+	tokens := lex(query)
+	if tokens[len(tokens)-1].kind == errToken {
+		return nil
+	}
+	var words []token
+	for _, t := range tokens {
+		if t.kind != wordToken || utf8.RuneCountInString(t.text) < minCorrectedLength {
+			continue
+		}
+		if parts := tokenize(strings.ToLower(t.text)); len(parts) != 1 || parts[0] != strings.ToLower(t.text) {
+			// ex: a word with punctuation
+			continue
+		}
+		words = append(words, t)
+	}
+	return words
+}
+
+// correctionLengths returns the range of lengths of dictionary words that may correct words of the query,
+// false means the query has no words to correct. It's used to load only terms that may be needed.
+func correctionLengths(query string) (int, int, bool) {
+	minLength, maxLength, found := 0, 0, false
+	for _, word := range correctedWords(query) {
+		length := utf8.RuneCountInString(word.text)
+		distance := spellingDistance(word.text)
+		if !found || length-distance < minLength {
+			minLength = length - distance
+		}
+		if !found || length+distance > maxLength {
+			maxLength = length + distance
+		}
+		found = true
+	}
+	return minLength, maxLength, found
+}
+
+// spellingDistance returns the number of edits allowed in a correction of the word. Unlike fuzzy terms,
+// short words are corrected too, because the query found nothing anyway.
+func spellingDistance(word string) int {
+	if utf8.RuneCountInString(word) < 5 {
+		return 1
+	}
+	return maxFuzziness
+}
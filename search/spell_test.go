@@ -0,0 +1,44 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTerms_Corrections(t *testing.T) {
+	var terms Terms
+	for word, ids := range map[string][]string{
+		"meeting":  {"1", "2", "3"},
+		"melting":  {"4"},
+		"release":  {"1", "2"},
+		"relapse":  {"3"},
+		"notes":    {"1"},
+		"nodes":    {"2", "3"},
+		"deploy":   {"5"},
+		"staging":  {"5"},
+		"schedule": {"3"},
+	} {
+		for _, id := range ids {
+			terms.add(word, id)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "meetng", want: []string{"meeting", "melting"}},
+		{query: "relase notse", want: []string{"release notes", "relapse notes", "release nodes"}},
+		{query: "title:relase AND -deploy", want: []string{"title:release AND -deploy", "title:relapse AND -deploy"}},
+		{query: `stagign~1 "relase notes"`, want: []string{`staging~1 "relase notes"`}},
+		{query: "the meetng", want: []string{"the meeting", "the melting"}},
+		{query: "meeting", want: []string{}},
+		{query: "xyzzy", want: []string{}},
+		{query: `"unterminated`, want: []string{}},
+	}
+	for _, tt := range tests {
+		if got := terms.Corrections(tt.query, NewEnglishAnalyzer(), MaxCorrections); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Terms.Corrections(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -1,29 +1,82 @@
 package search
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sort"
 	"time"
-	"todo/user"
 )
 
+// indexVersion is the version of the stored index format. Indexes of version 1 were JSON in the index column
+// of the user index, Migrate rebuilds them from documents of their users.
+const indexVersion = 2
+
+// insertBatchSize is the number of rows inserted by one statement.
+const insertBatchSize = 500
+
+// findBatchSize is the number of keys of rows found by one statement.
+const findBatchSize = 1000
+
+// readOptions make reads of lists and documents see the same state of the index,
+// otherwise ordinals of lists could be mapped to documents of a rebuilt index.
+var readOptions = &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+
 // We have to import this structure because I used gorm with auto migration.
+// The index itself is stored in rows of SQLPostingList, SQLIndexedDocument and SQLTermList.
 type SQLUserIndex struct {
-	UserID    uint `gorm:"primaryKey"`
-	Index     string
-	Analyzer  string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	UserID   uint `gorm:"primaryKey"`
+	Analyzer string
+	Version  int `gorm:"default:1"`
+	// DocCount and FieldLengths are the number of documents and their binary encoded summed lengths of fields,
+	// searches score documents by them, so they load lengths of only the documents they match.
+	DocCount     int `gorm:"not null;default:0"`
+	FieldLengths []byte
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// SQLPostingList is a binary encoded list of postings of a token in a user's documents. Postings refer to documents
+// by ordinals, so IDs of documents aren't repeated in lists of every token.
+type SQLPostingList struct {
+	UserID   uint   `gorm:"primaryKey"`
+	Token    string `gorm:"primaryKey"`
+	Postings []byte
 }
 
+// SQLIndexedDocument maps the ordinal of a user's indexed document to its ID.
+type SQLIndexedDocument struct {
+	UserID  uint   `gorm:"primaryKey;uniqueIndex:idx_sql_indexed_documents_ordinal,priority:1"`
+	DocID   string `gorm:"primaryKey"`
+	Ordinal uint32 `gorm:"uniqueIndex:idx_sql_indexed_documents_ordinal,priority:2"`
+	// Lengths are binary encoded lengths of fields of the document.
+	Lengths []byte
+	// Tokens and Words are binary encoded dictionaries of tokens and unstemmed words of the document,
+	// they're used to remove the document from lists of its tokens and words.
+	Tokens []byte
+	Words  []byte
+}
+
+// SQLTermList is an unstemmed word of a user's documents and binary encoded ordinals of documents containing it.
+type SQLTermList struct {
+	UserID   uint   `gorm:"primaryKey"`
+	Word     string `gorm:"primaryKey"`
+	Ordinals []byte
+}
+
+// DocumentSource loads all documents of a user, it's used to rebuild the user's index from scratch.
+type DocumentSource func(ctx context.Context, userID uint) ([]Document, error)
+
 type SQLRepository struct {
 	db *gorm.DB
 }
 
-func NewSQLRepository(gorm *gorm.DB) UserIndexRepository {
+func NewSQLRepository(gorm *gorm.DB) *SQLRepository {
 	return &SQLRepository{db: gorm}
 }
 
@@ -40,35 +93,219 @@ func (S *SQLRepository) Find(ctx context.Context, userID uint) (*UserIndex, erro
 		return nil, fmt.Errorf("could not find user index: %w", err)
 	}
 
-	res := &UserIndex{UserID: userID}
+	analyzer, err := unmarshalAnalyzer(sqlUserIndex.Analyzer)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := sqlUserIndex.stats()
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserIndex{
+		UserID:     userID,
+		Index:      Index{},
+		DocLengths: map[string]map[string]int{},
+		Stats:      stats,
+		Analyzer:   analyzer,
+		CreatedAt:  sqlUserIndex.CreatedAt,
+		UpdatedAt:  sqlUserIndex.UpdatedAt,
+	}, nil
+
+}
+
+func (s *SQLRepository) FindDocLengths(ctx context.Context, userID uint, docIDs []string) (map[string]map[string]int, error) {
+	var documents []SQLIndexedDocument
+	db := s.db.WithContext(ctx).Select("doc_id", "lengths")
+	if docIDs == nil {
+		if err := db.Where("user_id = ?", userID).Find(&documents).Error; err != nil {
+			return nil, fmt.Errorf("could not find user index documents: %w", err)
+		}
+	}
+	for start := 0; start < len(docIDs); start += findBatchSize {
+		end := start + findBatchSize
+		if end > len(docIDs) {
+			end = len(docIDs)
+		}
+		var batch []SQLIndexedDocument
+		if err := db.Where("user_id = ? AND doc_id IN ?", userID, docIDs[start:end]).Find(&batch).Error; err != nil {
+			return nil, fmt.Errorf("could not find user index documents: %w", err)
+		}
+		documents = append(documents, batch...)
+	}
 
-	var idx Index
-	err = json.Unmarshal([]byte(sqlUserIndex.Index), &idx)
+	docLengths := make(map[string]map[string]int, len(documents))
+	for _, document := range documents {
+		lengths, err := decodeLengths(document.Lengths)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode lengths of document %s: %w", document.DocID, err)
+		}
+		docLengths[document.DocID] = lengths
+	}
+	return docLengths, nil
+}
+
+func (s *SQLRepository) FindPostings(ctx context.Context, userID uint, tokens []string) (Index, error) {
+	idx := Index{}
+	if len(tokens) == 0 {
+		return idx, nil
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var lists []SQLPostingList
+		if err := tx.Where("user_id = ? AND token IN ?", userID, tokens).Find(&lists).Error; err != nil {
+			return err
+		}
+		if len(lists) == 0 {
+			return nil
+		}
+		decoded := make([][]ordinalPosting, len(lists))
+		var ordinals []uint32
+		for i, list := range lists {
+			postings, err := decodePostings(list.Postings)
+			if err != nil {
+				return fmt.Errorf("could not decode postings of token %q: %w", list.Token, err)
+			}
+			decoded[i] = postings
+			for _, posting := range postings {
+				ordinals = append(ordinals, posting.Ordinal)
+			}
+		}
+		docIDs, err := findDocIDs(tx, userID, ordinals)
+		if err != nil {
+			return err
+		}
+
+		for i, list := range lists {
+			tokenPostings := make([]Posting, len(decoded[i]))
+			for j, posting := range decoded[i] {
+				id, ok := docIDs[posting.Ordinal]
+				if !ok {
+					return fmt.Errorf("postings of token %q refer to unknown document %d: %w", list.Token, posting.Ordinal, errCorrupted)
+				}
+				tokenPostings[j] = Posting{DocID: id, Field: posting.Field, TF: posting.TF, Positions: posting.Positions}
+			}
+			sort.Slice(tokenPostings, func(i, j int) bool {
+				a, b := tokenPostings[i], tokenPostings[j]
+				if a.DocID != b.DocID {
+					return a.DocID < b.DocID
+				}
+				return a.Field < b.Field
+			})
+			idx[list.Token] = tokenPostings
+		}
+		return nil
+	}, readOptions)
 	if err != nil {
-		return nil, fmt.Errorf("could not unmarshal user index: %w", err)
+		return nil, fmt.Errorf("could not find user index postings: %w", err)
 	}
-	res.Index = idx
+	return idx, nil
+}
+
+func (s *SQLRepository) FindTerms(ctx context.Context, userID uint, filter TermFilter) (Terms, error) {
+	var terms Terms
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("user_id = ?", userID)
+		if filter.Prefix != "" {
+			query = query.Where("word LIKE ?", likeEscaper.Replace(filter.Prefix)+"%")
+		}
+		if filter.MinLength > 0 {
+			query = query.Where("char_length(word) >= ?", filter.MinLength)
+		}
+		if filter.MaxLength > 0 {
+			query = query.Where("char_length(word) <= ?", filter.MaxLength)
+		}
+		var lists []SQLTermList
+		if err := query.Find(&lists).Error; err != nil {
+			return err
+		}
+		if len(lists) == 0 {
+			return nil
+		}
+		decoded := make([][]uint32, len(lists))
+		var allOrdinals []uint32
+		for i, list := range lists {
+			ordinals, err := decodeOrdinals(list.Ordinals)
+			if err != nil {
+				return fmt.Errorf("could not decode documents of word %q: %w", list.Word, err)
+			}
+			decoded[i] = ordinals
+			allOrdinals = append(allOrdinals, ordinals...)
+		}
+		docIDs, err := findDocIDs(tx, userID, allOrdinals)
+		if err != nil {
+			return err
+		}
 
-	var analyzer Analyzer
-	err = json.Unmarshal([]byte(sqlUserIndex.Analyzer), &analyzer)
+		for i, list := range lists {
+			term := Term{Word: list.Word, DocIDs: make([]string, len(decoded[i]))}
+			for j, ordinal := range decoded[i] {
+				id, ok := docIDs[ordinal]
+				if !ok {
+					return fmt.Errorf("documents of word %q refer to unknown document %d: %w", list.Word, ordinal, errCorrupted)
+				}
+				term.DocIDs[j] = id
+			}
+			sort.Strings(term.DocIDs)
+			terms = append(terms, term)
+		}
+		return nil
+	}, readOptions)
 	if err != nil {
-		return nil, fmt.Errorf("could not unmarshal user index analyzer: %w", err)
+		return nil, fmt.Errorf("could not find user index terms: %w", err)
 	}
-	res.Analyzer = &analyzer
 
-	return res, nil
+	// terms are searched by byte order of words, which may differ from the collation of the database
+	sort.Slice(terms, func(i, j int) bool { return terms[i].Word < terms[j].Word })
+	return terms, nil
+}
+
+func (s *SQLRepository) FindDocTokens(ctx context.Context, userID uint, docIDs []string) (map[string][]string, error) {
+	docTokens := make(map[string][]string, len(docIDs))
+	if len(docIDs) == 0 {
+		return docTokens, nil
+	}
 
+	var documents []SQLIndexedDocument
+	err := s.db.WithContext(ctx).Select("doc_id", "tokens").Where("user_id = ? AND doc_id IN ?", userID, docIDs).Find(&documents).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not find user index documents: %w", err)
+	}
+	for _, document := range documents {
+		tokens, err := decodeDictionary(document.Tokens)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode tokens of document %s: %w", document.DocID, err)
+		}
+		docTokens[document.DocID] = tokens
+	}
+	return docTokens, nil
 }
 
+// Update replaces the user's index, writes of the index are serialized by locking its row.
 func (s *SQLRepository) Update(ctx context.Context, idx *UserIndex) error {
-	usr := ctx.Value(user.UserContextKey).(user.User)
-
-	jsonIdx, err := json.Marshal(idx.Index)
+	analyzer, err := json.Marshal(idx.Analyzer)
 	if err != nil {
-		return fmt.Errorf("could not marshal user index: %w", err)
+		return fmt.Errorf("could not marshal user index analyzer: %w", err)
 	}
 
-	err = s.db.WithContext(ctx).Model(&SQLUserIndex{}).Where("user_id = ?", usr.ID).Update("index", jsonIdx).Error
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := lock(tx, idx.UserID); err != nil {
+			return err
+		}
+		err := tx.Model(&SQLUserIndex{}).Where("user_id = ?", idx.UserID).Updates(map[string]interface{}{
+			"analyzer": string(analyzer),
+			"version":  indexVersion,
+		}).Error
+		if err != nil {
+			return err
+		}
+		for _, model := range []interface{}{&SQLPostingList{}, &SQLIndexedDocument{}, &SQLTermList{}} {
+			if err := tx.Where("user_id = ?", idx.UserID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return insertRows(tx, idx)
+	})
 	if err != nil {
 		return fmt.Errorf("could not update user index: %w", err)
 	}
@@ -76,29 +313,480 @@ func (s *SQLRepository) Update(ctx context.Context, idx *UserIndex) error {
 	return nil
 }
 
+// Create creates the user's index, it returns ErrConflict if the index was created by a concurrent request.
 func (s *SQLRepository) Create(ctx context.Context, idx *UserIndex) error {
-	usr := ctx.Value(user.UserContextKey).(user.User)
-
 	sqlIdx := &SQLUserIndex{
-		UserID: usr.ID,
+		UserID:  idx.UserID,
+		Version: indexVersion,
 	}
 
-	jsonIdx, err := json.Marshal(idx.Index)
-	if err != nil {
-		return fmt.Errorf("could not marshal user index: %w", err)
-	}
-	sqlIdx.Index = string(jsonIdx)
-
 	analyzer, err := json.Marshal(idx.Analyzer)
 	if err != nil {
-		return fmt.Errorf("could not marshal user index: %w", err)
+		return fmt.Errorf("could not marshal user index analyzer: %w", err)
 	}
 	sqlIdx.Analyzer = string(analyzer)
 
-	err = s.db.WithContext(ctx).Create(sqlIdx).Error
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		created := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(sqlIdx)
+		if err := created.Error; err != nil {
+			return err
+		}
+		if created.RowsAffected == 0 {
+			return ErrConflict
+		}
+		return insertRows(tx, idx)
+	})
 	if err != nil {
 		return fmt.Errorf("could not update user index: %w", err)
 	}
 
 	return nil
 }
+
+// Insert replaces documents of the index, lists of tokens and words of other documents aren't touched.
+// It returns ErrConflict if the analyzer of the user's index was changed after the documents were analyzed.
+func (s *SQLRepository) Insert(ctx context.Context, idx *UserIndex) error {
+	docIDs := make([]string, 0, len(idx.DocLengths))
+	for id := range idx.DocLengths {
+		docIDs = append(docIDs, id)
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		sqlUserIndex, err := lock(tx, idx.UserID)
+		if err != nil {
+			return err
+		}
+		analyzer, err := unmarshalAnalyzer(sqlUserIndex.Analyzer)
+		if err != nil {
+			return err
+		}
+		if analyzer != nil && idx.Analyzer != nil && !sameAnalyzer(analyzer, idx.Analyzer) {
+			return ErrConflict
+		}
+		return mergeRows(tx, sqlUserIndex, docIDs, idx)
+	})
+	if err != nil {
+		return fmt.Errorf("could not insert documents to user index: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLRepository) Delete(ctx context.Context, userID uint, docIDs ...string) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		sqlUserIndex, err := lock(tx, userID)
+		if err == ErrNotFound {
+			// the user has no index, so there's nothing to delete
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return mergeRows(tx, sqlUserIndex, docIDs, &UserIndex{UserID: userID})
+	})
+	if err != nil {
+		return fmt.Errorf("could not delete documents from user index: %w", err)
+	}
+	return nil
+}
+
+// Migrate rebuilds indexes stored as JSON from the documents of their users and drops the JSON column once all
+// indexes are rebuilt. Indexes keep their analyzers, indexes without one get the default analyzer.
+func (s *SQLRepository) Migrate(ctx context.Context, source DocumentSource, schema Schema) error {
+	var outdated []SQLUserIndex
+	err := s.db.WithContext(ctx).Select("user_id", "analyzer", "version").Where("version < ?", indexVersion).Find(&outdated).Error
+	if err != nil {
+		return fmt.Errorf("could not find outdated user indexes: %w", err)
+	}
+
+	for _, sqlUserIndex := range outdated {
+		userID := sqlUserIndex.UserID
+		analyzer, err := unmarshalAnalyzer(sqlUserIndex.Analyzer)
+		if err != nil {
+			return fmt.Errorf("could not rebuild index of user %d: %w", userID, err)
+		}
+		if analyzer == nil {
+			analyzer = NewEnglishAnalyzer()
+		}
+		documents, err := source(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("could not load documents of user %d: %w", userID, err)
+		}
+		idx := &UserIndex{UserID: userID, Index: Index{}, DocLengths: map[string]map[string]int{}, Analyzer: analyzer, Schema: schema}
+		for _, document := range documents {
+			idx.Insert(document)
+		}
+		if err := s.Update(ctx, idx); err != nil {
+			return fmt.Errorf("could not rebuild index of user %d: %w", userID, err)
+		}
+	}
+
+	migrator := s.db.WithContext(ctx).Migrator()
+	if migrator.HasColumn(&SQLUserIndex{}, "index") {
+		if err := migrator.DropColumn(&SQLUserIndex{}, "index"); err != nil {
+			return fmt.Errorf("could not drop user index column: %w", err)
+		}
+	}
+	return nil
+}
+
+// lock locks the row of the user's index until the end of the transaction,
+// so concurrent writes of the index are applied one by one.
+func lock(tx *gorm.DB, userID uint) (*SQLUserIndex, error) {
+	var sqlUserIndex SQLUserIndex
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&sqlUserIndex, "user_id = ?", userID).Error
+	switch {
+	case err == nil:
+		return &sqlUserIndex, nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, ErrNotFound
+	default:
+		return nil, fmt.Errorf("could not lock user index: %w", err)
+	}
+}
+
+// findDocIDs returns IDs of the user's documents by the ordinals, only documents of the ordinals are loaded.
+func findDocIDs(tx *gorm.DB, userID uint, ordinals []uint32) (map[uint32]string, error) {
+	seen := make(map[uint32]bool, len(ordinals))
+	var keys []uint32
+	for _, ordinal := range ordinals {
+		if !seen[ordinal] {
+			seen[ordinal] = true
+			keys = append(keys, ordinal)
+		}
+	}
+
+	docIDs := make(map[uint32]string, len(keys))
+
+	for start := 0; start < len(keys); start += findBatchSize {
+		end := start + findBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		var documents []SQLIndexedDocument
+		err := tx.Select("doc_id", "ordinal").Where("user_id = ? AND ordinal IN ?", userID, keys[start:end]).Find(&documents).Error
+		if err != nil {
+			return nil, fmt.Errorf("could not find user index documents: %w", err)
+		}
+		for _, document := range documents {
+			docIDs[document.Ordinal] = document.DocID
+		}
+	}
+	return docIDs, nil
+}
+
+// insertRows inserts documents of the index and lists of their tokens and words to an empty index.
+func insertRows(tx *gorm.DB, idx *UserIndex) error {
+	documents, postings, terms := buildRows(idx, 0)
+	if err := saveStats(tx, idx.UserID, newIndexStats(idx.DocLengths)); err != nil {
+		return err
+	}
+	return saveRows(tx, idx.UserID, documents, postings, terms)
+}
+
+// mergeRows removes the documents from the locked user's index and adds documents of the index. Only lists of tokens
+// and words of the documents are loaded, they're written again without ordinals of the removed documents.
+// Stats of the user's index are updated by lengths of the removed and added documents.
+func mergeRows(tx *gorm.DB, sqlUserIndex *SQLUserIndex, docIDs []string, idx *UserIndex) error {
+	userID := sqlUserIndex.UserID
+	var removed []SQLIndexedDocument
+	if len(docIDs) > 0 {
+		err := tx.Select("doc_id", "ordinal", "lengths", "tokens", "words").Where("user_id = ? AND doc_id IN ?", userID, docIDs).Find(&removed).Error
+		if err != nil {
+			return err
+		}
+	}
+	stats, err := sqlUserIndex.stats()
+	if err != nil {
+		return err
+	}
+	// new documents get ordinals after the last one, ordinals are compacted when the index is replaced
+	var next uint32
+	err = tx.Model(&SQLIndexedDocument{}).Select("COALESCE(MAX(ordinal) + 1, 0)").Where("user_id = ?", userID).Scan(&next).Error
+	if err != nil {
+		return err
+	}
+	documents, postings, terms := buildRows(idx, next)
+
+	removedOrdinals := make(map[uint32]bool, len(removed))
+	for _, document := range removed {
+		removedOrdinals[document.Ordinal] = true
+		lengths, err := decodeLengths(document.Lengths)
+		if err != nil {
+			return fmt.Errorf("could not decode lengths of document %s: %w", document.DocID, err)
+		}
+		stats.add(lengths, -1)
+		tokens, err := decodeDictionary(document.Tokens)
+		if err != nil {
+			return fmt.Errorf("could not decode tokens of document %s: %w", document.DocID, err)
+		}
+		for _, token := range tokens {
+			if _, ok := postings[token]; !ok {
+				postings[token] = nil
+			}
+		}
+		words, err := decodeDictionary(document.Words)
+		if err != nil {
+			return fmt.Errorf("could not decode words of document %s: %w", document.DocID, err)
+		}
+		for _, word := range words {
+			if _, ok := terms[word]; !ok {
+				terms[word] = nil
+			}
+		}
+	}
+
+	tokens := make([]string, 0, len(postings))
+	for token := range postings {
+		tokens = append(tokens, token)
+	}
+	var lists []SQLPostingList
+	if len(tokens) > 0 {
+		if err := tx.Where("user_id = ? AND token IN ?", userID, tokens).Find(&lists).Error; err != nil {
+			return err
+		}
+	}
+	for _, list := range lists {
+		stored, err := decodePostings(list.Postings)
+		if err != nil {
+			return fmt.Errorf("could not decode postings of token %q: %w", list.Token, err)
+		}
+		for _, posting := range stored {
+			if !removedOrdinals[posting.Ordinal] {
+				postings[list.Token] = append(postings[list.Token], posting)
+			}
+		}
+	}
+
+	words := make([]string, 0, len(terms))
+	for word := range terms {
+		words = append(words, word)
+	}
+	var termLists []SQLTermList
+	if len(words) > 0 {
+		if err := tx.Where("user_id = ? AND word IN ?", userID, words).Find(&termLists).Error; err != nil {
+			return err
+		}
+	}
+	for _, list := range termLists {
+		stored, err := decodeOrdinals(list.Ordinals)
+		if err != nil {
+			return fmt.Errorf("could not decode documents of word %q: %w", list.Word, err)
+		}
+		for _, ordinal := range stored {
+			if !removedOrdinals[ordinal] {
+				terms[list.Word] = append(terms[list.Word], ordinal)
+			}
+		}
+	}
+
+	if len(removed) > 0 {
+		if err := tx.Where("user_id = ? AND doc_id IN ?", userID, docIDs).Delete(&SQLIndexedDocument{}).Error; err != nil {
+			return err
+		}
+	}
+	for _, lengths := range idx.DocLengths {
+		stats.add(lengths, 1)
+	}
+	if err := saveStats(tx, userID, stats); err != nil {
+		return err
+	}
+	return saveRows(tx, userID, documents, postings, terms)
+}
+
+// saveStats writes stats of the user's index.
+func saveStats(tx *gorm.DB, userID uint, stats *IndexStats) error {
+	return tx.Model(&SQLUserIndex{}).Where("user_id = ?", userID).Updates(map[string]interface{}{
+		"doc_count":     stats.DocCount,
+		"field_lengths": encodeLengths(stats.FieldLengths),
+	}).Error
+}
+
+// stats returns stats of the index, they're written with the index, so no field lengths mean no documents.
+func (i *SQLUserIndex) stats() (*IndexStats, error) {
+	if len(i.FieldLengths) == 0 {
+		return &IndexStats{DocCount: i.DocCount, FieldLengths: map[string]int{}}, nil
+	}
+	fieldLengths, err := decodeLengths(i.FieldLengths)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode field lengths of user index: %w", err)
+	}
+	return &IndexStats{DocCount: i.DocCount, FieldLengths: fieldLengths}, nil
+}
+
+// buildRows assigns ordinals starting from next to documents of the index in order of their IDs,
+// it returns rows of the documents, postings of the documents by tokens and their ordinals by words.
+func buildRows(idx *UserIndex, next uint32) ([]SQLIndexedDocument, map[string][]ordinalPosting, map[string][]uint32) {
+	ids := make([]string, 0, len(idx.DocLengths))
+	for id := range idx.DocLengths {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	ordinals := make(map[string]uint32, len(ids))
+	for i, id := range ids {
+		ordinals[id] = next + uint32(i)
+	}
+
+	postings := map[string][]ordinalPosting{}
+	docTokens := map[string][]string{}
+	for token, tokenPostings := range idx.Index {
+		for _, posting := range tokenPostings {
+			ordinal, ok := ordinals[posting.DocID]
+			if !ok {
+				// every document of the index has lengths, but a posting of another document can't be stored
+				continue
+			}
+			postings[token] = append(postings[token], ordinalPosting{Ordinal: ordinal, Field: posting.Field, TF: posting.TF, Positions: posting.Positions})
+			docTokens[posting.DocID] = append(docTokens[posting.DocID], token)
+		}
+	}
+
+	terms := map[string][]uint32{}
+	docWords := map[string][]string{}
+	for _, term := range idx.Terms {
+		for _, id := range term.DocIDs {
+			ordinal, ok := ordinals[id]
+			if !ok {
+				continue
+			}
+			terms[term.Word] = append(terms[term.Word], ordinal)
+			docWords[id] = append(docWords[id], term.Word)
+		}
+	}
+
+	documents := make([]SQLIndexedDocument, len(ids))
+	for i, id := range ids {
+		documents[i] = SQLIndexedDocument{
+			UserID:  idx.UserID,
+			DocID:   id,
+			Ordinal: ordinals[id],
+			Lengths: encodeLengths(idx.DocLengths[id]),
+			Tokens:  encodeDictionary(docTokens[id]),
+			Words:   encodeDictionary(docWords[id]),
+		}
+	}
+	return documents, postings, terms
+}
+
+// saveRows inserts the documents and writes lists of the tokens and words, empty lists are deleted.
+func saveRows(tx *gorm.DB, userID uint, documents []SQLIndexedDocument, postings map[string][]ordinalPosting, terms map[string][]uint32) error {
+	var lists []SQLPostingList
+	var emptyTokens []string
+	for token, tokenPostings := range postings {
+		if len(tokenPostings) == 0 {
+			emptyTokens = append(emptyTokens, token)
+			continue
+		}
+		lists = append(lists, SQLPostingList{UserID: userID, Token: token, Postings: encodePostings(tokenPostings)})
+	}
+	var termLists []SQLTermList
+	var emptyWords []string
+	for word, ordinals := range terms {
+		if len(ordinals) == 0 {
+			emptyWords = append(emptyWords, word)
+			continue
+		}
+		termLists = append(termLists, SQLTermList{UserID: userID, Word: word, Ordinals: encodeOrdinals(ordinals)})
+	}
+
+	if len(emptyTokens) > 0 {
+		if err := tx.Where("user_id = ? AND token IN ?", userID, emptyTokens).Delete(&SQLPostingList{}).Error; err != nil {
+			return err
+		}
+	}
+	if len(emptyWords) > 0 {
+		if err := tx.Where("user_id = ? AND word IN ?", userID, emptyWords).Delete(&SQLTermList{}).Error; err != nil {
+			return err
+		}
+	}
+	if len(lists) > 0 {
+		if err := tx.Clauses(upsert("token", "postings")).CreateInBatches(lists, insertBatchSize).Error; err != nil {
+			return err
+		}
+	}
+	if len(termLists) > 0 {
+		if err := tx.Clauses(upsert("word", "ordinals")).CreateInBatches(termLists, insertBatchSize).Error; err != nil {
+			return err
+		}
+	}
+	if len(documents) > 0 {
+		if err := tx.CreateInBatches(documents, insertBatchSize).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upsert replaces the column of a list of the user's index that's stored already.
+func upsert(key, column string) clause.OnConflict {
+	return clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: key}},
+		DoUpdates: clause.AssignmentColumns([]string{column}),
+	}
+}
+
+// unmarshalAnalyzer restores a stored analyzer, it returns nil if no analyzer was stored.
+func unmarshalAnalyzer(data string) (*Analyzer, error) {
+	if data == "" {
+		return nil, nil
+	}
+	var analyzer *Analyzer
+	if err := json.Unmarshal([]byte(data), &analyzer); err != nil {
+		return nil, fmt.Errorf("could not unmarshal user index analyzer: %w", err)
+	}
+	return analyzer, nil
+}
+
+// sameAnalyzer reports whether the analyzers analyze text the same way, analyzers are compared by their configs
+// and by names if they can't be saved.
+func sameAnalyzer(a, b *Analyzer) bool {
+	aData, aErr := json.Marshal(a)
+	bData, bErr := json.Marshal(b)
+	if aErr != nil || bErr != nil {
+		return a.Name == b.Name
+	}
+	return bytes.Equal(aData, bData)
+}
+
+type SQLSynonymRepository struct {
+	db *gorm.DB
+}
+
+func NewSQLSynonymRepository(gorm *gorm.DB) *SQLSynonymRepository {
+	return &SQLSynonymRepository{db: gorm}
+}
+
+func (s *SQLSynonymRepository) FindAll(ctx context.Context, userID uint) ([]*SynonymSet, error) {
+	var sets []*SynonymSet
+	tx := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at, id").Find(&sets)
+	if err := tx.Error; err != nil {
+		return nil, fmt.Errorf("failed to find synonym sets: %w", err)
+	}
+	return sets, nil
+}
+
+func (s *SQLSynonymRepository) Create(ctx context.Context, set *SynonymSet) (*SynonymSet, error) {
+	err := s.db.WithContext(ctx).Create(set).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to create synonym set: %w", err)
+	}
+	return set, nil
+}
+
+func (s *SQLSynonymRepository) Update(ctx context.Context, userID uint, set *SynonymSet) error {
+	tx := s.db.WithContext(ctx).Model(&SynonymSet{ID: set.ID}).Where("user_id = ?", userID).Update("rule", set.Rule)
+	if err := tx.Error; err != nil {
+		return fmt.Errorf("failed to update synonym set: %w", err)
+	}
+	if tx.RowsAffected == 0 {
+		return ErrSynonymsNotFound
+	}
+	return nil
+}
+
+func (s *SQLSynonymRepository) Delete(ctx context.Context, userID uint, id string) error {
+	tx := s.db.WithContext(ctx).Where("user_id = ? AND id = ?", userID, id).Delete(&SynonymSet{})
+	if err := tx.Error; err != nil {
+		return fmt.Errorf("failed to delete synonym set: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"todo/user"
+
+	"gorm.io/gorm"
+)
+
+// sqlRepositoryDB returns the test database with tables of SQLRepository, rows of the user are deleted
+// before and after the test.
+func sqlRepositoryDB(t *testing.T, userID uint) *gorm.DB {
+	db := testDB(t)
+	if err := db.AutoMigrate(&SQLUserIndex{}, &SQLPostingList{}, &SQLIndexedDocument{}, &SQLTermList{}); err != nil {
+		t.Fatal(err)
+	}
+	cleanup := func() {
+		for _, model := range []interface{}{&SQLUserIndex{}, &SQLPostingList{}, &SQLIndexedDocument{}, &SQLTermList{}} {
+			if err := db.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+	return db
+}
+
+// TestSQLRepository runs the backend suite against indexes stored in a PostgreSQL database.
+func TestSQLRepository(t *testing.T) {
+	testBackend(t, func(t *testing.T) Backend {
+		return NewIndexBackend(NewSQLRepository(sqlRepositoryDB(t, 1)), backendSchema)
+	})
+}
+
+// TestSQLRepository_Migrate rebuilds an index stored as JSON and checks that the rebuilt index finds the same
+// documents as an index built from the documents.
+func TestSQLRepository_Migrate(t *testing.T) {
+	const userID = 4800
+	db := sqlRepositoryDB(t, userID)
+	if !db.Migrator().HasColumn(&SQLUserIndex{}, "index") {
+		if err := db.Exec(`ALTER TABLE sql_user_indices ADD COLUMN "index" text`).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a row written before the binary format
+	err := db.Exec(`INSERT INTO sql_user_indices (user_id, "index", analyzer) VALUES (?, ?, ?)`, userID, `{"releas":[]}`, `"english"`).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewSQLRepository(db)
+	documents := func(ctx context.Context, id uint) ([]Document, error) {
+		if id != userID {
+			t.Errorf("documents of user %d are loaded, want user %d", id, userID)
+		}
+		return backendDocuments, nil
+	}
+	if err := repo.Migrate(context.Background(), documents, backendSchema); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if db.Migrator().HasColumn(&SQLUserIndex{}, "index") {
+		t.Errorf("Migrate() kept the JSON column of indexes")
+	}
+	var row SQLUserIndex
+	if err := db.First(&row, "user_id = ?", userID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if row.Version != indexVersion || row.DocCount != len(backendDocuments) {
+		t.Errorf("Migrate() stored version %d with %d documents, want version %d with %d", row.Version, row.DocCount, indexVersion, len(backendDocuments))
+	}
+
+	ctx := context.WithValue(context.Background(), user.UserContextKey, user.User{ID: userID})
+	migrated := NewIndexBackend(repo, backendSchema)
+	built := NewIndexBackend(memoryRepository{}, backendSchema)
+	if err := built.Insert(ctx, backendDocuments...); err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range []string{"release", "title:write", `"weekly team"`, "notes OR bug", "status:finished"} {
+		q, err := ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := migrated.Search(ctx, q, nil)
+		if err != nil {
+			t.Fatalf("Search(%q) error = %v", query, err)
+		}
+		want, _ := built.Search(ctx, q, nil)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Search(%q) = %v, want %v", query, got, want)
+		}
+	}
+	suggestions, err := migrated.Suggest(ctx, "rel", 5)
+	if err != nil {
+		t.Fatalf("Suggest() error = %v", err)
+	}
+	if want, _ := built.Suggest(ctx, "rel", 5); !reflect.DeepEqual(suggestions, want) {
+		t.Errorf("Suggest() = %v, want %v", suggestions, want)
+	}
+}
+
+// TestSQLRepository_concurrentInserts indexes documents of a new user in parallel, so the user's index is created
+// and updated by concurrent requests, and checks that no document is lost.
+func TestSQLRepository_concurrentInserts(t *testing.T) {
+	const userID = 4300
+	db := sqlRepositoryDB(t, userID)
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(20)
+
+	const documents = 300
+	backend := NewIndexBackend(NewSQLRepository(db), backendSchema)
+	ctx := context.WithValue(context.Background(), user.UserContextKey, user.User{ID: userID})
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*documents)
+	for i := 0; i < documents; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("%03d", i)
+			errs <- backend.Insert(ctx, backendDocument(id, "Task "+id, "Created in parallel", "created"))
+			// every request also updates the same document
+			errs <- backend.Insert(ctx, backendDocument("shared", "Shared task", "Updated by request "+id, "created"))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+
+	q, err := ParseQuery("parallel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits, err := backend.Search(ctx, q, nil)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(hits) != documents {
+		t.Errorf("Search() found %d documents, want %d", len(hits), documents)
+	}
+	ids, err := backend.DocumentIDs(ctx)
+	if err != nil {
+		t.Fatalf("DocumentIDs() error = %v", err)
+	}
+	if len(ids) != documents+1 {
+		t.Errorf("DocumentIDs() returned %d documents, want %d", len(ids), documents+1)
+	}
+}
+
+// TestSQLRepository_stats checks that stats of an index are kept up to date by writes.
+func TestSQLRepository_stats(t *testing.T) {
+	const userID = 4900
+	db := sqlRepositoryDB(t, userID)
+	repo := NewSQLRepository(db)
+	ctx := context.WithValue(context.Background(), user.UserContextKey, user.User{ID: userID})
+	backend := NewIndexBackend(repo, backendSchema)
+	want := &UserIndex{UserID: userID, Index: Index{}, Analyzer: NewEnglishAnalyzer(), Schema: backendSchema}
+
+	checkStats := func(t *testing.T) {
+		t.Helper()
+		idx, err := repo.Find(ctx, userID)
+		if err != nil {
+			t.Fatalf("Find() error = %v", err)
+		}
+		if wantStats := newIndexStats(want.DocLengths); !reflect.DeepEqual(idx.Stats, wantStats) {
+			t.Errorf("Find() stats = %+v, want %+v", idx.Stats, wantStats)
+		}
+	}
+
+	if err := backend.Insert(ctx, backendDocuments...); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	for _, document := range backendDocuments {
+		want.Insert(document)
+	}
+	checkStats(t)
+
+	updated := backendDocument("2", "Fix the login bug of the mobile app", "Users can't log in", "created")
+	if err := backend.Insert(ctx, updated); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	want.Insert(updated)
+	if err := backend.Delete(ctx, backendDocuments[2]); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	delete(want.DocLengths, backendDocuments[2].ID)
+	checkStats(t)
+
+	checkStats(t)
+}
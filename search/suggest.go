@@ -0,0 +1,153 @@
+package search
+
+import (
+	"sort"
+	"strings"
+)
+
+type SuggestionKind string
+
+var (
+	TermSuggestion  SuggestionKind = "term"
+	TitleSuggestion SuggestionKind = "title"
+)
+
+// Suggestion is a completion of a search prefix.
+type Suggestion struct {
+	Text string         `json:"text"`
+	Kind SuggestionKind `json:"kind"`
+	// DocCount is the number of documents that contain the suggestion, suggestions are ranked by it.
+	DocCount int `json:"doc_count"`
+}
+
+// Term is an indexed word as it's written in documents(lower cased, but not stemmed) and documents that contain it.
+type Term struct {
+	Word   string   `json:"w"`
+	DocIDs []string `json:"ids"`
+}
+
+// Terms is a dictionary of indexed words sorted by word. Unlike Index it keeps words unstemmed,
+// so partial words can be completed.
+type Terms []Term
+
+// WithPrefix returns terms that start with the prefix.
+func (t Terms) WithPrefix(prefix string) Terms {
+	start := sort.Search(len(t), func(i int) bool { return t[i].Word >= prefix })
+	end := start
+	for end < len(t) && strings.HasPrefix(t[end].Word, prefix) {
+		end++
+	}
+	return t[start:end]
+}
+
+// add adds the document to the word's term, the term is created if it's a new word.
+func (t *Terms) add(word, docID string) {
+	terms := *t
+	i := sort.Search(len(terms), func(i int) bool { return terms[i].Word >= word })
+	if i < len(terms) && terms[i].Word == word {
+		for _, id := range terms[i].DocIDs {
+			if id == docID {
+				return
+			}
+		}
+		terms[i].DocIDs = append(terms[i].DocIDs, docID)
+		return
+	}
+
+	terms = append(terms, Term{})
+	copy(terms[i+1:], terms[i:])
+	terms[i] = Term{Word: word, DocIDs: []string{docID}}
+	*t = terms
+}
+
+// remove removes the document from the word's term, the term is removed when no documents contain it.
+func (t *Terms) remove(word, docID string) {
+	terms := *t
+	i := sort.Search(len(terms), func(i int) bool { return terms[i].Word >= word })
+	if i == len(terms) || terms[i].Word != word {
+		return
+	}
+	terms[i].DocIDs = removeID(terms[i].DocIDs, docID)
+	if len(terms[i].DocIDs) == 0 {
+		*t = append(terms[:i], terms[i+1:]...)
+	}
+}
+
+// purge removes the document from all terms.
+func (t *Terms) purge(docID string) {
+	terms := (*t)[:0]
+	for _, term := range *t {
+		term.DocIDs = removeID(term.DocIDs, docID)
+		if len(term.DocIDs) > 0 {
+			terms = append(terms, term)
+		}
+	}
+	*t = terms
+}
+
+// Suggest completes the last word of the prefix with indexed words, words found in more documents go first.
+// Preceding words of the prefix are kept as is, so "release no" may be completed to "release notes".
+func (idx *UserIndex) Suggest(prefix string, limit int) []Suggestion {
+	head, last, ok := completedWord(prefix)
+	if !ok {
+		return []Suggestion{}
+	}
+
+	terms := idx.Terms.WithPrefix(last)
+	suggestions := make([]Suggestion, 0, len(terms))
+	for _, term := range terms {
+		suggestions = append(suggestions, Suggestion{Text: head + term.Word, Kind: TermSuggestion, DocCount: len(term.DocIDs)})
+	}
+	SortSuggestions(suggestions)
+	if limit > 0 && len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+// completedWord splits the lower cased prefix into the last word, that's completed, and preceding text.
+// It returns false if there's nothing to complete, ex: the prefix ends with a space.
+func completedWord(prefix string) (string, string, bool) {
+	prefix = strings.ToLower(prefix)
+	words := tokenize(prefix)
+	if len(words) == 0 || !strings.HasSuffix(prefix, words[len(words)-1]) {
+		return "", "", false
+	}
+	last := words[len(words)-1]
+	return prefix[:len(prefix)-len(last)], last, true
+}
+
+// SortSuggestions sorts suggestions by document frequency, suggestions with equal frequency are sorted by text.
+func SortSuggestions(suggestions []Suggestion) {
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		if suggestions[i].DocCount != suggestions[j].DocCount {
+			return suggestions[i].DocCount > suggestions[j].DocCount
+		}
+		return suggestions[i].Text < suggestions[j].Text
+	})
+}
+
+// words returns distinct lower cased words of the text that are searchable, ex: stop words are skipped.
+func (idx *UserIndex) words(text string) []string {
+	var words []string
+	seen := map[string]struct{}{}
+	for _, word := range lowercaseFilter(tokenize(text)) {
+		if _, ok := seen[word]; ok {
+			continue
+		}
+		seen[word] = struct{}{}
+		if len(idx.Analyzer.Analyze(word)) > 0 {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+func removeID(ids []string, id string) []string {
+	for i := range ids {
+		if ids[i] == id {
+			return append(ids[:i], ids[i+1:]...)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,99 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUserIndex_Suggest(t *testing.T) {
+	docs := []Document{
+		textDocument("1", "Release notes"),
+		textDocument("2", "Read the release checklist"),
+		textDocument("3", "Relax"),
+		textDocument("4", "Write release notes"),
+	}
+	tests := []struct {
+		name    string
+		prefix  string
+		limit   int
+		deleted []Document
+		want    []Suggestion
+	}{
+		{
+			name:   "words found in more documents go first",
+			prefix: "Rel",
+			want: []Suggestion{
+				{Text: "release", Kind: TermSuggestion, DocCount: 3},
+				{Text: "relax", Kind: TermSuggestion, DocCount: 1},
+			},
+		},
+		{
+			name:   "preceding words are kept",
+			prefix: "release no",
+			want:   []Suggestion{{Text: "release notes", Kind: TermSuggestion, DocCount: 2}},
+		},
+		{
+			name:   "limit",
+			prefix: "r",
+			limit:  2,
+			want: []Suggestion{
+				{Text: "release", Kind: TermSuggestion, DocCount: 3},
+				{Text: "read", Kind: TermSuggestion, DocCount: 1},
+			},
+		},
+		{
+			name:   "stop words aren't suggested",
+			prefix: "th",
+			want:   []Suggestion{},
+		},
+		{
+			name:   "nothing to complete",
+			prefix: "release ",
+			want:   []Suggestion{},
+		},
+		{
+			name:    "deleted documents aren't counted",
+			prefix:  "rel",
+			deleted: []Document{docs[0], docs[2]},
+			want:    []Suggestion{{Text: "release", Kind: TermSuggestion, DocCount: 2}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := UserIndex{Index: Index{}}
+			for _, document := range docs {
+				idx.Insert(document)
+			}
+			for _, document := range tt.deleted {
+				idx.Delete(document)
+			}
+			if got := idx.Suggest(tt.prefix, tt.limit); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserIndex.Suggest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTerms(t *testing.T) {
+	var terms Terms
+	terms.add("notes", "1")
+	terms.add("deploy", "1")
+	terms.add("notes", "2")
+	terms.add("notes", "2")
+	terms.add("release", "2")
+	want := Terms{
+		{Word: "deploy", DocIDs: []string{"1"}},
+		{Word: "notes", DocIDs: []string{"1", "2"}},
+		{Word: "release", DocIDs: []string{"2"}},
+	}
+	if !reflect.DeepEqual(terms, want) {
+		t.Fatalf("Terms.add() = %v, want %v", terms, want)
+	}
+
+	terms.remove("deploy", "1")
+	terms.purge("2")
+	want = Terms{{Word: "notes", DocIDs: []string{"1"}}}
+	if !reflect.DeepEqual(terms, want) {
+		t.Fatalf("Terms.remove() = %v, want %v", terms, want)
+	}
+}
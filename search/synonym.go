@@ -0,0 +1,140 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSynonyms  = fmt.Errorf("invalid synonyms")
+	ErrSynonymsNotFound = fmt.Errorf("synonym set not found")
+)
+
+// synonymMappingMarker separates words of a one-way mapping from their synonyms.
+const synonymMappingMarker = "=>"
+
+// SynonymSet is a user-defined rule of words that are searched together. The rule is either a group of equivalent
+// words, ex: "bug, defect, issue", or a one-way mapping, ex: "k8s => kubernetes": searching k8s also finds kubernetes,
+// but searching kubernetes doesn't find k8s.
+// Synonyms are expanded when a query is searched, so changing them doesn't require reindexing.
+type SynonymSet struct {
+	ID        string    `json:"id" gorm:"primarykey"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	Rule      string    `json:"rule"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (s *SynonymSet) Validate() error {
+	_, _, err := parseSynonymRule(s.Rule)
+	return err
+}
+
+// Synonyms maps a lower cased word to words that are searched along with it.
+type Synonyms map[string][]string
+
+// NewSynonyms builds synonyms of the sets, invalid sets are skipped.
+func NewSynonyms(sets []*SynonymSet) Synonyms {
+	synonyms := Synonyms{}
+	for _, set := range sets {
+		from, to, err := parseSynonymRule(set.Rule)
+		if err != nil {
+			continue
+		}
+		for _, word := range from {
+			for _, synonym := range to {
+				synonyms.add(word, synonym)
+			}
+		}
+	}
+	return synonyms
+}
+
+func (s Synonyms) add(word, synonym string) {
+	if word == synonym {
+		return
+	}
+	for _, existing := range s[word] {
+		if existing == synonym {
+			return
+		}
+	}
+	s[word] = append(s[word], synonym)
+}
+
+// parseSynonymRule returns words of the rule and words they're expanded to.
+// Words of a group are expanded to each other.
+func parseSynonymRule(rule string) ([]string, []string, error) {
+	sides := strings.Split(rule, synonymMappingMarker)
+	if len(sides) > 2 {
+		return nil, nil, fmt.Errorf("%w: more than one %q", ErrInvalidSynonyms, synonymMappingMarker)
+	}
+
+	from, err := parseSynonymWords(sides[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(sides) == 1 {
+		if len(from) < 2 {
+			return nil, nil, fmt.Errorf("%w: a group needs at least two words", ErrInvalidSynonyms)
+		}
+		return from, from, nil
+	}
+
+	to, err := parseSynonymWords(sides[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(from) == 0 || len(to) == 0 {
+		return nil, nil, fmt.Errorf("%w: a mapping needs words on both sides", ErrInvalidSynonyms)
+	}
+	return from, to, nil
+}
+
+// parseSynonymWords parses a comma separated list of words, synonyms are single words.
+func parseSynonymWords(list string) ([]string, error) {
+	var words []string
+	for _, item := range strings.Split(list, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		if tokens := tokenize(item); len(tokens) != 1 || tokens[0] != item {
+			return nil, fmt.Errorf("%w: %q is not a single word", ErrInvalidSynonyms, item)
+		}
+		words = append(words, item)
+	}
+	return words, nil
+}
+
+// Analyze returns synonyms of tokens produced by the analyzer, ex: "bugs" and "defects" are found by "bug" and "defect"
+// synonyms after stemming. Words that are dropped by the analyzer(ex: stop words) are skipped.
+func (s Synonyms) Analyze(analyzer *Analyzer) Synonyms {
+	analyzed := make(Synonyms, len(s))
+	for word, synonyms := range s {
+		tokens := analyzer.Analyze(word)
+		if len(tokens) != 1 {
+			continue
+		}
+		for _, synonym := range synonyms {
+			if synonymTokens := analyzer.Analyze(synonym); len(synonymTokens) == 1 {
+				analyzed.add(tokens[0], synonymTokens[0])
+			}
+		}
+	}
+	return analyzed
+}
+
+// SynonymFilter creates a filter that adds synonyms after each token. It goes last in an analyzer,
+// so synonyms should be analyzed the same way as tokens, see Synonyms.Analyze.
+func SynonymFilter(synonyms Synonyms) Filter {
+	return func(tokens []string) []string {
+		r := make([]string, 0, len(tokens))
+		for _, token := range tokens {
+			r = append(r, token)
+			r = append(r, synonyms[token]...)
+		}
+		return r
+	}
+}
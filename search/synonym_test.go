@@ -0,0 +1,106 @@
+package search
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNewSynonyms(t *testing.T) {
+	sets := []*SynonymSet{
+		{Rule: "Bug, defect, issue"},
+		{Rule: "k8s => kubernetes"},
+		{Rule: "pr, mr => pull"},
+		{Rule: "invalid => "},
+	}
+	want := Synonyms{
+		"bug":    {"defect", "issue"},
+		"defect": {"bug", "issue"},
+		"issue":  {"bug", "defect"},
+		"k8s":    {"kubernetes"},
+		"pr":     {"pull"},
+		"mr":     {"pull"},
+	}
+	if got := NewSynonyms(sets); !reflect.DeepEqual(got, want) {
+		t.Errorf("NewSynonyms() = %v, want %v", got, want)
+	}
+}
+
+func TestSynonymSet_Validate(t *testing.T) {
+	tests := []struct {
+		rule    string
+		wantErr bool
+	}{
+		{rule: "bug, defect", wantErr: false},
+		{rule: "k8s => kubernetes", wantErr: false},
+		{rule: "bug", wantErr: true},
+		{rule: "=> kubernetes", wantErr: true},
+		{rule: "a => b => c", wantErr: true},
+		{rule: "pull request, pr", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			set := SynonymSet{Rule: tt.rule}
+			err := set.Validate()
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, ErrInvalidSynonyms)) {
+				t.Errorf("SynonymSet.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUserIndex_Search_synonyms(t *testing.T) {
+	docs := []Document{
+		textDocument("1", "Fix the login bug"),
+		textDocument("2", "Defect in exported reports"),
+		textDocument("3", "Upgrade kubernetes cluster"),
+		textDocument("4", "Clean up k8s manifests"),
+	}
+	synonyms := NewSynonyms([]*SynonymSet{{Rule: "bug, defect, issue"}, {Rule: "k8s => kubernetes"}})
+	tests := []struct {
+		name    string
+		query   string
+		wantIDs []string
+	}{
+		{
+			name:    "group of synonyms",
+			query:   "bugs",
+			wantIDs: []string{"1", "2"},
+		},
+		{
+			name:    "word that's found only by synonyms",
+			query:   "issue",
+			wantIDs: []string{"1", "2"},
+		},
+		{
+			name:    "one-way mapping",
+			query:   "k8s",
+			wantIDs: []string{"3", "4"},
+		},
+		{
+			name:    "one-way mapping isn't reversed",
+			query:   "kubernetes",
+			wantIDs: []string{"3"},
+		},
+		{
+			name:    "synonyms in a term with other words",
+			query:   "defect AND reports",
+			wantIDs: []string{"2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := UserIndex{Index: Index{}, Synonyms: synonyms}
+			for _, document := range docs {
+				idx.Insert(document)
+			}
+			query, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			if got := IDs(idx.Search(query)); !reflect.DeepEqual(got, tt.wantIDs) {
+				t.Errorf("UserIndex.Search() = %v, want %v", got, tt.wantIDs)
+			}
+		})
+	}
+}
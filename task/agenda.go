@@ -0,0 +1,82 @@
+package task
+
+import (
+	"errors"
+	"time"
+)
+
+type AgendaRange string
+
+var (
+	TodayRange AgendaRange = "today"
+	WeekRange  AgendaRange = "week"
+)
+
+var (
+	ErrInvalidAgendaRange = errors.New("invalid agenda range")
+)
+
+// maxUnscheduled limits the number of tasks without a due date in the agenda, the list of them can be long.
+const maxUnscheduled = 100
+
+// Agenda groups open tasks of a user by their due date in the user's timezone.
+type Agenda struct {
+	Overdue     []*Task     `json:"overdue"`
+	Today       []*Task     `json:"today"`
+	Upcoming    []AgendaDay `json:"upcoming"`
+	Unscheduled []*Task     `json:"unscheduled"`
+}
+
+type AgendaDay struct {
+	Date  string  `json:"date"`
+	Tasks []*Task `json:"tasks"`
+}
+
+// days returns the number of days the agenda covers, including today.
+func (r AgendaRange) days() (int, error) {
+	switch r {
+	case TodayRange:
+		return 1, nil
+	case WeekRange:
+		return 7, nil
+	default:
+		return 0, ErrInvalidAgendaRange
+	}
+}
+
+// newAgenda distributes tasks sorted by due date between overdue, today and upcoming days.
+func newAgenda(scheduled []*Task, unscheduled []*Task, today time.Time, days int) *Agenda {
+	agenda := &Agenda{
+		Overdue:     []*Task{},
+		Today:       []*Task{},
+		Upcoming:    []AgendaDay{},
+		Unscheduled: unscheduled,
+	}
+	tomorrow := today.AddDate(0, 0, 1)
+	for day := 1; day < days; day++ {
+		agenda.Upcoming = append(agenda.Upcoming, AgendaDay{
+			Date:  today.AddDate(0, 0, day).Format("2006-01-02"),
+			Tasks: []*Task{},
+		})
+	}
+
+	for _, t := range scheduled {
+		if t.DueAt == nil {
+			continue
+		}
+		due := t.DueAt.In(today.Location())
+		switch {
+		case due.Before(today):
+			agenda.Overdue = append(agenda.Overdue, t)
+		case due.Before(tomorrow):
+			agenda.Today = append(agenda.Today, t)
+		default:
+			day := time.Date(due.Year(), due.Month(), due.Day(), 0, 0, 0, 0, today.Location())
+			i := int(day.Sub(tomorrow).Hours()+12) / 24
+			if i >= 0 && i < len(agenda.Upcoming) {
+				agenda.Upcoming[i].Tasks = append(agenda.Upcoming[i].Tasks, t)
+			}
+		}
+	}
+	return agenda
+}
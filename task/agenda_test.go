@@ -0,0 +1,131 @@
+package task
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_newAgenda(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type due struct {
+		id string
+		at time.Time
+	}
+	tests := []struct {
+		name                   string
+		today                  time.Time
+		days                   int
+		due                    []due
+		wantOverdue, wantToday []string
+		// wantUpcoming are ids of tasks by day, days without tasks are empty
+		wantUpcoming map[string][]string
+	}{
+		{
+			name:  "week in UTC",
+			today: time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC),
+			days:  7,
+			due: []due{
+				{"overdue", time.Date(2024, time.March, 9, 23, 59, 0, 0, time.UTC)},
+				{"today", time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC)},
+				{"today evening", time.Date(2024, time.March, 10, 23, 59, 0, 0, time.UTC)},
+				{"tomorrow", time.Date(2024, time.March, 11, 0, 0, 0, 0, time.UTC)},
+				{"last day", time.Date(2024, time.March, 16, 12, 0, 0, 0, time.UTC)},
+				{"next week", time.Date(2024, time.March, 17, 0, 0, 0, 0, time.UTC)},
+			},
+			wantOverdue: []string{"overdue"},
+			wantToday:   []string{"today", "today evening"},
+			wantUpcoming: map[string][]string{
+				"2024-03-11": {"tomorrow"}, "2024-03-12": {}, "2024-03-13": {}, "2024-03-14": {}, "2024-03-15": {},
+				"2024-03-16": {"last day"},
+			},
+		},
+		{
+			name:  "today only",
+			today: time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC),
+			days:  1,
+			due: []due{
+				{"today", time.Date(2024, time.March, 10, 8, 0, 0, 0, time.UTC)},
+				{"tomorrow", time.Date(2024, time.March, 11, 8, 0, 0, 0, time.UTC)},
+			},
+			wantOverdue:  []string{},
+			wantToday:    []string{"today"},
+			wantUpcoming: map[string][]string{},
+		},
+		{
+			// the user's day starts at 23:00 UTC of the previous day
+			name:  "day boundary in the user's timezone",
+			today: time.Date(2024, time.March, 10, 0, 0, 0, 0, amsterdam),
+			days:  2,
+			due: []due{
+				{"yesterday 23:30", time.Date(2024, time.March, 9, 22, 30, 0, 0, time.UTC)},
+				{"today 00:30", time.Date(2024, time.March, 9, 23, 30, 0, 0, time.UTC)},
+				{"tomorrow 00:30", time.Date(2024, time.March, 10, 23, 30, 0, 0, time.UTC)},
+			},
+			wantOverdue:  []string{"yesterday 23:30"},
+			wantToday:    []string{"today 00:30"},
+			wantUpcoming: map[string][]string{"2024-03-11": {"tomorrow 00:30"}},
+		},
+		{
+			// the day DST starts is 23 hours long
+			name:  "day after DST change",
+			today: time.Date(2024, time.March, 9, 0, 0, 0, 0, newYork),
+			days:  3,
+			due: []due{
+				{"dst day", time.Date(2024, time.March, 10, 23, 30, 0, 0, newYork)},
+				{"day after dst", time.Date(2024, time.March, 11, 0, 30, 0, 0, newYork)},
+			},
+			wantOverdue:  []string{},
+			wantToday:    []string{},
+			wantUpcoming: map[string][]string{"2024-03-10": {"dst day"}, "2024-03-11": {"day after dst"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheduled := make([]*Task, len(tt.due))
+			for i, d := range tt.due {
+				at := d.at
+				scheduled[i] = &Task{ID: d.id, DueAt: &at}
+			}
+			unscheduled := []*Task{{ID: "unscheduled"}}
+
+			agenda := newAgenda(scheduled, unscheduled, tt.today, tt.days)
+			if got := taskIDs(agenda.Overdue); !reflect.DeepEqual(got, tt.wantOverdue) {
+				t.Errorf("newAgenda() overdue = %v, want %v", got, tt.wantOverdue)
+			}
+			if got := taskIDs(agenda.Today); !reflect.DeepEqual(got, tt.wantToday) {
+				t.Errorf("newAgenda() today = %v, want %v", got, tt.wantToday)
+			}
+			upcoming := map[string][]string{}
+			for _, day := range agenda.Upcoming {
+				upcoming[day.Date] = taskIDs(day.Tasks)
+			}
+			if !reflect.DeepEqual(upcoming, tt.wantUpcoming) {
+				t.Errorf("newAgenda() upcoming = %v, want %v", upcoming, tt.wantUpcoming)
+			}
+			if len(agenda.Upcoming) != tt.days-1 {
+				t.Errorf("newAgenda() has %d upcoming days, want %d", len(agenda.Upcoming), tt.days-1)
+			}
+			if got := taskIDs(agenda.Unscheduled); !reflect.DeepEqual(got, []string{"unscheduled"}) {
+				t.Errorf("newAgenda() unscheduled = %v, want the unscheduled task", got)
+			}
+		})
+	}
+}
+
+// taskIDs returns ids of the tasks in order.
+func taskIDs(tasks []*Task) []string {
+	ids := make([]string, len(tasks))
+	for i, t := range tasks {
+		ids[i] = t.ID
+	}
+	return ids
+}
@@ -0,0 +1,31 @@
+package task
+
+import (
+	"context"
+	"todo/search"
+	"todo/user"
+)
+
+// Facets are numbers of tasks that match a search by values of their fields, ex: for a sidebar like
+// "finished (12) / created (40)".
+type Facets struct {
+	Status map[Status]int64 `json:"status"`
+}
+
+// Facets counts the user's tasks of the search hits that match the filter by status. All hits are counted
+// regardless of pagination and the status filter, so every status of the sidebar has its count,
+// statuses without tasks have zero counts.
+func (s *Service) Facets(ctx context.Context, hits []search.Hit, filter Filter) (*Facets, error) {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+	filter.IncludeStatuses = nil
+
+	counts, err := s.Repo.CountByStatus(ctx, QueryOptions{Filter: filter, UserID: usr.ID, IDs: search.IDs(hits)})
+	if err != nil {
+		return nil, err
+	}
+	facets := &Facets{Status: map[Status]int64{CreatedStatus: 0, FinishedStatus: 0, ArchivedStatus: 0}}
+	for status, count := range counts {
+		facets.Status[status] = count
+	}
+	return facets, nil
+}
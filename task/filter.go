@@ -0,0 +1,81 @@
+package task
+
+import (
+	"errors"
+	"time"
+)
+
+type Sort string
+
+var (
+	SortCreatedAsc  Sort = "created_at"
+	SortCreatedDesc Sort = "-created_at"
+	SortUpdatedAsc  Sort = "updated_at"
+	SortUpdatedDesc Sort = "-updated_at"
+	SortDueAsc      Sort = "due_at"
+)
+
+// unscheduled is the sort key of tasks without a due date, they go after all scheduled tasks.
+var unscheduled = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+var (
+	ErrInvalidSort = errors.New("invalid sort")
+)
+
+// DefaultStatuses are used when a query doesn't ask for specific statuses, archived tasks are hidden.
+var DefaultStatuses = []Status{CreatedStatus, FinishedStatus}
+
+// Filter narrows down a list of tasks. Saved views store it as is, so it's evaluated against current data.
+type Filter struct {
+	IncludeStatuses []Status   `json:"statuses,omitempty"`
+	CreatedAfter    *time.Time `json:"created_after,omitempty"`
+	CreatedBefore   *time.Time `json:"created_before,omitempty"`
+	// CreatedWithinDays is relative to the moment of the query, ex: tasks created during the last 7 days.
+	CreatedWithinDays int        `json:"created_within_days,omitempty"`
+	DueAfter          *time.Time `json:"due_after,omitempty"`
+	DueBefore         *time.Time `json:"due_before,omitempty"`
+	// DueWithinDays is relative to the moment of the query, ex: tasks due in the next 7 days including overdue ones.
+	DueWithinDays int `json:"due_within_days,omitempty"`
+	// Scheduled selects only tasks with(true) or without(false) a due date.
+	Scheduled *bool `json:"scheduled,omitempty"`
+	Sort      Sort  `json:"sort,omitempty"`
+}
+
+func (f *Filter) Validate() error {
+	for _, status := range f.IncludeStatuses {
+		switch status {
+		case CreatedStatus, FinishedStatus, ArchivedStatus:
+			break
+		default:
+			return ErrInvalidStatus
+		}
+	}
+	switch f.Sort {
+	case "", SortCreatedAsc, SortCreatedDesc, SortUpdatedAsc, SortUpdatedDesc, SortDueAsc:
+		break
+	default:
+		return ErrInvalidSort
+	}
+	return nil
+}
+
+// SortKey returns the value of the task's field that the list is sorted by.
+func (f *Filter) SortKey(t *Task) time.Time {
+	switch f.Sort {
+	case SortUpdatedAsc, SortUpdatedDesc:
+		return t.UpdatedAt
+	case SortDueAsc:
+		if t.DueAt == nil {
+			return unscheduled
+		}
+		return *t.DueAt
+	default:
+		return t.CreatedAt
+	}
+}
+
+// Cursor is a position in the sorted list of tasks: the sort key and ID of the last seen task.
+type Cursor struct {
+	Key time.Time
+	ID  string
+}
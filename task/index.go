@@ -0,0 +1,148 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"todo/user"
+)
+
+// defaultCheckBatchSize is the number of users whose indexes are checked per batch by default.
+const defaultCheckBatchSize = 100
+
+// IndexReport is the result of checking a user's search index against the user's tasks.
+type IndexReport struct {
+	UserID uint `json:"user_id"`
+	// Orphaned are IDs of indexed documents that have no task.
+	Orphaned []string `json:"orphaned"`
+	// Missing are IDs of tasks that aren't indexed.
+	Missing []string `json:"missing"`
+	// Repaired is set when the index was rebuilt by the check.
+	Repaired bool `json:"repaired"`
+}
+
+// Consistent reports whether the index contains exactly the user's tasks.
+func (r *IndexReport) Consistent() bool {
+	return len(r.Orphaned) == 0 && len(r.Missing) == 0
+}
+
+// CheckOptions configure a check of search indexes.
+type CheckOptions struct {
+	// UserID limits the check to one user, zero means all users.
+	UserID uint
+	// BatchSize is the number of users loaded at once.
+	BatchSize int
+	// Repair rebuilds inconsistent indexes.
+	Repair bool
+}
+
+// RebuildIndex rebuilds the user's search index from the user's tasks by the analyzer of the user's settings
+// and returns the number of indexed tasks.
+func (s *Service) RebuildIndex(ctx context.Context, users user.Repository, userID uint) (int, error) {
+	usr, err := findUser(ctx, users, userID)
+	if err != nil {
+		return 0, err
+	}
+	documents, err := s.Documents(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	userCtx := context.WithValue(ctx, user.UserContextKey, usr)
+	if err := s.SearchService.Rebuild(userCtx, s.SearchService.Analyzer(userCtx), documents...); err != nil {
+		return 0, fmt.Errorf("failed to rebuild search index of user %d: %w", userID, err)
+	}
+	return len(documents), nil
+}
+
+// CheckIndex compares the user's search index with the user's tasks, an inconsistent index is rebuilt
+// by the analyzer of the user's settings if repair is set.
+func (s *Service) CheckIndex(ctx context.Context, users user.Repository, userID uint, repair bool) (*IndexReport, error) {
+	usr, err := findUser(ctx, users, userID)
+	if err != nil {
+		return nil, err
+	}
+	userCtx := context.WithValue(ctx, user.UserContextKey, usr)
+	indexed, err := s.SearchService.DocumentIDs(userCtx)
+	if err != nil {
+		return nil, err
+	}
+	documents, err := s.Documents(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &IndexReport{UserID: userID, Orphaned: []string{}, Missing: []string{}}
+	tasks := make(map[string]struct{}, len(documents))
+	for _, document := range documents {
+		tasks[document.ID] = struct{}{}
+	}
+	for _, id := range indexed {
+		if _, ok := tasks[id]; !ok {
+			report.Orphaned = append(report.Orphaned, id)
+		}
+		delete(tasks, id)
+	}
+	for id := range tasks {
+		report.Missing = append(report.Missing, id)
+	}
+	sort.Strings(report.Missing)
+
+	if repair && !report.Consistent() {
+		if err := s.SearchService.Rebuild(userCtx, s.SearchService.Analyzer(userCtx), documents...); err != nil {
+			return report, fmt.Errorf("failed to repair search index of user %d: %w", userID, err)
+		}
+		report.Repaired = true
+	}
+	return report, nil
+}
+
+// CheckIndexes checks the search index of the user of the options or indexes of all users in batches.
+// Reports are passed to the report func one by one, so results of a large check aren't kept in memory.
+func (s *Service) CheckIndexes(ctx context.Context, users user.Repository, opts CheckOptions, report func(*IndexReport) error) error {
+	if opts.UserID != 0 {
+		r, err := s.CheckIndex(ctx, users, opts.UserID, opts.Repair)
+		if err != nil {
+			return err
+		}
+		return report(r)
+	}
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultCheckBatchSize
+	}
+	var after uint
+	for {
+		userIDs, err := users.IDs(ctx, after, opts.BatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to find users: %w", err)
+		}
+		for _, userID := range userIDs {
+			r, err := s.CheckIndex(ctx, users, userID, opts.Repair)
+			if err != nil {
+				return err
+			}
+			if err := report(r); err != nil {
+				return err
+			}
+		}
+		if len(userIDs) < opts.BatchSize {
+			return nil
+		}
+		after = userIDs[len(userIDs)-1]
+	}
+}
+
+// findUser returns the user with their settings, a user that doesn't exist anymore is returned with the ID only,
+// so the user's index can still be maintained.
+func findUser(ctx context.Context, users user.Repository, userID uint) (user.User, error) {
+	found, err := users.FindByID(ctx, userID)
+	switch {
+	case err == nil:
+		return *found, nil
+	case errors.Is(err, user.ErrNotFound):
+		return user.User{ID: userID}, nil
+	default:
+		return user.User{}, fmt.Errorf("failed to find user %d: %w", userID, err)
+	}
+}
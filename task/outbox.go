@@ -0,0 +1,189 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"time"
+	"todo/search"
+	"todo/user"
+)
+
+const (
+	// maxIndexAttempts is the number of attempts after which a failed index job is dead-lettered.
+	maxIndexAttempts = 5
+	// indexRetryDelay is the delay before the first retry of a failed index job, it doubles with every attempt.
+	indexRetryDelay = time.Second
+	// indexJobLease is the time a worker has to process claimed jobs, then they're claimed by another worker.
+	indexJobLease = time.Minute
+	// DefaultIndexWait bounds how long a search waits for the user's own changes to be indexed.
+	DefaultIndexWait = 2 * time.Second
+	// indexWaitInterval is the interval of checking whether the user's changes are indexed.
+	indexWaitInterval = 50 * time.Millisecond
+)
+
+// IndexJob is a change of a task that has to be applied to the search index. Jobs are written to the outbox
+// in the same transaction as the task, so a saved change is indexed even if the search index is unavailable.
+type IndexJob struct {
+	ID     uint64 `gorm:"primarykey"`
+	UserID uint   `gorm:"index"`
+	TaskID string
+	// Attempts is the number of times the job was claimed by a worker.
+	Attempts  int
+	LastError string
+	// RunAt is the time the job can be claimed at, it's postponed after failed attempts.
+	RunAt time.Time `gorm:"index"`
+	// LockedUntil is the end of the lease of the worker that claimed the job.
+	LockedUntil *time.Time
+	// DeadAt is set when the job failed maxIndexAttempts times, dead jobs are kept for inspection and aren't retried.
+	DeadAt    *time.Time
+	CreatedAt time.Time
+}
+
+func newIndexJob(userID uint, taskID string) *IndexJob {
+	return &IndexJob{UserID: userID, TaskID: taskID, RunAt: time.Now()}
+}
+
+// IndexLag describes how far search indexes are behind tasks.
+type IndexLag struct {
+	// Pending is the number of jobs that aren't applied yet.
+	Pending int64 `json:"pending"`
+	// Dead is the number of dead-lettered jobs.
+	Dead int64 `json:"dead"`
+	// Seconds is the age of the oldest pending job.
+	Seconds float64 `json:"lag_seconds"`
+}
+
+// IndexLag returns the state of the outbox of index jobs, it's reported by the health check.
+func (s *Service) IndexLag(ctx context.Context) (*IndexLag, error) {
+	return s.Repo.IndexLag(ctx)
+}
+
+// ProcessIndexJobs claims jobs of the outbox in batches of batchSize and applies them to search indexes until
+// there are no jobs left, it returns the number of processed jobs. A task is indexed as it's stored when its jobs
+// are processed, so several changes of a task are indexed at once and deleted tasks are removed from the index.
+// Failed jobs are retried with a growing delay and dead-lettered after maxIndexAttempts. Jobs whose state can't be
+// saved are logged and claimed again when their lease ends, other tasks of the batch are still indexed.
+func (s *Service) ProcessIndexJobs(ctx context.Context, users user.Repository, batchSize int) (int, error) {
+	processed := 0
+	for {
+		jobs, err := s.Repo.ClaimIndexJobs(ctx, batchSize, indexJobLease)
+		if err != nil {
+			return processed, fmt.Errorf("failed to claim index jobs: %w", err)
+		}
+		s.processIndexJobs(ctx, users, jobs)
+		processed += len(jobs)
+		if len(jobs) < batchSize {
+			return processed, nil
+		}
+	}
+}
+
+// processIndexJobs indexes tasks of the claimed jobs, jobs of the same task are completed or failed together.
+func (s *Service) processIndexJobs(ctx context.Context, users user.Repository, jobs []*IndexJob) {
+	type taskKey struct {
+		userID uint
+		taskID string
+	}
+	byTask := map[taskKey][]*IndexJob{}
+	var keys []taskKey
+	for _, job := range jobs {
+		key := taskKey{userID: job.UserID, taskID: job.TaskID}
+		if _, ok := byTask[key]; !ok {
+			keys = append(keys, key)
+		}
+		byTask[key] = append(byTask[key], job)
+	}
+
+	owners := map[uint]user.User{}
+	for _, key := range keys {
+		taskJobs := byTask[key]
+		usr, ok := owners[key.userID]
+		var err error
+		if !ok {
+			if usr, err = findUser(ctx, users, key.userID); err == nil {
+				owners[key.userID] = usr
+			}
+		}
+		if err == nil {
+			err = s.indexTask(ctx, usr, key.taskID)
+		}
+		if err != nil {
+			for _, job := range taskJobs {
+				if err := s.failIndexJob(ctx, job, err); err != nil {
+					zap.S().With("error", err).With("task_id", job.TaskID).Error("failed index job isn't saved")
+				}
+			}
+			continue
+		}
+		ids := make([]uint64, len(taskJobs))
+		for i, job := range taskJobs {
+			ids[i] = job.ID
+		}
+		if err := s.Repo.CompleteIndexJobs(ctx, ids...); err != nil {
+			zap.S().With("error", err).With("task_id", key.taskID).Error("failed to complete index jobs")
+		}
+	}
+}
+
+// indexTask replaces the task in the user's search index with its stored version or removes it if it's deleted.
+func (s *Service) indexTask(ctx context.Context, usr user.User, taskID string) error {
+	userCtx := context.WithValue(ctx, user.UserContextKey, usr)
+	t, err := s.Repo.FindByID(ctx, usr.ID, taskID)
+	if err == ErrNotFound {
+		return s.SearchService.Delete(userCtx, search.Document{ID: taskID})
+	}
+	if err != nil {
+		return err
+	}
+	return s.SearchService.Insert(userCtx, document(t))
+}
+
+// failIndexJob schedules a retry of the failed job or dead-letters it if it has no attempts left.
+func (s *Service) failIndexJob(ctx context.Context, job *IndexJob, cause error) error {
+	job.LastError = cause.Error()
+	l := zap.S().With("error", cause).With("task_id", job.TaskID).With("attempts", job.Attempts)
+	if job.Attempts >= maxIndexAttempts {
+		now := time.Now()
+		job.DeadAt = &now
+		l.Error("index job is dead-lettered")
+	} else {
+		job.RunAt = time.Now().Add(indexRetryDelay << (job.Attempts - 1))
+		l.Warn("index job failed")
+	}
+	if err := s.Repo.FailIndexJob(ctx, job); err != nil {
+		return fmt.Errorf("failed to save failed index job: %w", err)
+	}
+	return nil
+}
+
+// waitIndexed waits until the user's changes made before the call are indexed, so the user finds tasks they've
+// just changed. Changes that failed to be indexed aren't waited for and the wait is bounded by IndexWait.
+func (s *Service) waitIndexed(ctx context.Context, userID uint) error {
+	if s.IndexWait <= 0 {
+		return nil
+	}
+	before := time.Now()
+	timeout := time.NewTimer(s.IndexWait)
+	defer timeout.Stop()
+	ticker := time.NewTicker(indexWaitInterval)
+	defer ticker.Stop()
+
+	for {
+		pending, err := s.Repo.PendingIndexJobs(ctx, userID, before)
+		if err != nil {
+			return fmt.Errorf("failed to find pending index jobs: %w", err)
+		}
+		if pending == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			zap.S().With("user_id", userID).With("pending", pending).Warn("search index is behind the user's changes")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+	"todo/search"
+	"todo/user"
+)
+
+// outboxBackend records documents inserted to and deleted from the index, inserts of failing documents fail.
+type outboxBackend struct {
+	search.Backend
+	failing  map[string]bool
+	inserted []string
+	deleted  []string
+}
+
+func (b *outboxBackend) Insert(ctx context.Context, documents ...search.Document) error {
+	for _, document := range documents {
+		if b.failing[document.ID] {
+			return errors.New("index is unavailable")
+		}
+		b.inserted = append(b.inserted, document.ID)
+	}
+	return nil
+}
+
+func (b *outboxBackend) Delete(ctx context.Context, document search.Document) error {
+	b.deleted = append(b.deleted, document.ID)
+	return nil
+}
+
+func TestService_ProcessIndexJobs(t *testing.T) {
+	jobs := []*IndexJob{
+		{ID: 1, UserID: 1, TaskID: "twice", Attempts: 1},
+		{ID: 2, UserID: 1, TaskID: "deleted", Attempts: 1},
+		{ID: 3, UserID: 1, TaskID: "twice", Attempts: 1},
+		{ID: 4, UserID: 1, TaskID: "failing", Attempts: 2},
+		{ID: 5, UserID: 1, TaskID: "dead", Attempts: maxIndexAttempts},
+		{ID: 6, UserID: 2, TaskID: "other", Attempts: 1},
+	}
+	claims := 0
+	var completed [][]uint64
+	failed := map[uint64]IndexJob{}
+	repo := MockRepository{
+		ClaimIndexJobsFn: func(ctx context.Context, limit int, lease time.Duration) ([]*IndexJob, error) {
+			claims++
+			if claims > 1 {
+				return nil, nil
+			}
+			return jobs, nil
+		},
+		FindByIDFn: func(ctx context.Context, userID uint, id string) (*Task, error) {
+			if id == "deleted" {
+				return nil, ErrNotFound
+			}
+			return &Task{ID: id, UserID: userID, Title: id}, nil
+		},
+		CompleteIndexJobsFn: func(ctx context.Context, ids ...uint64) error {
+			completed = append(completed, ids)
+			if ids[0] == 1 {
+				return errors.New("connection reset")
+			}
+			return nil
+		},
+		FailIndexJobFn: func(ctx context.Context, job *IndexJob) error {
+			failed[job.ID] = *job
+			if job.ID == 4 {
+				return errors.New("connection reset")
+			}
+			return nil
+		},
+	}
+	users := user.MockRepository{
+		FindByIDFn: func(ctx context.Context, id uint) (*user.User, error) {
+			return &user.User{ID: id}, nil
+		},
+	}
+	backend := &outboxBackend{failing: map[string]bool{"failing": true, "dead": true}}
+	service := &Service{Repo: repo, SearchService: &search.Service{Backend: backend}}
+
+	processed, err := service.ProcessIndexJobs(context.Background(), users, 10)
+	if err != nil {
+		t.Fatalf("ProcessIndexJobs() error = %v", err)
+	}
+	if processed != len(jobs) {
+		t.Errorf("ProcessIndexJobs() = %d, want %d", processed, len(jobs))
+	}
+
+	// jobs of the same task are applied at once
+	sort.Strings(backend.inserted)
+	if want := []string{"other", "twice"}; !reflect.DeepEqual(backend.inserted, want) {
+		t.Errorf("ProcessIndexJobs() inserted %v, want %v", backend.inserted, want)
+	}
+	if want := []string{"deleted"}; !reflect.DeepEqual(backend.deleted, want) {
+		t.Errorf("ProcessIndexJobs() deleted %v, want %v", backend.deleted, want)
+	}
+	// a job that isn't completed doesn't stop other tasks from being indexed
+	if want := [][]uint64{{1, 3}, {2}, {6}}; !reflect.DeepEqual(completed, want) {
+		t.Errorf("ProcessIndexJobs() completed %v, want %v", completed, want)
+	}
+
+	if len(failed) != 2 {
+		t.Fatalf("ProcessIndexJobs() failed %d jobs, want jobs 4 and 5", len(failed))
+	}
+	if job := failed[4]; job.DeadAt != nil || job.LastError == "" || !job.RunAt.After(time.Now()) {
+		t.Errorf("ProcessIndexJobs() failed job = %+v, want a retry", job)
+	}
+	if job := failed[5]; job.DeadAt == nil || job.LastError == "" {
+		t.Errorf("ProcessIndexJobs() failed job = %+v, want it dead-lettered", job)
+	}
+}
+
+func TestService_failIndexJob(t *testing.T) {
+	tests := []struct {
+		attempts  int
+		wantDelay time.Duration
+		wantDead  bool
+	}{
+		{attempts: 1, wantDelay: time.Second},
+		{attempts: 2, wantDelay: 2 * time.Second},
+		{attempts: 4, wantDelay: 8 * time.Second},
+		{attempts: maxIndexAttempts, wantDead: true},
+	}
+	for _, tt := range tests {
+		var saved *IndexJob
+		service := &Service{Repo: MockRepository{
+			FailIndexJobFn: func(ctx context.Context, job *IndexJob) error {
+				saved = job
+				return nil
+			},
+		}}
+		job := &IndexJob{ID: 1, TaskID: "1", Attempts: tt.attempts}
+		before := time.Now()
+		if err := service.failIndexJob(context.Background(), job, errors.New("index is unavailable")); err != nil {
+			t.Fatalf("failIndexJob() error = %v", err)
+		}
+		after := time.Now()
+		if saved != job || job.LastError != "index is unavailable" {
+			t.Fatalf("failIndexJob() saved %+v, want the job with its error", saved)
+		}
+		if tt.wantDead {
+			if job.DeadAt == nil {
+				t.Errorf("failIndexJob() after %d attempts didn't dead-letter the job", tt.attempts)
+			}
+			continue
+		}
+		if job.DeadAt != nil || job.RunAt.Before(before.Add(tt.wantDelay)) || job.RunAt.After(after.Add(tt.wantDelay)) {
+			t.Errorf("failIndexJob() after %d attempts runs the job at %v, want in %v", tt.attempts, job.RunAt.Sub(before), tt.wantDelay)
+		}
+	}
+}
+
+func TestService_waitIndexed(t *testing.T) {
+	tests := []struct {
+		name      string
+		indexWait time.Duration
+		// pending are the numbers of pending jobs returned by consecutive checks, the last one is repeated
+		pending   []int64
+		wantCalls int
+		// wantWait is the timeout the wait ends by, checks aren't counted then
+		wantWait time.Duration
+	}{
+		{name: "disabled", indexWait: 0, pending: []int64{1}, wantCalls: 0},
+		{name: "indexed", indexWait: time.Second, pending: []int64{0}, wantCalls: 1},
+		{name: "indexed meanwhile", indexWait: time.Second, pending: []int64{2, 1, 0}, wantCalls: 3},
+		{name: "timeout", indexWait: 4 * indexWaitInterval, pending: []int64{1}, wantWait: 4 * indexWaitInterval},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			start := time.Now()
+			service := &Service{IndexWait: tt.indexWait, Repo: MockRepository{
+				PendingIndexJobsFn: func(ctx context.Context, userID uint, before time.Time) (int64, error) {
+					if userID != 7 || before.Before(start) || before.After(time.Now()) {
+						t.Errorf("PendingIndexJobs() called for user %d before %v, want user 7 before the call", userID, before)
+					}
+					calls++
+					if calls > len(tt.pending) {
+						return tt.pending[len(tt.pending)-1], nil
+					}
+					return tt.pending[calls-1], nil
+				},
+			}}
+
+			if err := service.waitIndexed(context.Background(), 7); err != nil {
+				t.Fatalf("waitIndexed() error = %v", err)
+			}
+			waited := time.Since(start)
+			if tt.wantWait == 0 && calls != tt.wantCalls {
+				t.Errorf("waitIndexed() checked pending jobs %d times, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantWait > 0 && (waited < tt.wantWait || waited > tt.wantWait+time.Second) {
+				t.Errorf("waitIndexed() waited %v, want %v", waited, tt.wantWait)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"todo/search"
+	"todo/user"
+)
+
+const (
+	// DuplicateThreshold is the similarity from which a task is reported as a possible duplicate of a new task.
+	DuplicateThreshold = 0.8
+	// maxDuplicates is the number of possible duplicates reported for a new task.
+	maxDuplicates = 3
+)
+
+// Related returns hits of up to limit of the user's tasks most similar to the task, the most similar go first.
+// Scores of hits are cosine similarities of TF-IDF vectors of tasks from 0 to 1, archived tasks are skipped.
+// It waits for the user's own changes to be indexed first, like a search.
+func (s *Service) Related(ctx context.Context, t *Task, limit int) ([]search.Hit, error) {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	if err := s.waitIndexed(ctx, usr.ID); err != nil {
+		return nil, err
+	}
+	return s.related(ctx, t, 0, limit)
+}
+
+// Duplicates returns hits of the user's tasks that are at least DuplicateThreshold similar to the task, ex: to warn
+// that a new task may duplicate an existing one. It doesn't wait for indexing, so it doesn't slow down changes.
+func (s *Service) Duplicates(ctx context.Context, t *Task) ([]search.Hit, error) {
+	return s.related(ctx, t, DuplicateThreshold, maxDuplicates)
+}
+
+func (s *Service) related(ctx context.Context, t *Task, threshold float64, limit int) ([]search.Hit, error) {
+	hits, err := s.SearchService.Related(ctx, document(t), 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find related tasks: %w", err)
+	}
+	similar := hits[:0]
+	for _, hit := range hits {
+		if hit.Score >= threshold {
+			similar = append(similar, hit)
+		}
+	}
+	if len(similar) == 0 {
+		return similar, nil
+	}
+
+	similar, err = s.FilterHits(ctx, similar, Filter{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter related tasks: %w", err)
+	}
+	if limit > 0 && len(similar) > limit {
+		similar = similar[:limit]
+	}
+	return similar, nil
+}
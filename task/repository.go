@@ -2,26 +2,58 @@ package task
 
 import (
 	"context"
+	"time"
+	"todo/search"
 )
 
+// Repository stores tasks, changes of tasks write index jobs to the outbox in the same transaction.
 type Repository interface {
 	FindAll(ctx context.Context, options QueryOptions) ([]*Task, error)
 	CountAll(ctx context.Context, options QueryOptions) (int64, error)
+	// CountByStatus returns the number of tasks that match the options by status, statuses without tasks are omitted.
+	CountByStatus(ctx context.Context, options QueryOptions) (map[Status]int64, error)
 	FindByIDs(ctx context.Context, options QueryOptions) ([]*Task, error)
+	// FindIDs returns IDs of all tasks that match the options, pagination is ignored.
+	FindIDs(ctx context.Context, options QueryOptions) ([]string, error)
 	FindByID(ctx context.Context, userID uint, id string) (*Task, error)
 	Create(ctx context.Context, userId uint, task *Task) (*Task, error)
 	Update(ctx context.Context, userId uint, task *UpdateTask) error
 	Delete(ctx context.Context, userId uint, id string) error
+	Stats(ctx context.Context, options StatsOptions) (*Stats, error)
+	ArchiveFinished(ctx context.Context) ([]*Task, error)
+	SuggestTitles(ctx context.Context, options QueryOptions, prefix string, limit int) ([]search.Suggestion, error)
+	// ClaimIndexJobs leases up to limit jobs that are due for the lease duration, jobs of tasks that are leased
+	// by another worker aren't claimed. Jobs are returned in the order they were written.
+	ClaimIndexJobs(ctx context.Context, limit int, lease time.Duration) ([]*IndexJob, error)
+	// CompleteIndexJobs removes applied jobs from the outbox.
+	CompleteIndexJobs(ctx context.Context, ids ...uint64) error
+	// FailIndexJob saves the error, the next attempt time and the dead-letter time of the job and releases it.
+	FailIndexJob(ctx context.Context, job *IndexJob) error
+	// PendingIndexJobs returns the number of the user's jobs written before the time that neither failed nor were applied.
+	PendingIndexJobs(ctx context.Context, userID uint, before time.Time) (int64, error)
+	IndexLag(ctx context.Context) (*IndexLag, error)
 }
 
 type MockRepository struct {
 	FindAllFn   func(ctx context.Context, options QueryOptions) ([]*Task, error)
 	CountAllFn  func(ctx context.Context, options QueryOptions) (int64, error)
 	FindByIDsFn func(ctx context.Context, options QueryOptions) ([]*Task, error)
+	FindIDsFn   func(ctx context.Context, options QueryOptions) ([]string, error)
 	FindByIDFn  func(ctx context.Context, userID uint, id string) (*Task, error)
 	CreateFn    func(ctx context.Context, userId uint, task *Task) (*Task, error)
 	UpdateFn    func(ctx context.Context, userId uint, task *UpdateTask) error
 	DeleteFn    func(ctx context.Context, userId uint, id string) error
+	StatsFn     func(ctx context.Context, options StatsOptions) (*Stats, error)
+
+	ArchiveFinishedFn func(ctx context.Context) ([]*Task, error)
+	SuggestTitlesFn   func(ctx context.Context, options QueryOptions, prefix string, limit int) ([]search.Suggestion, error)
+	CountByStatusFn   func(ctx context.Context, options QueryOptions) (map[Status]int64, error)
+
+	ClaimIndexJobsFn    func(ctx context.Context, limit int, lease time.Duration) ([]*IndexJob, error)
+	CompleteIndexJobsFn func(ctx context.Context, ids ...uint64) error
+	FailIndexJobFn      func(ctx context.Context, job *IndexJob) error
+	PendingIndexJobsFn  func(ctx context.Context, userID uint, before time.Time) (int64, error)
+	IndexLagFn          func(ctx context.Context) (*IndexLag, error)
 }
 
 func (m MockRepository) FindAll(ctx context.Context, options QueryOptions) ([]*Task, error) {
@@ -32,10 +64,18 @@ func (m MockRepository) CountAll(ctx context.Context, options QueryOptions) (int
 	return m.CountAllFn(ctx, options)
 }
 
+func (m MockRepository) CountByStatus(ctx context.Context, options QueryOptions) (map[Status]int64, error) {
+	return m.CountByStatusFn(ctx, options)
+}
+
 func (m MockRepository) FindByIDs(ctx context.Context, options QueryOptions) ([]*Task, error) {
 	return m.FindByIDsFn(ctx, options)
 }
 
+func (m MockRepository) FindIDs(ctx context.Context, options QueryOptions) ([]string, error) {
+	return m.FindIDsFn(ctx, options)
+}
+
 func (m MockRepository) FindByID(ctx context.Context, userID uint, id string) (*Task, error) {
 	return m.FindByIDFn(ctx, userID, id)
 }
@@ -51,3 +91,35 @@ func (m MockRepository) Update(ctx context.Context, userId uint, task *UpdateTas
 func (m MockRepository) Delete(ctx context.Context, userId uint, id string) error {
 	return m.DeleteFn(ctx, userId, id)
 }
+
+func (m MockRepository) Stats(ctx context.Context, options StatsOptions) (*Stats, error) {
+	return m.StatsFn(ctx, options)
+}
+
+func (m MockRepository) ArchiveFinished(ctx context.Context) ([]*Task, error) {
+	return m.ArchiveFinishedFn(ctx)
+}
+
+func (m MockRepository) SuggestTitles(ctx context.Context, options QueryOptions, prefix string, limit int) ([]search.Suggestion, error) {
+	return m.SuggestTitlesFn(ctx, options, prefix, limit)
+}
+
+func (m MockRepository) ClaimIndexJobs(ctx context.Context, limit int, lease time.Duration) ([]*IndexJob, error) {
+	return m.ClaimIndexJobsFn(ctx, limit, lease)
+}
+
+func (m MockRepository) CompleteIndexJobs(ctx context.Context, ids ...uint64) error {
+	return m.CompleteIndexJobsFn(ctx, ids...)
+}
+
+func (m MockRepository) FailIndexJob(ctx context.Context, job *IndexJob) error {
+	return m.FailIndexJobFn(ctx, job)
+}
+
+func (m MockRepository) PendingIndexJobs(ctx context.Context, userID uint, before time.Time) (int64, error) {
+	return m.PendingIndexJobsFn(ctx, userID, before)
+}
+
+func (m MockRepository) IndexLag(ctx context.Context) (*IndexLag, error) {
+	return m.IndexLagFn(ctx)
+}
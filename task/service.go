@@ -3,6 +3,8 @@ package task
 import (
 	"context"
 	"fmt"
+	"sort"
+	"time"
 	"todo/search"
 	"todo/user"
 )
@@ -10,38 +12,159 @@ import (
 type Service struct {
 	Repo          Repository
 	SearchService *search.Service
+	// IndexWait bounds how long a search waits for the user's own changes to be indexed, zero disables waiting.
+	IndexWait time.Duration
 }
 
 type QueryOptions struct {
-	IDs             []string
-	UserID          uint
-	Limit           int
-	Offset          int
-	IncludeStatuses []Status
+	Filter
+	IDs    []string
+	UserID uint
+	Limit  int
+	Offset int
+	// After enables keyset pagination: only tasks sorted after the cursor are returned and Offset is ignored.
+	After *Cursor
 }
 
 func NewService(repo Repository, searchService *search.Service) *Service {
 	return &Service{
 		Repo:          repo,
 		SearchService: searchService,
+		IndexWait:     DefaultIndexWait,
 	}
 }
 
+// Search returns tasks that match the query, the most relevant tasks go first.
 func (s *Service) Search(ctx context.Context, query string, opts QueryOptions) ([]*Task, error) {
+	hits, err := s.SearchHits(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search: %w", err)
+	}
+	return s.FindByHits(ctx, hits, opts)
+}
+
+// SearchHits returns search hits of the user's tasks that match the query, it returns *search.ParseError
+// if the query is malformed. Tasks are indexed asynchronously, so it waits for the user's own changes
+// to be indexed first.
+func (s *Service) SearchHits(ctx context.Context, query string) ([]search.Hit, error) {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	if err := s.waitIndexed(ctx, usr.ID); err != nil {
+		return nil, err
+	}
+	return s.SearchService.Search(ctx, query)
+}
+
+// Suggest returns completions of the prefix: words of the user's tasks and titles of tasks, ranked by the number of tasks.
+func (s *Service) Suggest(ctx context.Context, prefix string, limit int) ([]search.Suggestion, error) {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	suggestions, err := s.SearchService.Suggest(ctx, prefix, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest terms: %w", err)
+	}
+	titles, err := s.Repo.SuggestTitles(ctx, QueryOptions{UserID: usr.ID, Filter: Filter{IncludeStatuses: DefaultStatuses}}, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions = append(suggestions, titles...)
+	search.SortSuggestions(suggestions)
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
+
+// FindByHits returns tasks of the search hits that match the filter in the order of hits.
+// Hits are expected to be paginated already, so pagination options are ignored.
+func (s *Service) FindByHits(ctx context.Context, hits []search.Hit, opts QueryOptions) ([]*Task, error) {
 	usr := ctx.Value(user.UserContextKey).(user.User)
 	opts.UserID = usr.ID
+	if len(opts.IncludeStatuses) == 0 {
+		opts.IncludeStatuses = DefaultStatuses
+	}
+	opts.IDs = search.IDs(hits)
+	opts.Limit, opts.Offset, opts.After = 0, 0, nil
 
-	documentIDs, err := s.SearchService.Search(ctx, query)
+	tasks, err := s.Repo.FindByIDs(ctx, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search: %w", err)
+		return nil, err
 	}
-	opts.IDs = documentIDs
-	return s.Repo.FindByIDs(ctx, opts)
+
+	rank := make(map[string]int, len(hits))
+	for i, hit := range hits {
+		rank[hit.ID] = i
+	}
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return rank[tasks[i].ID] < rank[tasks[j].ID]
+	})
+	return tasks, nil
+}
+
+// FilterHits returns search hits of the user's tasks that match the filter in the order of hits. All hits are
+// filtered at once, so a search combined with filters is paginated after filtering and ranking.
+func (s *Service) FilterHits(ctx context.Context, hits []search.Hit, filter Filter) ([]search.Hit, error) {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+	opts := QueryOptions{Filter: filter, UserID: usr.ID, IDs: search.IDs(hits)}
+	if len(opts.IncludeStatuses) == 0 {
+		opts.IncludeStatuses = DefaultStatuses
+	}
+
+	ids, err := s.Repo.FindIDs(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	matched := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		matched[id] = struct{}{}
+	}
+	filtered := make([]search.Hit, 0, len(ids))
+	for _, hit := range hits {
+		if _, ok := matched[hit.ID]; ok {
+			filtered = append(filtered, hit)
+		}
+	}
+	return filtered, nil
+}
+
+// Documents returns search documents of all user's tasks, it's used to rebuild the user's search index.
+func (s *Service) Documents(ctx context.Context, userID uint) ([]search.Document, error) {
+	tasks, err := s.Repo.FindAll(ctx, QueryOptions{
+		UserID: userID,
+		Filter: Filter{IncludeStatuses: []Status{CreatedStatus, FinishedStatus, ArchivedStatus}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find tasks: %w", err)
+	}
+
+	documents := make([]search.Document, len(tasks))
+	for i, t := range tasks {
+		documents[i] = document(t)
+	}
+	return documents, nil
+}
+
+// Reindex rebuilds the user's search index from all user's tasks, ex: after the user chose another analyzer.
+func (s *Service) Reindex(ctx context.Context) error {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	documents, err := s.Documents(ctx, usr.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.SearchService.Rebuild(ctx, s.SearchService.Analyzer(ctx), documents...); err != nil {
+		return fmt.Errorf("failed to rebuild search index: %w", err)
+	}
+	return nil
 }
 
 func (s *Service) FindAll(ctx context.Context, opts QueryOptions) ([]*Task, error) {
 	usr := ctx.Value(user.UserContextKey).(user.User)
 	opts.UserID = usr.ID
+	if len(opts.IncludeStatuses) == 0 {
+		opts.IncludeStatuses = DefaultStatuses
+	}
 
 	return s.Repo.FindAll(ctx, opts)
 }
@@ -49,10 +172,77 @@ func (s *Service) FindAll(ctx context.Context, opts QueryOptions) ([]*Task, erro
 func (s *Service) CountAll(ctx context.Context, opts QueryOptions) (int64, error) {
 	usr := ctx.Value(user.UserContextKey).(user.User)
 	opts.UserID = usr.ID
+	if len(opts.IncludeStatuses) == 0 {
+		opts.IncludeStatuses = DefaultStatuses
+	}
 
 	return s.Repo.CountAll(ctx, opts)
 }
 
+func (s *Service) Stats(ctx context.Context, opts StatsOptions) (*Stats, error) {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+	opts.UserID = usr.ID
+	opts.Location = usr.Settings.Location()
+	opts.Align()
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	return s.Repo.Stats(ctx, opts)
+}
+
+// ArchiveFinished archives finished tasks of all users according to their settings and returns their number.
+// Archived tasks are reindexed by index jobs, so they're found by their new status.
+func (s *Service) ArchiveFinished(ctx context.Context) (int64, error) {
+	tasks, err := s.Repo.ArchiveFinished(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(tasks)), nil
+}
+
+// Agenda returns open tasks of the user grouped by their due date.
+func (s *Service) Agenda(ctx context.Context, agendaRange AgendaRange) (*Agenda, error) {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	days, err := agendaRange.days()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().In(usr.Settings.Location())
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	end := today.AddDate(0, 0, days)
+	scheduled, unscheduled := true, false
+
+	dueTasks, err := s.Repo.FindAll(ctx, QueryOptions{
+		UserID: usr.ID,
+		Filter: Filter{
+			IncludeStatuses: []Status{CreatedStatus},
+			DueBefore:       &end,
+			Scheduled:       &scheduled,
+			Sort:            SortDueAsc,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find scheduled tasks: %w", err)
+	}
+
+	unscheduledTasks, err := s.Repo.FindAll(ctx, QueryOptions{
+		UserID: usr.ID,
+		Limit:  maxUnscheduled,
+		Filter: Filter{
+			IncludeStatuses: []Status{CreatedStatus},
+			Scheduled:       &unscheduled,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find unscheduled tasks: %w", err)
+	}
+
+	return newAgenda(dueTasks, unscheduledTasks, today, days), nil
+}
+
 func (s *Service) FindByID(ctx context.Context, id string) (*Task, error) {
 	usr := ctx.Value(user.UserContextKey).(user.User)
 
@@ -69,10 +259,6 @@ func (s *Service) Create(ctx context.Context, task *Task) (*Task, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create task: %w", err)
 	}
-	_ = s.SearchService.Insert(ctx, search.Document{
-		ID:      task.ID,
-		Content: fmt.Sprintf("%s %s", task.Title, task.Description),
-	})
 
 	return t, nil
 }
@@ -81,12 +267,7 @@ func (s *Service) Update(ctx context.Context, task *UpdateTask) (*Task, error) {
 	usr := ctx.Value(user.UserContextKey).(user.User)
 	oldTask := ctx.Value(TaskContextKey).(*Task)
 
-	// Delete old task from search index
-	_ = s.SearchService.Delete(ctx, search.Document{
-		ID:      oldTask.ID,
-		Content: fmt.Sprintf("%s %s", oldTask.Title, oldTask.Description),
-	})
-	// Update task in database
+	// Update task in database, it's reindexed by an index job
 	err := s.Repo.Update(ctx, usr.ID, task)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update task: %w", err)
@@ -97,25 +278,13 @@ func (s *Service) Update(ctx context.Context, task *UpdateTask) (*Task, error) {
 		return nil, fmt.Errorf("failed to update task: %w", err)
 	}
 
-	// Update search index
-	_ = s.SearchService.Insert(ctx, search.Document{
-		ID:      oldTask.ID,
-		Content: fmt.Sprintf("%s %s", newTask.Title, newTask.Description),
-	})
-
 	return newTask, nil
 }
 
 func (s *Service) Delete(ctx context.Context, id string) error {
 	usr := ctx.Value(user.UserContextKey).(user.User)
-	task := ctx.Value(TaskContextKey).(*Task)
 
-	// Delete the task from search index
-	_ = s.SearchService.Delete(ctx, search.Document{
-		ID:      id,
-		Content: fmt.Sprintf("%s %s", task.Title, task.Description),
-	})
-	// Delete the task from database
+	// Delete the task from database, it's removed from search index by an index job
 	err := s.Repo.Delete(ctx, usr.ID, id)
 	if err == ErrNotFound {
 		return nil
@@ -125,3 +294,15 @@ func (s *Service) Delete(ctx context.Context, id string) error {
 	}
 	return nil
 }
+
+// document converts a task to a searchable document.
+func document(t *Task) search.Document {
+	return search.Document{
+		ID: t.ID,
+		Fields: []search.Field{
+			{Name: TitleField, Text: t.Title},
+			{Name: DescriptionField, Text: t.Description},
+			{Name: StatusField, Text: string(t.Status)},
+		},
+	}
+}
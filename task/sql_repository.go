@@ -5,8 +5,22 @@ import (
 	"errors"
 	"fmt"
 	"gorm.io/gorm"
+	"sort"
+	"strings"
+	"time"
+	"todo/search"
 )
 
+// archiveLockID is a key of postgres advisory lock that makes only one replica archive tasks at a time.
+const archiveLockID = 7245001
+
+// claimLockID is a key of postgres advisory lock that serializes claims of index jobs, so jobs of a task
+// aren't claimed by two workers at once.
+const claimLockID = 7245002
+
+// indexJobBatchSize is the number of index jobs inserted by one statement.
+const indexJobBatchSize = 500
+
 type SQLRepository struct {
 	db *gorm.DB
 }
@@ -15,12 +29,21 @@ func NewSQLRepository(gorm *gorm.DB) *SQLRepository {
 	return &SQLRepository{db: gorm}
 }
 
+// Migrate fixes rows written by older versions: tasks finished before finish times were recorded get the time
+// of their last update as the finish time, so statistics count them as finished and they are archived.
+func (s *SQLRepository) Migrate(ctx context.Context) error {
+	tx := s.db.WithContext(ctx).Model(&Task{}).
+		Where("finished_at IS NULL AND status IN ?", []Status{FinishedStatus, ArchivedStatus}).
+		UpdateColumn("finished_at", gorm.Expr("updated_at"))
+	if err := tx.Error; err != nil {
+		return fmt.Errorf("failed to backfill finish times of tasks: %w", err)
+	}
+	return nil
+}
+
 func (s *SQLRepository) FindAll(ctx context.Context, options QueryOptions) ([]*Task, error) {
 	var tasks []*Task
-	tx := s.db.WithContext(ctx).
-		Limit(options.Limit).
-		Offset(options.Offset).
-		Where("user_id = ? ", options.UserID).
+	tx := paginate(filter(s.db.WithContext(ctx), options), options).
 		Find(&tasks)
 
 	if err := tx.Error; err != nil {
@@ -31,8 +54,7 @@ func (s *SQLRepository) FindAll(ctx context.Context, options QueryOptions) ([]*T
 
 func (s *SQLRepository) CountAll(ctx context.Context, options QueryOptions) (int64, error) {
 	count := int64(0)
-	tx := s.db.WithContext(ctx).Model(&Task{}).
-		Where("user_id = ? ", options.UserID).
+	tx := filter(s.db.WithContext(ctx).Model(&Task{}), options).
 		Count(&count)
 	if err := tx.Error; err != nil {
 		return 0, fmt.Errorf("failed to find tasks by ids: %w", err)
@@ -42,7 +64,11 @@ func (s *SQLRepository) CountAll(ctx context.Context, options QueryOptions) (int
 
 func (s *SQLRepository) FindByIDs(ctx context.Context, options QueryOptions) ([]*Task, error) {
 	var tasks []*Task
-	if err := s.db.Find(&tasks, options.IDs).Error; err != nil {
+	if options.IDs == nil {
+		options.IDs = []string{}
+	}
+	tx := paginate(filter(s.db.WithContext(ctx), options), options)
+	if err := tx.Find(&tasks).Error; err != nil {
 
 		return nil, fmt.Errorf("failed to find tasks by ids: %w", err)
 
@@ -50,6 +76,18 @@ func (s *SQLRepository) FindByIDs(ctx context.Context, options QueryOptions) ([]
 	return tasks, nil
 }
 
+func (s *SQLRepository) FindIDs(ctx context.Context, options QueryOptions) ([]string, error) {
+	var ids []string
+	if options.IDs == nil {
+		options.IDs = []string{}
+	}
+	tx := filter(s.db.WithContext(ctx).Model(&Task{}), options).Pluck("id", &ids)
+	if err := tx.Error; err != nil {
+		return nil, fmt.Errorf("failed to find task ids: %w", err)
+	}
+	return ids, nil
+}
+
 func (s *SQLRepository) FindByID(ctx context.Context, userID uint, id string) (*Task, error) {
 	var task Task
 	tx := s.db.Where("user_id = ? AND id = ?", userID, id).First(&task)
@@ -66,7 +104,12 @@ func (s *SQLRepository) FindByID(ctx context.Context, userID uint, id string) (*
 }
 
 func (s *SQLRepository) Create(ctx context.Context, userID uint, task *Task) (*Task, error) {
-	err := s.db.Create(task).Error
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(task).Error; err != nil {
+			return err
+		}
+		return tx.Create(newIndexJob(userID, task.ID)).Error
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create task: %w", err)
 	}
@@ -74,17 +117,37 @@ func (s *SQLRepository) Create(ctx context.Context, userID uint, task *Task) (*T
 }
 
 func (s *SQLRepository) Update(ctx context.Context, userID uint, task *UpdateTask) error {
-	tx := s.db.WithContext(ctx).Model(&Task{}).Where("user_id = ? AND id = ?", userID, task.ID)
+	updates := map[string]interface{}{}
 	if task.Title != nil {
-		tx = tx.Update("title", task.Title)
+		updates["title"] = *task.Title
 	}
 	if task.Description != nil {
-		tx = tx.Update("description", task.Description)
+		updates["description"] = *task.Description
+	}
+	if task.DueAt != nil {
+		updates["due_at"] = *task.DueAt
+	}
+	if task.ClearDueAt {
+		updates["due_at"] = nil
 	}
 	if task.Status != nil {
-		tx = tx.Update("status", task.Status)
+		updates["status"] = *task.Status
+		// finished_at is kept for archived tasks, so statistics don't lose completed work
+		switch *task.Status {
+		case FinishedStatus:
+			updates["finished_at"] = gorm.Expr("COALESCE(finished_at, ?)", time.Now())
+		case CreatedStatus:
+			updates["finished_at"] = nil
+		}
 	}
-	if err := tx.Error; err != nil {
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Task{}).Where("user_id = ? AND id = ?", userID, task.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Create(newIndexJob(userID, task.ID)).Error
+	})
+	if err != nil {
 		return fmt.Errorf("failed to update task: %w", err)
 	}
 
@@ -92,9 +155,297 @@ func (s *SQLRepository) Update(ctx context.Context, userID uint, task *UpdateTas
 }
 
 func (s *SQLRepository) Delete(ctx context.Context, userID uint, id string) error {
-	tx := s.db.WithContext(ctx).Where("user_id = ? AND id = ?", userID, id).Delete(&Task{})
-	if err := tx.Error; err != nil {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND id = ?", userID, id).Delete(&Task{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(newIndexJob(userID, id)).Error
+	})
+	if err != nil {
 		return fmt.Errorf("failed to delete task: %w", err)
 	}
 	return nil
 }
+
+func (s *SQLRepository) CountByStatus(ctx context.Context, options QueryOptions) (map[Status]int64, error) {
+	var rows []struct {
+		Status Status
+		Count  int64
+	}
+	tx := filter(s.db.WithContext(ctx).Model(&Task{}), options).Select("status, count(*) AS count").Group("status").Scan(&rows)
+	if err := tx.Error; err != nil {
+		return nil, fmt.Errorf("failed to count tasks by status: %w", err)
+	}
+	counts := make(map[Status]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+func (s *SQLRepository) Stats(ctx context.Context, options StatsOptions) (*Stats, error) {
+	db := s.db.WithContext(ctx)
+	scope := QueryOptions{Filter: options.Filter, UserID: options.UserID}
+	byStatus, err := s.CountByStatus(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+	stats := &Stats{ByStatus: byStatus}
+
+	tx := filter(db.Model(&Task{}), scope).
+		Select("COALESCE(EXTRACT(EPOCH FROM AVG(finished_at - created_at)), 0)").
+		Where("finished_at IS NOT NULL").
+		Scan(&stats.AvgCompletionSeconds)
+	if err := tx.Error; err != nil {
+		return nil, fmt.Errorf("failed to calculate average completion time: %w", err)
+	}
+
+	// Periods are generated in the user's local time and converted back to absolute time,
+	// so buckets start at the user's midnight even when DST changes in the middle of the series.
+	var series []struct {
+		Period   time.Time
+		Created  int64
+		Finished int64
+		Open     int64
+	}
+	tz := options.Location.String()
+	step := "1 " + string(options.Interval)
+	from := options.From.In(options.Location).Format("2006-01-02 15:04:05")
+	to := options.To.In(options.Location).Format("2006-01-02 15:04:05")
+	tasks := filter(db.Model(&Task{}), scope).Select("id, created_at, finished_at")
+	tx = db.Raw(`WITH t AS (?),
+		periods AS (
+			SELECT period, period AT TIME ZONE ? AS starts_at, (period + ?::interval) AT TIME ZONE ? AS ends_at
+			FROM generate_series(?::timestamp, ?::timestamp, ?::interval) AS period
+			WHERE period < ?::timestamp
+		)
+		SELECT p.period,
+			(SELECT count(*) FROM t WHERE t.created_at >= p.starts_at AND t.created_at < p.ends_at) AS created,
+			(SELECT count(*) FROM t WHERE t.finished_at >= p.starts_at AND t.finished_at < p.ends_at) AS finished,
+			(SELECT count(*) FROM t WHERE t.created_at < p.ends_at AND (t.finished_at IS NULL OR t.finished_at >= p.ends_at)) AS open
+		FROM periods p
+		ORDER BY p.period`,
+		tasks, tz, step, tz, from, to, step, to,
+	).Scan(&series)
+	if err := tx.Error; err != nil {
+		return nil, fmt.Errorf("failed to calculate tasks time series: %w", err)
+	}
+
+	stats.Throughput = make([]ThroughputPoint, 0, len(series))
+	stats.Burndown = make([]BurndownPoint, 0, len(series))
+	for _, row := range series {
+		// period is a local timestamp without timezone, restore the user's timezone
+		period := time.Date(row.Period.Year(), row.Period.Month(), row.Period.Day(), 0, 0, 0, 0, options.Location)
+		stats.Throughput = append(stats.Throughput, ThroughputPoint{Period: period, Created: row.Created, Finished: row.Finished})
+		stats.Burndown = append(stats.Burndown, BurndownPoint{Period: period, Open: row.Open})
+	}
+
+	return stats, nil
+}
+
+// ArchiveFinished archives tasks that were finished earlier than their owners' archive period, writes their index jobs
+// and returns them. Tasks without a finish time were finished by an older version, their last update is used instead.
+// If another replica is archiving tasks at the moment, it does nothing.
+func (s *SQLRepository) ArchiveFinished(ctx context.Context) ([]*Task, error) {
+	var archived []*Task
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var locked bool
+		if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?)", archiveLockID).Scan(&locked).Error; err != nil {
+			return fmt.Errorf("failed to acquire archive lock: %w", err)
+		}
+		if !locked {
+			return nil
+		}
+
+		now := time.Now()
+		err := tx.Raw(`UPDATE tasks SET status = ?, updated_at = ?
+			FROM users
+			WHERE tasks.user_id = users.id
+				AND tasks.status = ?
+				AND users.archive_after_days > 0
+				AND COALESCE(tasks.finished_at, tasks.updated_at) < ?::timestamptz - users.archive_after_days * interval '1 day'
+			RETURNING tasks.*`,
+			ArchivedStatus, now, FinishedStatus, now).Scan(&archived).Error
+		if err != nil {
+			return fmt.Errorf("failed to archive tasks: %w", err)
+		}
+		if len(archived) == 0 {
+			return nil
+		}
+
+		jobs := make([]*IndexJob, len(archived))
+		for i, t := range archived {
+			jobs[i] = newIndexJob(t.UserID, t.ID)
+		}
+		if err := tx.CreateInBatches(jobs, indexJobBatchSize).Error; err != nil {
+			return fmt.Errorf("failed to write index jobs of archived tasks: %w", err)
+		}
+		return nil
+	})
+	return archived, err
+}
+
+func (s *SQLRepository) ClaimIndexJobs(ctx context.Context, limit int, lease time.Duration) ([]*IndexJob, error) {
+	var jobs []*IndexJob
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", claimLockID).Error; err != nil {
+			return fmt.Errorf("failed to acquire claim lock: %w", err)
+		}
+
+		now := time.Now()
+		return tx.Raw(`UPDATE index_jobs SET attempts = attempts + 1, locked_until = ?
+			WHERE id IN (
+				SELECT j.id FROM index_jobs j
+				WHERE j.dead_at IS NULL
+					AND j.run_at <= ?
+					AND (j.locked_until IS NULL OR j.locked_until < ?)
+					AND NOT EXISTS (
+						SELECT 1 FROM index_jobs l
+						WHERE l.user_id = j.user_id AND l.task_id = j.task_id AND l.locked_until >= ?
+					)
+				ORDER BY j.id
+				LIMIT ?
+			)
+			RETURNING *`,
+			now.Add(lease), now, now, now, limit).Scan(&jobs).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim index jobs: %w", err)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs, nil
+}
+
+func (s *SQLRepository) CompleteIndexJobs(ctx context.Context, ids ...uint64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	tx := s.db.WithContext(ctx).Where("id IN ?", ids).Delete(&IndexJob{})
+	if err := tx.Error; err != nil {
+		return fmt.Errorf("failed to delete index jobs: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLRepository) FailIndexJob(ctx context.Context, job *IndexJob) error {
+	tx := s.db.WithContext(ctx).Model(&IndexJob{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+		"last_error":   job.LastError,
+		"run_at":       job.RunAt,
+		"dead_at":      job.DeadAt,
+		"locked_until": nil,
+	})
+	if err := tx.Error; err != nil {
+		return fmt.Errorf("failed to update index job: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLRepository) PendingIndexJobs(ctx context.Context, userID uint, before time.Time) (int64, error) {
+	count := int64(0)
+	tx := s.db.WithContext(ctx).Model(&IndexJob{}).
+		Where("user_id = ? AND created_at <= ? AND dead_at IS NULL AND last_error = ''", userID, before).
+		Count(&count)
+	if err := tx.Error; err != nil {
+		return 0, fmt.Errorf("failed to count pending index jobs: %w", err)
+	}
+	return count, nil
+}
+
+func (s *SQLRepository) IndexLag(ctx context.Context) (*IndexLag, error) {
+	var lag IndexLag
+	tx := s.db.WithContext(ctx).Model(&IndexJob{}).
+		Select(`count(*) FILTER (WHERE dead_at IS NULL) AS pending,
+			count(*) FILTER (WHERE dead_at IS NOT NULL) AS dead,
+			COALESCE(EXTRACT(EPOCH FROM now() - min(created_at) FILTER (WHERE dead_at IS NULL)), 0) AS seconds`).
+		Scan(&lag)
+	if err := tx.Error; err != nil {
+		return nil, fmt.Errorf("failed to calculate index lag: %w", err)
+	}
+	return &lag, nil
+}
+
+// SuggestTitles returns titles of tasks that start with the prefix(case-insensitive) along with the number of tasks,
+// the most common titles go first.
+func (s *SQLRepository) SuggestTitles(ctx context.Context, options QueryOptions, prefix string, limit int) ([]search.Suggestion, error) {
+	var suggestions []search.Suggestion
+	tx := filter(s.db.WithContext(ctx).Model(&Task{}), options).
+		Select("title AS text, COUNT(*) AS doc_count").
+		Where("lower(title) LIKE ?", likeEscaper.Replace(strings.ToLower(prefix))+"%").
+		Group("title").
+		Order("doc_count DESC, title").
+		Limit(limit).
+		Scan(&suggestions)
+	if err := tx.Error; err != nil {
+		return nil, fmt.Errorf("failed to suggest task titles: %w", err)
+	}
+	for i := range suggestions {
+		suggestions[i].Kind = search.TitleSuggestion
+	}
+	return suggestions, nil
+}
+
+// likeEscaper escapes wildcards of LIKE patterns.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// filter scopes the query to the user's tasks that match the filter.
+func filter(tx *gorm.DB, options QueryOptions) *gorm.DB {
+	tx = tx.Where("user_id = ?", options.UserID)
+	if options.IDs != nil {
+		tx = tx.Where("id IN ?", options.IDs)
+	}
+	if len(options.IncludeStatuses) > 0 {
+		tx = tx.Where("status IN ?", options.IncludeStatuses)
+	}
+	if options.CreatedAfter != nil {
+		tx = tx.Where("created_at >= ?", options.CreatedAfter)
+	}
+	if options.CreatedBefore != nil {
+		tx = tx.Where("created_at < ?", options.CreatedBefore)
+	}
+	if options.CreatedWithinDays > 0 {
+		tx = tx.Where("created_at >= ?", time.Now().AddDate(0, 0, -options.CreatedWithinDays))
+	}
+	if options.DueAfter != nil {
+		tx = tx.Where("due_at >= ?", options.DueAfter)
+	}
+	if options.DueBefore != nil {
+		tx = tx.Where("due_at < ?", options.DueBefore)
+	}
+	if options.DueWithinDays > 0 {
+		tx = tx.Where("due_at < ?", time.Now().AddDate(0, 0, options.DueWithinDays))
+	}
+	if options.Scheduled != nil && *options.Scheduled {
+		tx = tx.Where("due_at IS NOT NULL")
+	}
+	if options.Scheduled != nil && !*options.Scheduled {
+		tx = tx.Where("due_at IS NULL")
+	}
+	return tx
+}
+
+// paginate sorts tasks and applies either keyset(cursor) or offset pagination.
+// Keyset pagination doesn't have to skip rows and is stable when new tasks are created between page requests.
+func paginate(tx *gorm.DB, options QueryOptions) *gorm.DB {
+	column, direction, cmp := "created_at", "ASC", ">"
+	switch options.Sort {
+	case SortCreatedDesc:
+		direction, cmp = "DESC", "<"
+	case SortUpdatedAsc:
+		column = "updated_at"
+	case SortUpdatedDesc:
+		column, direction, cmp = "updated_at", "DESC", "<"
+	case SortDueAsc:
+		column = fmt.Sprintf("COALESCE(due_at, '%s')", unscheduled.Format(time.RFC3339))
+	}
+
+	tx = tx.Order(fmt.Sprintf("%s %s, id %s", column, direction, direction))
+	if options.Limit > 0 {
+		tx = tx.Limit(options.Limit)
+	}
+	if options.After != nil {
+		return tx.Where(fmt.Sprintf("(%s, id) %s (?, ?)", column, cmp), options.After.Key, options.After.ID)
+	}
+	return tx.Offset(options.Offset)
+}
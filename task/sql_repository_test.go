@@ -0,0 +1,209 @@
+package task
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+	"todo/user"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// testDB connects to the database set by TEST_POSTGRES_DSN, the test is skipped if it isn't set.
+// Tasks and index jobs of the user are deleted before and after the test.
+func testDB(t *testing.T, userID uint) *gorm.DB {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN isn't set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+	if err := db.AutoMigrate(&Task{}, &IndexJob{}); err != nil {
+		t.Fatal(err)
+	}
+	cleanup := func() {
+		for _, model := range []interface{}{&Task{}, &IndexJob{}} {
+			if err := db.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+	return db
+}
+
+// createTasks inserts tasks as they are, their finish and update times aren't set by the repository.
+func createTasks(t *testing.T, db *gorm.DB, tasks ...*Task) {
+	for _, task := range tasks {
+		if err := db.Create(task).Error; err != nil {
+			t.Fatal(err)
+		}
+		err := db.Model(task).UpdateColumns(map[string]interface{}{"updated_at": task.UpdatedAt, "finished_at": task.FinishedAt}).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSQLRepository_Stats(t *testing.T) {
+	const userID = 2800
+	db := testDB(t, userID)
+	repo := NewSQLRepository(db)
+	ctx := context.Background()
+
+	day := func(d, hour int) time.Time {
+		return time.Date(2024, time.January, d, hour, 0, 0, 0, time.UTC)
+	}
+	finishedAt := day(2, 11)
+	createTasks(t, db,
+		&Task{ID: "stats-open", UserID: userID, Title: "open", Status: CreatedStatus, CreatedAt: day(1, 10), UpdatedAt: day(1, 10)},
+		&Task{ID: "stats-finished", UserID: userID, Title: "finished", Status: FinishedStatus, CreatedAt: day(1, 11), UpdatedAt: finishedAt, FinishedAt: &finishedAt},
+		// finished before finish times were recorded
+		&Task{ID: "stats-legacy", UserID: userID, Title: "legacy", Status: FinishedStatus, CreatedAt: day(1, 12), UpdatedAt: day(3, 12)},
+	)
+
+	if err := repo.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	legacy, err := repo.FindByID(ctx, userID, "stats-legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if legacy.FinishedAt == nil || !legacy.FinishedAt.Equal(day(3, 12)) || !legacy.UpdatedAt.Equal(day(3, 12)) {
+		t.Fatalf("Migrate() finished_at = %v, updated_at = %v, want both %v", legacy.FinishedAt, legacy.UpdatedAt, day(3, 12))
+	}
+
+	stats, err := repo.Stats(ctx, StatsOptions{UserID: userID, Location: time.UTC, Interval: DayInterval, From: day(1, 0), To: day(4, 0)})
+	if err != nil {
+		t.Fatalf("Stats() error = %v", err)
+	}
+	if want := map[Status]int64{CreatedStatus: 1, FinishedStatus: 2}; !reflect.DeepEqual(stats.ByStatus, want) {
+		t.Errorf("Stats() by status = %v, want %v", stats.ByStatus, want)
+	}
+	// finished in 24 and 48 hours
+	if want := float64(36 * 60 * 60); stats.AvgCompletionSeconds != want {
+		t.Errorf("Stats() average completion = %v seconds, want %v", stats.AvgCompletionSeconds, want)
+	}
+	wantThroughput := []ThroughputPoint{
+		{Period: day(1, 0), Created: 3},
+		{Period: day(2, 0), Finished: 1},
+		{Period: day(3, 0), Finished: 1},
+	}
+	if !reflect.DeepEqual(stats.Throughput, wantThroughput) {
+		t.Errorf("Stats() throughput = %+v, want %+v", stats.Throughput, wantThroughput)
+	}
+	wantBurndown := []BurndownPoint{{Period: day(1, 0), Open: 3}, {Period: day(2, 0), Open: 2}, {Period: day(3, 0), Open: 1}}
+	if !reflect.DeepEqual(stats.Burndown, wantBurndown) {
+		t.Errorf("Stats() burndown = %+v, want %+v", stats.Burndown, wantBurndown)
+	}
+
+	// statistics are scoped by the filter
+	stats, err = repo.Stats(ctx, StatsOptions{Filter: Filter{IncludeStatuses: []Status{CreatedStatus}}, UserID: userID, Location: time.UTC, Interval: DayInterval, From: day(1, 0), To: day(4, 0)})
+	if err != nil {
+		t.Fatalf("Stats() error = %v", err)
+	}
+	if stats.AvgCompletionSeconds != 0 || stats.Throughput[0].Created != 1 || stats.Burndown[2].Open != 1 {
+		t.Errorf("Stats() of created tasks = %+v, want 1 open task", stats)
+	}
+}
+
+func TestSQLRepository_ArchiveFinished(t *testing.T) {
+	const userID = 2900
+	db := testDB(t, userID)
+	if err := db.AutoMigrate(&user.User{}); err != nil {
+		t.Fatal(err)
+	}
+	owner := &user.User{ID: userID, Username: "archive-test", Settings: user.Settings{ArchiveAfterDays: 7}}
+	if err := db.Save(owner).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Delete(owner) })
+	repo := NewSQLRepository(db)
+	ctx := context.Background()
+
+	now := time.Now()
+	longAgo, recently := now.AddDate(0, 0, -10), now.AddDate(0, 0, -2)
+	createTasks(t, db,
+		&Task{ID: "archive-old", UserID: userID, Title: "old", Status: FinishedStatus, CreatedAt: longAgo, UpdatedAt: longAgo, FinishedAt: &longAgo},
+		&Task{ID: "archive-recent", UserID: userID, Title: "recent", Status: FinishedStatus, CreatedAt: longAgo, UpdatedAt: recently, FinishedAt: &recently},
+		// finished before finish times were recorded
+		&Task{ID: "archive-legacy", UserID: userID, Title: "legacy", Status: FinishedStatus, CreatedAt: longAgo, UpdatedAt: longAgo},
+		&Task{ID: "archive-open", UserID: userID, Title: "open", Status: CreatedStatus, CreatedAt: longAgo, UpdatedAt: longAgo},
+	)
+
+	archived, err := repo.ArchiveFinished(ctx)
+	if err != nil {
+		t.Fatalf("ArchiveFinished() error = %v", err)
+	}
+	var ids []string
+	for _, task := range archived {
+		if task.UserID == userID {
+			ids = append(ids, task.ID)
+		}
+	}
+	sort.Strings(ids)
+	if want := []string{"archive-legacy", "archive-old"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("ArchiveFinished() = %v, want %v", ids, want)
+	}
+
+	var jobs []string
+	if err := db.Model(&IndexJob{}).Where("user_id = ?", userID).Order("task_id").Pluck("task_id", &jobs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(jobs, ids) {
+		t.Errorf("ArchiveFinished() wrote index jobs of %v, want %v", jobs, ids)
+	}
+
+	// archived tasks aren't listed by default
+	tasks, err := repo.FindAll(ctx, QueryOptions{UserID: userID, Filter: Filter{IncludeStatuses: DefaultStatuses}, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listed []string
+	for _, task := range tasks {
+		listed = append(listed, task.ID)
+	}
+	sort.Strings(listed)
+	if want := []string{"archive-open", "archive-recent"}; !reflect.DeepEqual(listed, want) {
+		t.Errorf("FindAll() of default statuses = %v, want %v", listed, want)
+	}
+}
+
+func TestSQLRepository_PendingIndexJobs(t *testing.T) {
+	const userID = 3000
+	db := testDB(t, userID)
+	repo := NewSQLRepository(db)
+	ctx := context.Background()
+
+	before := time.Now()
+	dead := before.Add(-time.Minute)
+	jobs := []*IndexJob{
+		{UserID: userID, TaskID: "pending", CreatedAt: before.Add(-time.Second)},
+		// failed jobs aren't waited for, they're retried later
+		{UserID: userID, TaskID: "failed", LastError: "index is unavailable", Attempts: 1, CreatedAt: before.Add(-time.Second)},
+		{UserID: userID, TaskID: "dead", LastError: "index is unavailable", Attempts: maxIndexAttempts, DeadAt: &dead, CreatedAt: before.Add(-time.Second)},
+		// changes made after the search aren't waited for
+		{UserID: userID, TaskID: "later", CreatedAt: before.Add(time.Second)},
+	}
+	for _, job := range jobs {
+		job.RunAt = job.CreatedAt
+		if err := db.Create(job).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pending, err := repo.PendingIndexJobs(ctx, userID, before)
+	if err != nil {
+		t.Fatalf("PendingIndexJobs() error = %v", err)
+	}
+	if pending != 1 {
+		t.Errorf("PendingIndexJobs() = %d, want 1", pending)
+	}
+}
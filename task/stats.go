@@ -0,0 +1,91 @@
+package task
+
+import (
+	"errors"
+	"time"
+)
+
+type Interval string
+
+var (
+	DayInterval  Interval = "day"
+	WeekInterval Interval = "week"
+)
+
+// maxPeriods limits the length of time series, so a single request can't aggregate decades day by day.
+const maxPeriods = 366
+
+var (
+	ErrInvalidInterval = errors.New("invalid interval")
+	ErrInvalidRange    = errors.New("invalid time range")
+)
+
+// StatsOptions describe which tasks are aggregated and how they are bucketed in time.
+type StatsOptions struct {
+	Filter
+	UserID uint
+	// Location is the user's timezone, day and week buckets start at the user's midnight.
+	Location *time.Location
+	Interval Interval
+	// From and To are the boundaries of the time series, From is inclusive and To is exclusive.
+	From time.Time
+	To   time.Time
+}
+
+func (o *StatsOptions) Validate() error {
+	switch o.Interval {
+	case DayInterval, WeekInterval:
+		break
+	default:
+		return ErrInvalidInterval
+	}
+	if !o.From.Before(o.To) || len(o.Periods()) > maxPeriods {
+		return ErrInvalidRange
+	}
+	return o.Filter.Validate()
+}
+
+// Align moves From to the start of its period(midnight or Monday's midnight) in the user's timezone.
+func (o *StatsOptions) Align() {
+	from := o.From.In(o.Location)
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, o.Location)
+	if o.Interval == WeekInterval {
+		from = from.AddDate(0, 0, -((int(from.Weekday()) + 6) % 7))
+	}
+	o.From = from
+}
+
+// Periods returns the start of every period between From and To.
+func (o *StatsOptions) Periods() []time.Time {
+	var periods []time.Time
+	for p := o.From; p.Before(o.To) && len(periods) <= maxPeriods; {
+		periods = append(periods, p)
+		if o.Interval == WeekInterval {
+			p = p.AddDate(0, 0, 7)
+		} else {
+			p = p.AddDate(0, 0, 1)
+		}
+	}
+	return periods
+}
+
+type Stats struct {
+	ByStatus map[Status]int64 `json:"by_status"`
+	// AvgCompletionSeconds is the average time between creation and completion of finished tasks.
+	AvgCompletionSeconds float64           `json:"avg_completion_seconds"`
+	Throughput           []ThroughputPoint `json:"throughput"`
+	Burndown             []BurndownPoint   `json:"burndown"`
+}
+
+// ThroughputPoint is the number of tasks created and finished during the period.
+type ThroughputPoint struct {
+	Period   time.Time `json:"period"`
+	Created  int64     `json:"created"`
+	Finished int64     `json:"finished"`
+}
+
+// BurndownPoint is the number of tasks that are still open at the end of the period.
+type BurndownPoint struct {
+	Period time.Time `json:"period"`
+	Open   int64     `json:"open"`
+}
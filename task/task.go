@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"time"
+	"todo/search"
 )
 
 type Status string
@@ -24,14 +25,31 @@ var (
 
 const TaskContextKey string = "task_ctx"
 
+// Searchable fields of tasks.
+const (
+	TitleField       = "title"
+	DescriptionField = "description"
+	StatusField      = "status"
+)
+
+// SearchSchema ranks title matches above description matches, status is searched only by field queries,
+// ex: status:finished.
+var SearchSchema = search.Schema{
+	TitleField:       {Boost: 2},
+	DescriptionField: {},
+	StatusField:      {Scoped: true},
+}
+
 type Task struct {
-	ID          string    `json:"id" gorm:"primarykey"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Status      Status    `json:"status"`
-	UserID      uint      `json:"user_id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          string     `json:"id" gorm:"primarykey"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Status      Status     `json:"status"`
+	UserID      uint       `json:"user_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	DueAt       *time.Time `json:"due_at,omitempty" gorm:"index"`
 }
 
 func (t *Task) Validate() error {
@@ -54,9 +72,12 @@ func (t Task) String() string {
 
 type UpdateTask struct {
 	ID          string
-	Title       *string `json:"title"`
-	Description *string `json:"description"`
-	Status      *Status `json:"status"`
+	Title       *string    `json:"title"`
+	Description *string    `json:"description"`
+	Status      *Status    `json:"status"`
+	DueAt       *time.Time `json:"due_at"`
+	// ClearDueAt removes the due date, DueAt is ignored in this case.
+	ClearDueAt bool `json:"-"`
 }
 
 func (t *UpdateTask) Validate() error {
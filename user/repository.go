@@ -8,7 +8,11 @@ import (
 
 type Repository interface {
 	FindByUsername(ctx context.Context, username string) (*User, error)
+	FindByID(ctx context.Context, id uint) (*User, error)
 	Create(ctx context.Context, user *User) (*User, error)
+	UpdateSettings(ctx context.Context, userID uint, settings Settings) error
+	// IDs returns up to limit IDs of users greater than after in ascending order, it's used to walk all users in batches.
+	IDs(ctx context.Context, after uint, limit int) ([]uint, error)
 }
 
 type SQLRepository struct {
@@ -29,6 +33,19 @@ func (s SQLRepository) FindByUsername(ctx context.Context, username string) (*Us
 
 }
 
+func (s SQLRepository) FindByID(ctx context.Context, id uint) (*User, error) {
+	var usr User
+	tx := s.db.WithContext(ctx).First(&usr, id)
+	switch {
+	case tx.Error == nil:
+		return &usr, nil
+	case errors.Is(tx.Error, gorm.ErrRecordNotFound):
+		return nil, ErrNotFound
+	default:
+		return nil, tx.Error
+	}
+}
+
 func (s SQLRepository) Create(ctx context.Context, user *User) (*User, error) {
 	tx := s.db.WithContext(ctx).Create(user)
 	switch {
@@ -39,19 +56,49 @@ func (s SQLRepository) Create(ctx context.Context, user *User) (*User, error) {
 	}
 }
 
+func (s SQLRepository) UpdateSettings(ctx context.Context, userID uint, settings Settings) error {
+	tx := s.db.WithContext(ctx).Model(&User{ID: userID}).Updates(map[string]interface{}{
+		"timezone":           settings.Timezone,
+		"archive_after_days": settings.ArchiveAfterDays,
+		"analyzer":           settings.Analyzer,
+	})
+	return tx.Error
+}
+
+func (s SQLRepository) IDs(ctx context.Context, after uint, limit int) ([]uint, error) {
+	var ids []uint
+	tx := s.db.WithContext(ctx).Model(&User{}).Where("id > ?", after).Order("id").Limit(limit).Pluck("id", &ids)
+	return ids, tx.Error
+}
+
 func NewSQLRepository(gorm *gorm.DB) Repository {
 	return &SQLRepository{db: gorm}
 }
 
 type MockRepository struct {
 	FindByUsernameFn func(ctx context.Context, username string) (*User, error)
+	FindByIDFn       func(ctx context.Context, id uint) (*User, error)
 	CreateFn         func(ctx context.Context, user *User) (*User, error)
+	UpdateSettingsFn func(ctx context.Context, userID uint, settings Settings) error
+	IDsFn            func(ctx context.Context, after uint, limit int) ([]uint, error)
 }
 
 func (m MockRepository) FindByUsername(ctx context.Context, username string) (*User, error) {
 	return m.FindByUsernameFn(ctx, username)
 }
 
+func (m MockRepository) FindByID(ctx context.Context, id uint) (*User, error) {
+	return m.FindByIDFn(ctx, id)
+}
+
 func (m MockRepository) Create(ctx context.Context, user *User) (*User, error) {
 	return m.CreateFn(ctx, user)
 }
+
+func (m MockRepository) UpdateSettings(ctx context.Context, userID uint, settings Settings) error {
+	return m.UpdateSettingsFn(ctx, userID, settings)
+}
+
+func (m MockRepository) IDs(ctx context.Context, after uint, limit int) ([]uint, error) {
+	return m.IDsFn(ctx, after, limit)
+}
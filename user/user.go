@@ -1,20 +1,104 @@
 package user
 
 import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"time"
 )
 
 const UserContextKey = "user"
 
+// DefaultArchiveAfterDays is the archive period of users who sign up, existing users keep archiving disabled.
+const DefaultArchiveAfterDays = 30
+
 var (
-	ErrNotFound = fmt.Errorf("user not found")
+	ErrNotFound             = fmt.Errorf("user not found")
+	ErrInvalidTimezone      = fmt.Errorf("invalid timezone")
+	ErrInvalidArchivePeriod = fmt.Errorf("invalid archive period")
 )
 
 type User struct {
 	ID             uint   `gorm:"primarykey"`
 	Username       string `gorm:"uniqueIndex"`
 	HashedPassword []byte
+	Settings       Settings `gorm:"embedded"`
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
 }
+
+// Settings are user preferences that affect how tasks are presented and maintained.
+type Settings struct {
+	// Timezone is an IANA timezone name, used to bucket tasks by the user's days. Empty means UTC.
+	Timezone string `json:"timezone"`
+	// ArchiveAfterDays is the number of days after which finished tasks are archived automatically. Zero disables it.
+	ArchiveAfterDays int `json:"archive_after_days" gorm:"not null;default:0"`
+	// Analyzer is the config of the search analyzer for the language of the user's tasks. Empty means english.
+	Analyzer Analyzer `json:"analyzer" gorm:"type:text"`
+}
+
+// Analyzer is the JSON of a search analyzer: its config or the name of an available analyzer, ex: "english".
+// It's kept as JSON, so users don't depend on the search package, which validates and builds analyzers.
+type Analyzer json.RawMessage
+
+// MarshalJSON writes the analyzer as is, no analyzer is written as an empty name.
+func (a Analyzer) MarshalJSON() ([]byte, error) {
+	if len(a) == 0 {
+		return []byte(`""`), nil
+	}
+	return a, nil
+}
+
+func (a *Analyzer) UnmarshalJSON(data []byte) error {
+	*a = append(Analyzer{}, data...)
+	return nil
+}
+
+// Scan reads a stored analyzer, analyzers were stored by their names before configs, so a name that isn't JSON
+// is read as a JSON string.
+func (a *Analyzer) Scan(value interface{}) error {
+	var data []byte
+	switch value := value.(type) {
+	case nil:
+	case string:
+		data = []byte(value)
+	case []byte:
+		data = value
+	default:
+		return fmt.Errorf("could not scan analyzer of type %T", value)
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] != '{' && data[0] != '"' {
+		name, err := json.Marshal(string(data))
+		if err != nil {
+			return err
+		}
+		data = name
+	}
+	*a = append(Analyzer{}, data...)
+	return nil
+}
+
+func (a Analyzer) Value() (driver.Value, error) {
+	return string(a), nil
+}
+
+func (s *Settings) Validate() error {
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return ErrInvalidTimezone
+	}
+	if s.ArchiveAfterDays < 0 {
+		return ErrInvalidArchivePeriod
+	}
+	return nil
+}
+
+// Location returns the user's timezone location.
+func (s *Settings) Location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
@@ -0,0 +1,41 @@
+package view
+
+import (
+	"context"
+)
+
+type Repository interface {
+	FindAll(ctx context.Context, userID uint) ([]*View, error)
+	FindByID(ctx context.Context, userID uint, id string) (*View, error)
+	Create(ctx context.Context, view *View) (*View, error)
+	Update(ctx context.Context, userID uint, view *UpdateView) error
+	Delete(ctx context.Context, userID uint, id string) error
+}
+
+type MockRepository struct {
+	FindAllFn  func(ctx context.Context, userID uint) ([]*View, error)
+	FindByIDFn func(ctx context.Context, userID uint, id string) (*View, error)
+	CreateFn   func(ctx context.Context, view *View) (*View, error)
+	UpdateFn   func(ctx context.Context, userID uint, view *UpdateView) error
+	DeleteFn   func(ctx context.Context, userID uint, id string) error
+}
+
+func (m MockRepository) FindAll(ctx context.Context, userID uint) ([]*View, error) {
+	return m.FindAllFn(ctx, userID)
+}
+
+func (m MockRepository) FindByID(ctx context.Context, userID uint, id string) (*View, error) {
+	return m.FindByIDFn(ctx, userID, id)
+}
+
+func (m MockRepository) Create(ctx context.Context, view *View) (*View, error) {
+	return m.CreateFn(ctx, view)
+}
+
+func (m MockRepository) Update(ctx context.Context, userID uint, view *UpdateView) error {
+	return m.UpdateFn(ctx, userID, view)
+}
+
+func (m MockRepository) Delete(ctx context.Context, userID uint, id string) error {
+	return m.DeleteFn(ctx, userID, id)
+}
@@ -0,0 +1,110 @@
+package view
+
+import (
+	"context"
+	"fmt"
+	"todo/search"
+	"todo/task"
+	"todo/user"
+)
+
+type Service struct {
+	Repo        Repository
+	TaskService *task.Service
+}
+
+func NewService(repo Repository, taskService *task.Service) *Service {
+	return &Service{
+		Repo:        repo,
+		TaskService: taskService,
+	}
+}
+
+func (s *Service) FindAll(ctx context.Context) ([]*View, error) {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	return s.Repo.FindAll(ctx, usr.ID)
+}
+
+func (s *Service) FindByID(ctx context.Context, id string) (*View, error) {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	return s.Repo.FindByID(ctx, usr.ID, id)
+}
+
+func (s *Service) Create(ctx context.Context, view *View) (*View, error) {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+	view.UserID = usr.ID
+	if err := view.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.validateQuery(view.Query); err != nil {
+		return nil, err
+	}
+	v, err := s.Repo.Create(ctx, view)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create view: %w", err)
+	}
+	return v, nil
+}
+
+func (s *Service) Update(ctx context.Context, view *UpdateView) (*View, error) {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+	if err := view.Validate(); err != nil {
+		return nil, err
+	}
+	if view.Query != nil {
+		if err := s.validateQuery(*view.Query); err != nil {
+			return nil, err
+		}
+	}
+	// an empty update changes no rows, so it isn't reported as a missing view
+	if view.Empty() {
+		return s.Repo.FindByID(ctx, usr.ID, view.ID)
+	}
+	if err := s.Repo.Update(ctx, usr.ID, view); err != nil {
+		return nil, fmt.Errorf("failed to update view: %w", err)
+	}
+	return s.Repo.FindByID(ctx, usr.ID, view.ID)
+}
+
+func (s *Service) Delete(ctx context.Context, id string) error {
+	usr := ctx.Value(user.UserContextKey).(user.User)
+
+	err := s.Repo.Delete(ctx, usr.ID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete view: %w", err)
+	}
+	return nil
+}
+
+// validateQuery rejects queries the search would reject, ex: queries of fields that aren't searchable.
+func (s *Service) validateQuery(query string) error {
+	if query == "" {
+		return nil
+	}
+	return s.TaskService.SearchService.ValidateQuery(query)
+}
+
+// Tasks evaluates the view against current tasks and returns a page of them along with the total number of matches.
+func (s *Service) Tasks(ctx context.Context, view *View, opts task.QueryOptions) ([]*task.Task, int64, error) {
+	opts.Filter = view.Filter
+
+	if view.Query != "" {
+		hits, err := s.TaskService.SearchHits(ctx, view.Query)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to search view tasks: %w", err)
+		}
+		opts.IDs = search.IDs(hits)
+	}
+
+	tasks, err := s.TaskService.FindAll(ctx, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find view tasks: %w", err)
+	}
+	total, err := s.TaskService.CountAll(ctx, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count view tasks: %w", err)
+	}
+	return tasks, total, nil
+}
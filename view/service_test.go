@@ -0,0 +1,147 @@
+package view
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"todo/search"
+	"todo/task"
+	"todo/user"
+)
+
+// testViewRepository returns a repository of the view "1" of user 42, updates are counted.
+func testViewRepository(updates *int) MockRepository {
+	return MockRepository{
+		FindByIDFn: func(ctx context.Context, userID uint, id string) (*View, error) {
+			if userID != 42 || id != "1" {
+				return nil, ErrNotFound
+			}
+			return &View{ID: id, UserID: userID, Name: "finished", Filter: task.Filter{IncludeStatuses: []task.Status{task.FinishedStatus}}}, nil
+		},
+		CreateFn: func(ctx context.Context, view *View) (*View, error) {
+			return view, nil
+		},
+		UpdateFn: func(ctx context.Context, userID uint, view *UpdateView) error {
+			*updates++
+			if userID != 42 || view.ID != "1" {
+				return ErrNotFound
+			}
+			return nil
+		},
+	}
+}
+
+func testContext() context.Context {
+	return context.WithValue(context.Background(), user.UserContextKey, user.User{ID: 42})
+}
+
+func TestService_Create(t *testing.T) {
+	var updates int
+	s := &Service{Repo: testViewRepository(&updates)}
+
+	v, err := s.Create(testContext(), &View{ID: "2", Name: "today"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.UserID != 42 {
+		t.Errorf("Create() view of user %d, want 42", v.UserID)
+	}
+
+	tests := map[string]*View{
+		"empty name":      {ID: "3"},
+		"malformed query": {ID: "3", Name: "bugs", Query: `"bug`},
+		"invalid filter":  {ID: "3", Name: "bugs", Filter: task.Filter{IncludeStatuses: []task.Status{"unknown"}}},
+	}
+	for name, view := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := s.Create(testContext(), view); err == nil {
+				t.Error("Create() error = nil, want validation error")
+			}
+		})
+	}
+}
+
+func TestService_Update(t *testing.T) {
+	name := "done"
+	empty := ""
+	tests := []struct {
+		name        string
+		view        *UpdateView
+		wantErr     error
+		wantUpdates int
+	}{
+		{name: "update", view: &UpdateView{ID: "1", Name: &name}, wantUpdates: 1},
+		{name: "empty update returns the view", view: &UpdateView{ID: "1"}},
+		{name: "empty update of a missing view", view: &UpdateView{ID: "2"}, wantErr: ErrNotFound},
+		{name: "missing view", view: &UpdateView{ID: "2", Name: &name}, wantErr: ErrNotFound, wantUpdates: 1},
+		{name: "empty name", view: &UpdateView{ID: "1", Name: &empty}, wantErr: ErrEmptyName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var updates int
+			s := &Service{Repo: testViewRepository(&updates)}
+
+			v, err := s.Update(testContext(), tt.view)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Update() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && v.ID != tt.view.ID {
+				t.Errorf("Update() = view %q, want %q", v.ID, tt.view.ID)
+			}
+			if updates != tt.wantUpdates {
+				t.Errorf("Update() updated the repository %d times, want %d", updates, tt.wantUpdates)
+			}
+		})
+	}
+}
+
+func TestService_Tasks(t *testing.T) {
+	var gotOptions task.QueryOptions
+	taskRepo := task.MockRepository{
+		FindAllFn: func(ctx context.Context, options task.QueryOptions) ([]*task.Task, error) {
+			gotOptions = options
+			return []*task.Task{{ID: "1", UserID: 42, Status: task.FinishedStatus}}, nil
+		},
+		CountAllFn: func(ctx context.Context, options task.QueryOptions) (int64, error) {
+			return 1, nil
+		},
+	}
+	searchService := &search.Service{
+		Backend: &search.IndexBackend{Repo: search.MockUserIndexRepository{
+			FindFn: func(ctx context.Context, userID uint) (*search.UserIndex, error) {
+				return &search.UserIndex{UserID: userID}, nil
+			},
+			FindDocLengthsFn: func(ctx context.Context, userID uint, docIDs []string) (map[string]map[string]int, error) {
+				return map[string]map[string]int{"1": {task.TitleField: 2}, "3": {task.TitleField: 2}}, nil
+			},
+			FindPostingsFn: func(ctx context.Context, userID uint, tokens []string) (search.Index, error) {
+				return search.Index{"milk": []search.Posting{{DocID: "1", Field: task.TitleField, TF: 1}, {DocID: "3", Field: task.TitleField, TF: 1}}}, nil
+			},
+		}},
+		SynonymRepo: search.MockSynonymRepository{
+			FindAllFn: func(ctx context.Context, userID uint) ([]*search.SynonymSet, error) {
+				return nil, nil
+			},
+		},
+	}
+	s := &Service{TaskService: &task.Service{Repo: taskRepo, SearchService: searchService}}
+
+	filter := task.Filter{IncludeStatuses: []task.Status{task.FinishedStatus}}
+	tasks, total, err := s.Tasks(testContext(), &View{ID: "1", Query: "milk", Filter: filter}, task.QueryOptions{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || total != 1 {
+		t.Errorf("Tasks() = %d tasks of %d, want 1 of 1", len(tasks), total)
+	}
+	if !reflect.DeepEqual(gotOptions.IncludeStatuses, filter.IncludeStatuses) {
+		t.Errorf("Tasks() statuses = %v, want the view's %v", gotOptions.IncludeStatuses, filter.IncludeStatuses)
+	}
+	ids := append([]string{}, gotOptions.IDs...)
+	sort.Strings(ids)
+	if !reflect.DeepEqual(ids, []string{"1", "3"}) || gotOptions.UserID != 42 || gotOptions.Limit != 10 {
+		t.Errorf("Tasks() options = %+v, want tasks 1 and 3 found by the view's query of user 42", gotOptions)
+	}
+}
@@ -0,0 +1,92 @@
+package view
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+)
+
+type SQLRepository struct {
+	db *gorm.DB
+}
+
+func NewSQLRepository(gorm *gorm.DB) *SQLRepository {
+	return &SQLRepository{db: gorm}
+}
+
+func (s *SQLRepository) FindAll(ctx context.Context, userID uint) ([]*View, error) {
+	var views []*View
+	tx := s.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("pinned DESC, position, created_at").
+		Find(&views)
+	if err := tx.Error; err != nil {
+		return nil, fmt.Errorf("failed to find views: %w", err)
+	}
+	return views, nil
+}
+
+func (s *SQLRepository) FindByID(ctx context.Context, userID uint, id string) (*View, error) {
+	var view View
+	tx := s.db.WithContext(ctx).Where("user_id = ? AND id = ?", userID, id).First(&view)
+	if err := tx.Error; err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return nil, ErrNotFound
+		default:
+			return nil, fmt.Errorf("failed to find view by id: %w", err)
+		}
+	}
+	return &view, nil
+}
+
+func (s *SQLRepository) Create(ctx context.Context, view *View) (*View, error) {
+	err := s.db.WithContext(ctx).Create(view).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to create view: %w", err)
+	}
+	return view, nil
+}
+
+func (s *SQLRepository) Update(ctx context.Context, userID uint, view *UpdateView) error {
+	updates := map[string]interface{}{}
+	if view.Name != nil {
+		updates["name"] = *view.Name
+	}
+	if view.Query != nil {
+		updates["query"] = *view.Query
+	}
+	if view.Filter != nil {
+		// serializer tag isn't applied to map updates, so the filter is marshaled by hand
+		filter, err := json.Marshal(view.Filter)
+		if err != nil {
+			return fmt.Errorf("failed to marshal view filter: %w", err)
+		}
+		updates["filter"] = string(filter)
+	}
+	if view.Pinned != nil {
+		updates["pinned"] = *view.Pinned
+	}
+	if view.Position != nil {
+		updates["position"] = *view.Position
+	}
+
+	tx := s.db.WithContext(ctx).Model(&View{ID: view.ID}).Where("user_id = ?", userID).Updates(updates)
+	if err := tx.Error; err != nil {
+		return fmt.Errorf("failed to update view: %w", err)
+	}
+	if tx.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLRepository) Delete(ctx context.Context, userID uint, id string) error {
+	tx := s.db.WithContext(ctx).Where("user_id = ? AND id = ?", userID, id).Delete(&View{})
+	if err := tx.Error; err != nil {
+		return fmt.Errorf("failed to delete view: %w", err)
+	}
+	return nil
+}
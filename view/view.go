@@ -0,0 +1,70 @@
+package view
+
+import (
+	"errors"
+	"time"
+	"todo/search"
+	"todo/task"
+)
+
+var (
+	ErrEmptyName = errors.New("name is empty")
+	ErrNotFound  = errors.New("view not found")
+)
+
+const ViewContextKey string = "view_ctx"
+
+// View is a saved filter(smart list). It stores only the filter, tasks are evaluated live on every request.
+type View struct {
+	ID     string      `json:"id" gorm:"primarykey"`
+	UserID uint        `json:"user_id" gorm:"index"`
+	Name   string      `json:"name"`
+	Query  string      `json:"query"`
+	Filter task.Filter `json:"filter" gorm:"serializer:json"`
+	// Pinned views go first in the index, then views are ordered by position.
+	Pinned    bool      `json:"pinned"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (v *View) Validate() error {
+	if v.Name == "" {
+		return ErrEmptyName
+	}
+	if v.Query != "" {
+		if _, err := search.ParseQuery(v.Query); err != nil {
+			return err
+		}
+	}
+	return v.Filter.Validate()
+}
+
+type UpdateView struct {
+	ID       string
+	Name     *string
+	Query    *string
+	Filter   *task.Filter
+	Pinned   *bool
+	Position *int
+}
+
+func (v *UpdateView) Validate() error {
+	if v.Name != nil && *v.Name == "" {
+		return ErrEmptyName
+	}
+	if v.Query != nil && *v.Query != "" {
+		if _, err := search.ParseQuery(*v.Query); err != nil {
+			return err
+		}
+	}
+	if v.Filter != nil {
+		return v.Filter.Validate()
+	}
+	return nil
+}
+
+// Empty reports whether the update changes nothing.
+func (v *UpdateView) Empty() bool {
+	return v.Name == nil && v.Query == nil && v.Filter == nil && v.Pinned == nil && v.Position == nil
+}